@@ -0,0 +1,99 @@
+package common
+
+import (
+	"fmt"
+	"math"
+)
+
+// ModelPickers the names of the model pickers registered by tstrain
+var ModelPickers = []string{"holdout", "yahoo_egads"}
+
+// ModelNames the names of the models registered by tstrain, sorted
+var ModelNames = []string{
+	"ARIMAModel",
+	"DcmpLineModel",
+	"EWMAModel",
+	"HoltWintersModel",
+	"LineModel",
+	"Period3SigmaModel",
+	"STLDcmpLineModel",
+}
+
+/*
+ModelParams 支持参数的模型到它的参数名, 与tstrain中的模型一致;
+	这些模型都支持sigma, 其他参数都在[0, 1]中, max_bad_per小于1; 不在其中的模型不支持参数;
+*/
+var ModelParams = map[string][]string{
+	"ARIMAModel":        nil,
+	"DcmpLineModel":     nil,
+	"EWMAModel":         {"alpha"},
+	"HoltWintersModel":  {"alpha", "beta", "gamma", "phi"},
+	"LineModel":         {"max_bad_per"},
+	"Period3SigmaModel": {"max_bad_per"},
+	"STLDcmpLineModel":  nil,
+}
+
+// ResolveModel 返回模型的全称, name可以省略Model后缀, 如HoltWinters
+func ResolveModel(name string) (string, bool) {
+	if contains(ModelNames, name) {
+		return name, true
+	}
+	if contains(ModelNames, name+"Model") {
+		return name + "Model", true
+	}
+	return "", false
+}
+
+/*
+CheckModels 检查model, models, model_picker和model_params中的名字和参数;
+	worker可以注册其他模型选择策略, 所以只在manager提交task时检查;
+*/
+func (c *TaskConfig) CheckModels() error {
+	if c.ModelPicker != "" && !contains(ModelPickers, c.ModelPicker) {
+		return fmt.Errorf("invalid config field model_picker: unknown picker %v, expect one of %v", c.ModelPicker, ModelPickers)
+	}
+	if c.Model != "" {
+		if _, ok := ResolveModel(c.Model); !ok {
+			return fmt.Errorf("invalid config field model: unknown model %v, expect one of %v", c.Model, ModelNames)
+		}
+	}
+	for _, m := range c.Models {
+		if _, ok := ResolveModel(m); !ok {
+			return fmt.Errorf("invalid config field models: unknown model %v, expect one of %v", m, ModelNames)
+		}
+	}
+	for m, params := range c.ModelParams {
+		name, ok := ResolveModel(m)
+		if !ok {
+			return fmt.Errorf("invalid config field model_params.%v: unknown model, expect one of %v", m, ModelNames)
+		}
+		keys, tunable := ModelParams[name]
+		if !tunable && len(params) > 0 {
+			return fmt.Errorf("invalid config field model_params.%v: the model has no params", m)
+		}
+		for key, val := range params {
+			if key == "sigma" {
+				continue
+			}
+			if !contains(keys, key) {
+				return fmt.Errorf("invalid config field model_params.%v.%v: unsupported param, expect sigma or one of %v", m, key, keys)
+			}
+			if math.IsNaN(val) || val > 1 {
+				return fmt.Errorf("invalid config field model_params.%v.%v: should be in [0, 1], got %v", m, key, val)
+			}
+			if key == "max_bad_per" && val == 1 {
+				return fmt.Errorf("invalid config field model_params.%v.%v: should be less than 1", m, key)
+			}
+		}
+	}
+	return nil
+}
+
+func contains(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package common
+
+import (
+	"fmt"
+	"math"
+)
+
+// Severity the severity of an anomaly or an incident
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+)
+
+// Level 0 for the unknown severity
+func (s Severity) Level() int {
+	switch s {
+	case SeverityInfo:
+		return 1
+	case SeverityWarning:
+		return 2
+	case SeverityCritical:
+		return 3
+	}
+	return 0
+}
+
+// ParseSeverity .
+func ParseSeverity(s string) (Severity, error) {
+	sev := Severity(s)
+	if sev.Level() == 0 {
+		return "", fmt.Errorf("unknown severity: %v, expect info, warning or critical", s)
+	}
+	return sev, nil
+}
+
+/*
+SeverityThresholds AnomalyScore到Severity的阈值;
+	score >= Info的点才是异常点, 为0时超出区间的点都是异常点;
+	score >= Critical为critical, score >= Warning为warning, 其他异常点为info;
+*/
+type SeverityThresholds struct {
+	Info     float64 `json:"info"`
+	Warning  float64 `json:"warning"`
+	Critical float64 `json:"critical"`
+}
+
+// Of .
+func (st SeverityThresholds) Of(score float64) Severity {
+	switch {
+	case score >= st.Critical:
+		return SeverityCritical
+	case score >= st.Warning:
+		return SeverityWarning
+	}
+	return SeverityInfo
+}
+
+// Validate .
+func (st SeverityThresholds) Validate() error {
+	if math.IsNaN(st.Info) || st.Info < 0 {
+		return fmt.Errorf("info should not be negative, got %v", st.Info)
+	}
+	if math.IsNaN(st.Warning) || st.Warning < st.Info {
+		return fmt.Errorf("warning should not be less than info, got %v", st.Warning)
+	}
+	if math.IsNaN(st.Critical) || st.Critical < st.Warning {
+		return fmt.Errorf("critical should not be less than warning, got %v", st.Critical)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package common
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestSeverityThresholds(t *testing.T) {
+	cases := []struct {
+		st  SeverityThresholds
+		err string
+	}{
+		{SeverityThresholds{Warning: 1, Critical: 3}, ""},
+		{SeverityThresholds{Info: 1, Warning: 1, Critical: 1}, ""},
+		{SeverityThresholds{Info: -1, Warning: 1, Critical: 3}, "info should not be negative"},
+		{SeverityThresholds{Info: math.NaN(), Warning: 1, Critical: 3}, "info should not be negative"},
+		{SeverityThresholds{Info: 2, Warning: 1, Critical: 3}, "warning should not be less than info"},
+		{SeverityThresholds{Warning: 3, Critical: 1}, "critical should not be less than warning"},
+		{SeverityThresholds{Warning: 1, Critical: math.NaN()}, "critical should not be less than warning"},
+	}
+	for i, c := range cases {
+		err := c.st.Validate()
+		if c.err == "" && err != nil || c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Fatalf("case %v: err %v, expect %q", i, err, c.err)
+		}
+	}
+
+	st := SeverityThresholds{Warning: 1, Critical: 3}
+	for score, expt := range map[float64]Severity{0.5: SeverityInfo, 1: SeverityWarning, 2.9: SeverityWarning, 3: SeverityCritical} {
+		if sev := st.Of(score); sev != expt {
+			t.Fatalf("score %v: %v, expect %v", score, sev, expt)
+		}
+	}
+}
+
+func TestParseSeverity(t *testing.T) {
+	for _, s := range []string{"info", "warning", "critical"} {
+		if sev, err := ParseSeverity(s); err != nil || string(sev) != s || sev.Level() == 0 {
+			t.Fatalf("parse %v: %v, err: %v", s, sev, err)
+		}
+	}
+	if _, err := ParseSeverity("fatal"); err == nil {
+		t.Fatal("expect err for unknown severity")
+	}
+	if !(SeverityInfo.Level() < SeverityWarning.Level() && SeverityWarning.Level() < SeverityCritical.Level()) {
+		t.Fatal("the levels are not ordered")
+	}
+}
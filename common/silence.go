@@ -0,0 +1,92 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// the pseudo tags of the ts which can be matched by Silence.Matchers
+const (
+	SilenceTagType = "__type__"
+	SilenceTagKey  = "__key__"
+)
+
+/*
+Silence 屏蔽一段时间内匹配的ts的告警;
+	Task和Matchers的值都是glob, 如: "cpu_*"; *匹配任意字符(包括/), ?匹配单个字符;
+	Task为空时匹配所有task, Matchers的key为DataSource.Extra中的tag, 以及__type__和__key__;
+	所有matcher都匹配时ts才被屏蔽, 缺少tag时不匹配;
+*/
+type Silence struct {
+	ID        int64             `json:"id"`
+	Task      string            `json:"task"`
+	Matchers  map[string]string `json:"matchers"`
+	StartsAt  time.Time         `json:"starts_at"`
+	EndsAt    time.Time         `json:"ends_at"`
+	CreatedBy string            `json:"created_by"`
+	Comment   string            `json:"comment"`
+}
+
+// Validate .
+func (s *Silence) Validate() error {
+	if s.Task == "" && len(s.Matchers) == 0 {
+		return fmt.Errorf("invalid silence: no task or matchers")
+	}
+	for tag := range s.Matchers {
+		if tag == "" {
+			return fmt.Errorf("invalid silence matchers: empty tag")
+		}
+	}
+	if !s.EndsAt.After(s.StartsAt) {
+		return fmt.Errorf("invalid silence: ends_at %v is not after starts_at %v", s.EndsAt, s.StartsAt)
+	}
+	return nil
+}
+
+// Active .
+func (s *Silence) Active(now time.Time) bool {
+	return !now.Before(s.StartsAt) && now.Before(s.EndsAt)
+}
+
+// Match tags为ts的tags, 见detector.SourceTags
+func (s *Silence) Match(task string, tags map[string]string) bool {
+	if s.Task != "" {
+		if !globMatch(s.Task, task) {
+			return false
+		}
+	}
+	if len(s.Matchers) == 0 {
+		return true
+	}
+	for tag, pattern := range s.Matchers {
+		val, exist := tags[tag]
+		if !exist {
+			return false
+		}
+		if !globMatch(pattern, val) {
+			return false
+		}
+	}
+	return true
+}
+
+// globMatch 与path.Match不同, *也匹配/, 如: "http://host/*"匹配"http://host/api/cpu"
+func globMatch(pattern, val string) bool {
+	var buf strings.Builder
+	buf.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			buf.WriteString(".*")
+		case '?':
+			buf.WriteString(".")
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	buf.WriteString("$")
+	ok, _ := regexp.MatchString(buf.String(), val)
+	return ok
+}
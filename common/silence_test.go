@@ -0,0 +1,65 @@
+package common
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSilenceValidate(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	cases := []struct {
+		silence Silence
+		err     string
+	}{
+		{Silence{Task: "cpu_*", StartsAt: now, EndsAt: now.Add(time.Hour)}, ""},
+		{Silence{Matchers: map[string]string{"host": "web-*"}, StartsAt: now, EndsAt: now.Add(time.Hour)}, ""},
+		{Silence{StartsAt: now, EndsAt: now.Add(time.Hour)}, "no task or matchers"},
+		{Silence{Matchers: map[string]string{"": "web-*"}, StartsAt: now, EndsAt: now.Add(time.Hour)}, "empty tag"},
+		{Silence{Task: "cpu_*", StartsAt: now, EndsAt: now}, "is not after starts_at"},
+		{Silence{Task: "cpu_*", StartsAt: now, EndsAt: now.Add(-time.Hour)}, "is not after starts_at"},
+	}
+	for i, c := range cases {
+		err := c.silence.Validate()
+		if c.err == "" && err != nil || c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Fatalf("case %v: err %v, expect %q", i, err, c.err)
+		}
+	}
+}
+
+func TestSilenceActive(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	s := Silence{Task: "*", StartsAt: now, EndsAt: now.Add(time.Hour)}
+	for offset, expt := range map[time.Duration]bool{-time.Second: false, 0: true, time.Minute: true, time.Hour: false} {
+		if active := s.Active(now.Add(offset)); active != expt {
+			t.Fatalf("active %v at %v, expect %v", active, offset, expt)
+		}
+	}
+}
+
+func TestSilenceMatch(t *testing.T) {
+	tags := map[string]string{SilenceTagType: "http", SilenceTagKey: "http://metrics.host/api/v1/cpu", "host": "web-1"}
+	cases := []struct {
+		task     string
+		matchers map[string]string
+		matched  bool
+	}{
+		{"", map[string]string{"host": "web-?"}, true},
+		{"cpu_*", nil, true},
+		{"mem_*", nil, false},
+		{"cpu_high", map[string]string{"host": "web-*", SilenceTagType: "http"}, true},
+		{"", map[string]string{SilenceTagKey: "http://metrics.host/*"}, true},
+		{"", map[string]string{SilenceTagKey: "*/v1/*"}, true},
+		{"", map[string]string{SilenceTagKey: "http://metrics.host/*/mem"}, false},
+		// the special characters of the regexp are literal
+		{"", map[string]string{SilenceTagKey: "http://metrics.host/api/v1/c.u"}, false},
+		// the tag is missing
+		{"", map[string]string{"dc": "*"}, false},
+	}
+	for i, c := range cases {
+		s := &Silence{Task: c.task, Matchers: c.matchers}
+		if matched := s.Match("cpu_high", tags); matched != c.matched {
+			t.Fatalf("case %v: matched %v, expect %v", i, matched, c.matched)
+		}
+	}
+}
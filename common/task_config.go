@@ -0,0 +1,149 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// TaskConfig the config of a task, TaskMeta.Config is the JSON of it;
+//  the zero fields are filled with the defaults, see DefaultTaskConfig
+type TaskConfig struct {
+	// days of the training data, 0 means at least 3 days and covers the longest period
+	TrainingDataLength int `json:"training_data_length"`
+
+	// check the latest data every CheckFreqMin minutes; the pushed series are also checked
+	//  when their points arrive, but at most once every CheckFreqMin minutes
+	CheckFreqMin int `json:"check_freq_min"`
+
+	// minutes of the latest data to check, alert if all of them are anomalous
+	CheckDataMin int `json:"check_data_min"`
+
+	// a point is anomalous only if its AnomalyScore reaches SeverityThresholds.Info,
+	//  and it exceeds the interval by both AlertSensitive*|bound| and AlertMinDeviation,
+	//  AlertMinDeviation ignores the tiny deviations of the series with small values
+	AlertSensitive    float64 `json:"alert_sensitive"`
+	AlertMinDeviation float64 `json:"alert_min_deviation"`
+
+	// the anomalies are graded by their AnomalyScore, such as {"info": 0, "warning": 1, "critical": 3}
+	SeverityThresholds SeverityThresholds `json:"severity_thresholds"`
+
+	// an incident fires after AlertPendingChecks consecutive anomalous checks,
+	//  and resolves after AlertResolveChecks consecutive normal checks
+	AlertPendingChecks int `json:"alert_pending_checks"`
+	AlertResolveChecks int `json:"alert_resolve_checks"`
+
+	// max incidents notified per hour of the task, 0 for unlimited
+	AlertRateLimit int `json:"alert_rate_limit"`
+
+	// an incident is not notified within AlertDedupMin minutes after the last incident
+	//  of the same ts is notified, 0 to disable it
+	AlertDedupMin int `json:"alert_dedup_min"`
+
+	// name of the model picker, such as "yahoo_egads" and "holdout"
+	ModelPicker string `json:"model_picker"`
+
+	// pin the model, such as "HoltWinters", Models is ignored if it is set
+	Model string `json:"model"`
+
+	// the candidate models, only DcmpLineModel if empty, the others are opt-in
+	Models []string `json:"models"`
+
+	// [model]params, such as {"HoltWinters": {"alpha": 0.3, "sigma": 4}}
+	ModelParams map[string]map[string]float64 `json:"model_params"`
+
+	// names of the alert sinks configured in the worker, the default sinks if empty
+	AlertSinks []string `json:"alert_sinks"`
+}
+
+// DefaultTaskConfig .
+func DefaultTaskConfig() *TaskConfig {
+	return &TaskConfig{
+		CheckFreqMin:       5,
+		CheckDataMin:       8,
+		AlertSensitive:     0.5,
+		AlertMinDeviation:  10,
+		SeverityThresholds: SeverityThresholds{Warning: 1, Critical: 3},
+		AlertPendingChecks: 1,
+		AlertResolveChecks: 1,
+	}
+}
+
+/*
+ParseTaskConfig .
+	解析TaskMeta.Config, 空字符串返回DefaultTaskConfig;
+	未知的字段, 类型错误和取值不合法都会返回错误, 错误中带有字段名;
+*/
+func ParseTaskConfig(config string) (*TaskConfig, error) {
+	conf := DefaultTaskConfig()
+	if config == "" {
+		return conf, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader([]byte(config)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(conf); err != nil {
+		if e, ok := err.(*json.UnmarshalTypeError); ok {
+			return nil, fmt.Errorf("invalid config field %v: expect %v, got %v", e.Field, e.Type, e.Value)
+		}
+		return nil, fmt.Errorf("invalid config: %v", err)
+	}
+
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// Validate .
+func (c *TaskConfig) Validate() error {
+	if c.TrainingDataLength < 0 || c.TrainingDataLength > 90 {
+		return fmt.Errorf("invalid config field training_data_length: should be in [0, 90], got %v", c.TrainingDataLength)
+	}
+	if c.CheckFreqMin < 1 {
+		return fmt.Errorf("invalid config field check_freq_min: should be at least 1, got %v", c.CheckFreqMin)
+	}
+	if c.CheckDataMin < 1 {
+		return fmt.Errorf("invalid config field check_data_min: should be at least 1, got %v", c.CheckDataMin)
+	}
+	if c.AlertSensitive < 0 {
+		return fmt.Errorf("invalid config field alert_sensitive: should not be negative, got %v", c.AlertSensitive)
+	}
+	if math.IsNaN(c.AlertMinDeviation) || c.AlertMinDeviation < 0 {
+		return fmt.Errorf("invalid config field alert_min_deviation: should not be negative, got %v", c.AlertMinDeviation)
+	}
+	if err := c.SeverityThresholds.Validate(); err != nil {
+		return fmt.Errorf("invalid config field severity_thresholds: %v", err)
+	}
+	for _, m := range c.Models {
+		if m == "" {
+			return fmt.Errorf("invalid config field models: empty model name")
+		}
+	}
+	if c.AlertPendingChecks < 1 {
+		return fmt.Errorf("invalid config field alert_pending_checks: should be at least 1, got %v", c.AlertPendingChecks)
+	}
+	if c.AlertResolveChecks < 1 {
+		return fmt.Errorf("invalid config field alert_resolve_checks: should be at least 1, got %v", c.AlertResolveChecks)
+	}
+	if c.AlertRateLimit < 0 {
+		return fmt.Errorf("invalid config field alert_rate_limit: should not be negative, got %v", c.AlertRateLimit)
+	}
+	if c.AlertDedupMin < 0 {
+		return fmt.Errorf("invalid config field alert_dedup_min: should not be negative, got %v", c.AlertDedupMin)
+	}
+	for _, s := range c.AlertSinks {
+		if s == "" {
+			return fmt.Errorf("invalid config field alert_sinks: empty sink name")
+		}
+	}
+	for m, params := range c.ModelParams {
+		for name, val := range params {
+			if math.IsNaN(val) || val < 0 {
+				return fmt.Errorf("invalid config field model_params.%v.%v: should not be negative, got %v", m, name, val)
+			}
+		}
+	}
+	return nil
+}
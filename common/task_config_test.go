@@ -0,0 +1,74 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTaskConfig(t *testing.T) {
+	conf, err := ParseTaskConfig("")
+	if err != nil || conf.CheckFreqMin != 5 || conf.AlertPendingChecks != 1 {
+		t.Fatalf("unexpected default config %+v, err: %v", conf, err)
+	}
+	conf, err = ParseTaskConfig(`{"check_freq_min": 10, "models": ["HoltWinters"]}`)
+	if err != nil || conf.CheckFreqMin != 10 || conf.CheckDataMin != 8 || len(conf.Models) != 1 {
+		t.Fatalf("unexpected config %+v, err: %v", conf, err)
+	}
+
+	// the errors name the invalid fields
+	cases := []struct {
+		config string
+		err    string
+	}{
+		{`{"check_freq_min": "5"}`, "invalid config field check_freq_min: expect int"},
+		{`{"no_such_field": 1}`, `unknown field "no_such_field"`},
+		{`{"check_freq_min": 5`, "invalid config:"},
+		{`{"training_data_length": 91}`, "invalid config field training_data_length"},
+		{`{"check_freq_min": -1}`, "invalid config field check_freq_min"},
+		{`{"check_data_min": -1}`, "invalid config field check_data_min"},
+		{`{"alert_sensitive": -0.5}`, "invalid config field alert_sensitive"},
+		{`{"alert_min_deviation": -1}`, "invalid config field alert_min_deviation"},
+		{`{"severity_thresholds": {"warning": 3, "critical": 1}}`, "invalid config field severity_thresholds"},
+		{`{"models": [""]}`, "invalid config field models"},
+		{`{"alert_pending_checks": -1}`, "invalid config field alert_pending_checks"},
+		{`{"alert_resolve_checks": -1}`, "invalid config field alert_resolve_checks"},
+		{`{"alert_rate_limit": -1}`, "invalid config field alert_rate_limit"},
+		{`{"alert_dedup_min": -1}`, "invalid config field alert_dedup_min"},
+		{`{"alert_sinks": [""]}`, "invalid config field alert_sinks"},
+		{`{"model_params": {"HoltWinters": {"alpha": -1}}}`, "invalid config field model_params.HoltWinters.alpha"},
+	}
+	for _, c := range cases {
+		if _, err := ParseTaskConfig(c.config); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Fatalf("config %v: err %v, expect %q", c.config, err, c.err)
+		}
+	}
+}
+
+func TestCheckModels(t *testing.T) {
+	cases := []struct {
+		config string
+		err    string
+	}{
+		{`{}`, ""},
+		{`{"model_picker": "holdout", "model": "HoltWinters"}`, ""},
+		{`{"models": ["EWMA", "DcmpLineModel"], "model_params": {"EWMA": {"alpha": 0.3, "sigma": 4}}}`, ""},
+		{`{"model_params": {"DcmpLine": {"sigma": 4}}}`, ""},
+		{`{"model_picker": "best"}`, "invalid config field model_picker"},
+		{`{"model": "NoSuchModel"}`, "invalid config field model"},
+		{`{"models": ["HoltWinters", "NoSuchModel"]}`, "invalid config field models"},
+		{`{"model_params": {"NoSuchModel": {"sigma": 4}}}`, "invalid config field model_params.NoSuchModel"},
+		{`{"model_params": {"LineModel": {"max_bad_per": 1}}}`, "invalid config field model_params.LineModel.max_bad_per"},
+		{`{"model_params": {"HoltWinters": {"no_such_param": 1}}}`, "invalid config field model_params.HoltWinters.no_such_param"},
+		{`{"model_params": {"HoltWinters": {"alpha": 2}}}`, "invalid config field model_params.HoltWinters.alpha"},
+	}
+	for _, c := range cases {
+		conf, err := ParseTaskConfig(c.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = conf.CheckModels()
+		if c.err == "" && err != nil || c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Fatalf("config %v: err %v, expect %q", c.config, err, c.err)
+		}
+	}
+}
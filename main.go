@@ -34,6 +34,9 @@ func main() {
 		}
 	}()
 
+	if len(c.Manager.AlertSinks) == 0 {
+		c.Manager.AlertSinks = worker.AlertSinkNames(&c.Worker)
+	}
 	if err := manager.Start(&c.Manager); err != nil {
 		panic(err)
 	}
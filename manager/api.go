@@ -22,6 +22,10 @@ func UpdateTask(c *gin.Context) {
 		c.String(400, "invalid argument")
 		return
 	}
+	if err := checkTaskConfig(r.Config); err != nil {
+		c.String(400, err.Error())
+		return
+	}
 
 	t, err := GetTaskByName(r.OldName)
 	if err != nil {
@@ -60,6 +64,10 @@ func SubmitTask(c *gin.Context) {
 		c.String(400, "invalid argument")
 		return
 	}
+	if err := checkTaskConfig(meta.Config); err != nil {
+		c.String(400, err.Error())
+		return
+	}
 
 	src, err := json.Marshal(meta.DataSource)
 	if err != nil {
@@ -0,0 +1,97 @@
+package manager
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"code.byted.org/microservice/tsad/common"
+)
+
+const (
+	_DefaultAnomalyLimit = 1000
+	_MaxAnomalyLimit     = 10000
+	_MaxAnomalyRange     = time.Hour * 24 * 31
+)
+
+// parseQueryTime parses a RFC3339 time or unix seconds, def if it is empty
+func parseQueryTime(c *gin.Context, key string, def time.Time) (time.Time, error) {
+	val := c.Query(key)
+	if val == "" {
+		return def, nil
+	}
+	if sec, err := strconv.ParseInt(val, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %v: %v, expect RFC3339 or unix seconds", key, val)
+	}
+	return t, nil
+}
+
+/*
+QueryAnomalies .
+	query the recorded anomalies, the latest first;
+	filters: task, incident_id, begin and end(RFC3339 or unix seconds, default the last day),
+	min_score, min_severity(info, warning or critical), limit(default 1000, at most 10000)
+*/
+func QueryAnomalies(c *gin.Context) {
+	f := &AnomalyFilter{
+		Task:       c.Query("task"),
+		IncidentID: c.Query("incident_id"),
+		Limit:      _DefaultAnomalyLimit,
+	}
+
+	var err error
+	if f.End, err = parseQueryTime(c, "end", time.Now()); err != nil {
+		c.String(400, err.Error())
+		return
+	}
+	if f.Begin, err = parseQueryTime(c, "begin", f.End.Add(-time.Hour*24)); err != nil {
+		c.String(400, err.Error())
+		return
+	}
+	if !f.Begin.Before(f.End) {
+		c.String(400, "begin is not before end")
+		return
+	}
+	if f.End.Sub(f.Begin) > _MaxAnomalyRange {
+		c.String(400, "too large interval to query")
+		return
+	}
+
+	if val := c.Query("min_score"); val != "" {
+		if f.MinScore, err = strconv.ParseFloat(val, 64); err != nil {
+			c.String(400, "invalid min_score: %v", val)
+			return
+		}
+	}
+	if val := c.Query("min_severity"); val != "" {
+		min, err := common.ParseSeverity(val)
+		if err != nil {
+			c.String(400, err.Error())
+			return
+		}
+		for _, sev := range []common.Severity{common.SeverityInfo, common.SeverityWarning, common.SeverityCritical} {
+			if sev.Level() >= min.Level() {
+				f.Severities = append(f.Severities, string(sev))
+			}
+		}
+	}
+	if val := c.Query("limit"); val != "" {
+		if f.Limit, err = strconv.Atoi(val); err != nil || f.Limit <= 0 || f.Limit > _MaxAnomalyLimit {
+			c.String(400, "invalid limit: %v, should be in [1, %v]", val, _MaxAnomalyLimit)
+			return
+		}
+	}
+
+	as, err := GetAnomalies(f)
+	if err != nil {
+		c.String(500, "query anomalies err: %v", err)
+		return
+	}
+	c.JSON(200, as)
+}
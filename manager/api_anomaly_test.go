@@ -0,0 +1,66 @@
+package manager
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryAnomalies(t *testing.T) {
+	stamp := time.Unix(1500000000, 0)
+	anomalies := &fakeTable{
+		cols: []string{"id", "task", "series", "stamp", "observed", "lower", "upper", "score", "severity", "model", "incident_id", "created_at"},
+		rows: [][]driver.Value{
+			{int64(1), "cpu_high", `{"type":"tsdb","key":"cpu"}`, stamp, 100.0, 1.0, 10.0, 10.0, "critical", "DcmpLineModel", "0123456789abcdef", stamp},
+		},
+	}
+	begin, end := stamp.Add(-time.Hour).Unix(), stamp.Add(time.Hour).Unix()
+	cases := []struct {
+		query string
+		code  int
+		stmt  []string // the parts of the statement
+	}{
+		{"", 200, []string{"stamp>=? AND stamp<?", "LIMIT 1000"}},
+		{fmt.Sprintf("?task=cpu_high&begin=%v&end=%v", begin, end), 200, []string{"task=?", "cpu_high"}},
+		{"?begin=2017-07-14T00:00:00Z&end=2017-07-15T00:00:00Z&incident_id=0123456789abcdef", 200, []string{"incident_id=?"}},
+		{"?min_score=3&limit=10", 200, []string{"score>=?", "LIMIT 10"}},
+		{"?min_severity=warning", 200, []string{"severity IN (?,?)", "warning critical]"}},
+		{"?min_severity=critical", 200, []string{"severity IN (?)", "critical]"}},
+		{"?begin=yesterday", 400, nil},
+		{fmt.Sprintf("?begin=%v&end=%v", end, begin), 400, nil},
+		{fmt.Sprintf("?begin=%v&end=%v", begin, stamp.Add(time.Hour*24*32).Unix()), 400, nil},
+		{"?min_score=high", 400, nil},
+		{"?min_severity=fatal", 400, nil},
+		{"?limit=0", 400, nil},
+		{"?limit=10001", 400, nil},
+	}
+	for _, c := range cases {
+		server := useFakeDB(t, map[string]*fakeTable{"tsad_anomalies": anomalies}, 0)
+		w := serve("GET", "/anomalies"+c.query, "", QueryAnomalies)
+		if w.Code != c.code {
+			t.Fatalf("query %v: code %v, expect %v, resp: %v", c.query, w.Code, c.code, w.Body.String())
+		}
+		if c.code != 200 {
+			if server.lastStmt() != "" {
+				t.Fatalf("query %v: unexpected stmt %v", c.query, server.lastStmt())
+			}
+			continue
+		}
+		for _, part := range c.stmt {
+			if !strings.Contains(server.lastStmt(), part) {
+				t.Fatalf("query %v: %q is not in the stmt %v", c.query, part, server.lastStmt())
+			}
+		}
+
+		var results []*Anomaly
+		if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].Severity != "critical" || !results[0].Stamp.Equal(stamp) {
+			t.Fatalf("query %v: unexpected anomalies %v", c.query, w.Body.String())
+		}
+	}
+}
@@ -15,6 +15,16 @@ type TimeSeries struct {
 	LastError      string    `json:"last_error"`
 	LastErrorStamp time.Time `json:"last_error_stamp"`
 	LastDetectedAt time.Time `json:"last_detected_at"`
+
+	// scores of the candidate models given by the model picker, smaller is better
+	ModelScores []ModelScore `json:"model_scores"`
+}
+
+// ModelScore .
+type ModelScore struct {
+	Model string  `json:"model"`
+	Score float64 `json:"score"`
+	Err   string  `json:"error,omitempty"`
 }
 
 // DataSource .
@@ -0,0 +1,112 @@
+package manager
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"code.byted.org/microservice/tsad/common"
+)
+
+func silence2Common(s *Silence) *common.Silence {
+	sl := &common.Silence{
+		ID:        s.ID,
+		Task:      s.Task,
+		StartsAt:  s.StartsAt,
+		EndsAt:    s.EndsAt,
+		CreatedBy: s.CreatedBy,
+		Comment:   s.Comment,
+	}
+	json.Unmarshal([]byte(s.Matchers), &sl.Matchers)
+	return sl
+}
+
+/*
+CreateSilence .
+	silence the incidents of the matched ts until ends_at, or for duration_min minutes;
+	starts_at is now if it is not specified; the workers sync the silences every 30s
+*/
+func CreateSilence(c *gin.Context) {
+	type req struct {
+		common.Silence
+		DurationMin int `json:"duration_min"`
+	}
+	var r req
+	if err := c.BindJSON(&r); err != nil {
+		c.String(400, "invalid argument")
+		return
+	}
+
+	sl := r.Silence
+	if sl.StartsAt.IsZero() {
+		sl.StartsAt = time.Now()
+	}
+	if sl.EndsAt.IsZero() && r.DurationMin > 0 {
+		sl.EndsAt = sl.StartsAt.Add(time.Minute * time.Duration(r.DurationMin))
+	}
+	if err := sl.Validate(); err != nil {
+		c.String(400, err.Error())
+		return
+	}
+	if !sl.EndsAt.After(time.Now()) {
+		c.String(400, "the silence has expired")
+		return
+	}
+
+	matchers, _ := json.Marshal(sl.Matchers)
+	s := &Silence{
+		Task:      sl.Task,
+		Matchers:  string(matchers),
+		StartsAt:  sl.StartsAt,
+		EndsAt:    sl.EndsAt,
+		CreatedBy: sl.CreatedBy,
+		Comment:   sl.Comment,
+		CreatedAt: time.Now(),
+	}
+	if err := InsertSilence(s); err != nil {
+		c.String(500, "insert silence err: %v", err)
+		return
+	}
+
+	c.JSON(200, silence2Common(s))
+}
+
+// QuerySilences returns the silences which haven't expired, or all if all=1
+func QuerySilences(c *gin.Context) {
+	ss, err := GetSilences(c.Query("all") == "1")
+	if err != nil {
+		c.String(500, "query silences err: %v", err)
+		return
+	}
+
+	results := make([]*common.Silence, 0, len(ss))
+	for _, s := range ss {
+		results = append(results, silence2Common(s))
+	}
+	c.JSON(200, results)
+}
+
+// ExpireSilence ends the silence now, 404 if it does not exist or has expired
+func ExpireSilence(c *gin.Context) {
+	type req struct {
+		ID int64 `json:"id"`
+	}
+	var r req
+	if err := c.BindJSON(&r); err != nil {
+		c.String(400, "invalid argument")
+		return
+	}
+
+	found, err := ExpireSilenceByID(r.ID)
+	if err != nil {
+		c.String(500, "expire silence err: %v", err)
+		return
+	}
+	if !found {
+		c.String(404, "no active silence: %v", r.ID)
+		return
+	}
+
+	c.String(200, "ok")
+}
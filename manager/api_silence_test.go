@@ -0,0 +1,238 @@
+package manager
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+
+	"code.byted.org/microservice/tsad/common"
+)
+
+// fakeTable the canned rows returned by any query of the table
+type fakeTable struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+// fakeMySQL serves the statements of the DAL by the canned tables, and records them
+type fakeMySQL struct {
+	lock     sync.Mutex
+	tables   map[string]*fakeTable
+	affected int64 // rows affected by each exec
+	stmts    []string
+}
+
+var (
+	fakeServer     *fakeMySQL
+	fakeServerLock sync.Mutex
+)
+
+type fakeDriver struct{}
+
+type fakeConn struct{}
+
+type fakeTx struct{}
+
+type fakeStmt struct {
+	query string
+}
+
+type fakeResult struct {
+	affected int64
+}
+
+type fakeRows struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) { return fakeConn{}, nil }
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return &fakeStmt{query}, nil }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return fakeTx{}, nil }
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+// record returns the fake server after recording the statement
+func (s *fakeStmt) record(args []driver.Value) *fakeMySQL {
+	fakeServerLock.Lock()
+	server := fakeServer
+	fakeServerLock.Unlock()
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.stmts = append(server.stmts, fmt.Sprintf("%v %v", s.query, args))
+	return server
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	server := s.record(args)
+	return fakeResult{server.affected}, nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	server := s.record(args)
+	for name, t := range server.tables {
+		if strings.Contains(s.query, "`"+name+"`") {
+			return &fakeRows{cols: t.cols, rows: t.rows}, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected query: %v", s.query)
+}
+
+func (r fakeResult) LastInsertId() (int64, error) { return 1, nil }
+func (r fakeResult) RowsAffected() (int64, error) { return r.affected, nil }
+
+func (r *fakeRows) Columns() []string { return r.cols }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func init() {
+	sql.Register("tsad_fake_mysql", fakeDriver{})
+	gin.SetMode(gin.TestMode)
+}
+
+// useFakeDB points dbRead and dbWrite to a fake server with the tables
+func useFakeDB(t *testing.T, tables map[string]*fakeTable, affected int64) *fakeMySQL {
+	server := &fakeMySQL{tables: tables, affected: affected}
+	fakeServerLock.Lock()
+	fakeServer = server
+	fakeServerLock.Unlock()
+
+	sqlDB, err := sql.Open("tsad_fake_mysql", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open("mysql", sqlDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbRead, dbWrite = db, db
+	return server
+}
+
+// lastStmt .
+func (s *fakeMySQL) lastStmt() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.stmts) == 0 {
+		return ""
+	}
+	return s.stmts[len(s.stmts)-1]
+}
+
+// serve the request by the handler
+func serve(method, path, body string, handler gin.HandlerFunc) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.Handle(method, strings.Split(path, "?")[0], handler)
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCreateSilence(t *testing.T) {
+	cases := []struct {
+		body string
+		code int
+	}{
+		{`{"task": "cpu_*", "duration_min": 60}`, 200},
+		{`{"matchers": {"host": "web-*"}, "ends_at": "2100-01-01T00:00:00Z"}`, 200},
+		{`{"task": "cpu_*"`, 400},
+		{`{"duration_min": 60}`, 400},                                             // no task or matchers
+		{`{"task": "cpu_*"}`, 400},                                                // no ends_at
+		{`{"task": "cpu_*", "ends_at": "2000-01-01T00:00:00Z"}`, 400},             // expired
+		{`{"task": "cpu_*", "matchers": {"": "web-*"}, "duration_min": 60}`, 400}, // empty tag
+	}
+	for _, c := range cases {
+		server := useFakeDB(t, nil, 1)
+		w := serve("POST", "/create_silence", c.body, CreateSilence)
+		if w.Code != c.code {
+			t.Fatalf("body %v: code %v, expect %v, resp: %v", c.body, w.Code, c.code, w.Body.String())
+		}
+		if inserted := strings.HasPrefix(server.lastStmt(), "INSERT INTO `tsad_silences`"); inserted != (c.code == 200) {
+			t.Fatalf("body %v: inserted %v, stmt: %v", c.body, inserted, server.lastStmt())
+		}
+	}
+}
+
+func TestQuerySilences(t *testing.T) {
+	now := time.Now()
+	silences := &fakeTable{
+		cols: []string{"id", "task", "matchers", "starts_at", "ends_at", "created_by", "comment", "created_at"},
+		rows: [][]driver.Value{
+			{int64(2), "", `{"host":"web-*"}`, now, now.Add(time.Hour), "alice", "deploying", now},
+		},
+	}
+	cases := []struct {
+		query  string
+		active bool // only the active silences are queried
+	}{
+		{"", true},
+		{"?all=0", true},
+		{"?all=1", false},
+	}
+	for _, c := range cases {
+		server := useFakeDB(t, map[string]*fakeTable{"tsad_silences": silences}, 0)
+		w := serve("GET", "/silences"+c.query, "", QuerySilences)
+		if w.Code != 200 {
+			t.Fatalf("query %v: code %v, resp: %v", c.query, w.Code, w.Body.String())
+		}
+		if active := strings.Contains(server.lastStmt(), "ends_at>?"); active != c.active {
+			t.Fatalf("query %v: stmt %v", c.query, server.lastStmt())
+		}
+
+		var results []*common.Silence
+		if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].ID != 2 || results[0].Matchers["host"] != "web-*" || results[0].CreatedBy != "alice" {
+			t.Fatalf("query %v: unexpected silences %v", c.query, w.Body.String())
+		}
+	}
+}
+
+func TestExpireSilence(t *testing.T) {
+	cases := []struct {
+		body     string
+		affected int64
+		code     int
+	}{
+		{`{"id": 2}`, 1, 200},
+		{`{"id": 3}`, 0, 404}, // not found or expired
+		{`{"id": "2"}`, 1, 400},
+	}
+	for _, c := range cases {
+		server := useFakeDB(t, nil, c.affected)
+		w := serve("POST", "/expire_silence", c.body, ExpireSilence)
+		if w.Code != c.code {
+			t.Fatalf("body %v: code %v, expect %v, resp: %v", c.body, w.Code, c.code, w.Body.String())
+		}
+		if c.code != 400 && !strings.HasPrefix(server.lastStmt(), "UPDATE `tsad_silences` SET `ends_at`") {
+			t.Fatalf("body %v: unexpected stmt %v", c.body, server.lastStmt())
+		}
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"time"
+
+	"code.byted.org/microservice/tsad/common"
 )
 
 var (
@@ -15,6 +17,39 @@ var (
 	}
 )
 
+// checkTaskConfig check the config of a task before it is stored,
+//  the error explains which field is wrong
+func checkTaskConfig(raw string) error {
+	c, err := common.ParseTaskConfig(raw)
+	if err != nil {
+		return err
+	}
+	if err := c.CheckModels(); err != nil {
+		return err
+	}
+	return checkAlertSinks(c.AlertSinks, config.AlertSinks)
+}
+
+// checkAlertSinks sinks should be in known, known is empty if they are not checked
+func checkAlertSinks(sinks, known []string) error {
+	if len(known) == 0 {
+		return nil
+	}
+	for _, s := range sinks {
+		found := false
+		for _, k := range known {
+			if s == k {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("invalid config field alert_sinks: unknown sink %v, expect one of %v", s, known)
+		}
+	}
+	return nil
+}
+
 func leftShift30s(t time.Time) time.Time {
 	unix := t.Unix()
 	unix -= (unix % 30)
@@ -0,0 +1,51 @@
+package manager
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckAlertSinks(t *testing.T) {
+	known := []string{"msbackend", "oncall", "stdout"}
+	cases := []struct {
+		sinks []string
+		known []string
+		ok    bool
+	}{
+		{nil, known, true},
+		{[]string{"oncall", "stdout"}, known, true},
+		{[]string{"oncall", "pager"}, known, false},
+		// not checked
+		{[]string{"pager"}, nil, true},
+	}
+	for i, c := range cases {
+		if err := checkAlertSinks(c.sinks, c.known); (err == nil) != c.ok {
+			t.Fatalf("case %v: err %v, expect ok %v", i, err, c.ok)
+		}
+	}
+}
+
+func TestCheckTaskConfig(t *testing.T) {
+	config = &Config{AlertSinks: []string{"msbackend", "stdout"}}
+	defer func() { config = nil }()
+
+	cases := []struct {
+		config string
+		field  string // named in the error, empty if it is valid
+	}{
+		{``, ""},
+		{`{"model_picker": "holdout", "models": ["HoltWinters", "EWMA"], "alert_sinks": ["stdout"]}`, ""},
+		{`{"check_freq_min": 0}`, "check_freq_min"},
+		{`{"model_picker": "best"}`, "model_picker"},
+		{`{"model": "NoSuchModel"}`, "model"},
+		{`{"models": ["NoSuchModel"]}`, "models"},
+		{`{"model_params": {"HoltWinters": {"no_such_param": 1}}}`, "model_params.HoltWinters.no_such_param"},
+		{`{"alert_sinks": ["pager"]}`, "alert_sinks"},
+	}
+	for _, c := range cases {
+		err := checkTaskConfig(c.config)
+		if c.field == "" && err != nil || c.field != "" && (err == nil || !strings.Contains(err.Error(), "invalid config field "+c.field+":")) {
+			t.Fatalf("config %v: err %v, expect field %q", c.config, err, c.field)
+		}
+	}
+}
@@ -14,4 +14,8 @@ type Config struct {
 
 	// config for dist locker
 	MysqlLocklDSN string `yaml:"MysqlLocklDSN"`
+
+	// the names of the alert sinks accepted in alert_sinks of the task configs,
+	//  filled with the sinks of the worker if it is empty
+	AlertSinks []string `yaml:"AlertSinks"`
 }
@@ -26,6 +26,8 @@ func initDAL() error {
 
 	dbWrite.AutoMigrate(&Task{})
 	dbWrite.AutoMigrate(&Detector{})
+	dbWrite.AutoMigrate(&Silence{})
+	dbWrite.AutoMigrate(&Anomaly{})
 	return nil
 }
 
@@ -77,3 +79,56 @@ func GetDetectors() ([]*Detector, error) {
 func UpsertDetector(d *Detector) error {
 	return dbWrite.Save(d).Error
 }
+
+// InsertSilence .
+func InsertSilence(s *Silence) error {
+	return dbWrite.Create(s).Error
+}
+
+// GetSilences returns the silences which haven't expired, or all if all is true
+func GetSilences(all bool) ([]*Silence, error) {
+	var ss []*Silence
+	q := dbRead.Order("id desc")
+	if !all {
+		q = q.Where("ends_at>?", time.Now())
+	}
+	err := q.Find(&ss).Error
+	return ss, err
+}
+
+// ExpireSilenceByID returns false if the silence does not exist or has expired
+func ExpireSilenceByID(id int64) (bool, error) {
+	db := dbWrite.Model(&Silence{}).Where("id=? AND ends_at>?", id, time.Now()).UpdateColumn("ends_at", time.Now())
+	return db.RowsAffected > 0, db.Error
+}
+
+// AnomalyFilter .
+type AnomalyFilter struct {
+	Task       string
+	IncidentID string
+	Begin      time.Time
+	End        time.Time
+	MinScore   float64
+	Severities []string // any of them, all if empty
+	Limit      int
+}
+
+// GetAnomalies returns the latest anomalies matching the filter
+func GetAnomalies(f *AnomalyFilter) ([]*Anomaly, error) {
+	q := dbRead.Where("stamp>=? AND stamp<?", f.Begin, f.End)
+	if f.Task != "" {
+		q = q.Where("task=?", f.Task)
+	}
+	if f.IncidentID != "" {
+		q = q.Where("incident_id=?", f.IncidentID)
+	}
+	if f.MinScore > 0 {
+		q = q.Where("score>=?", f.MinScore)
+	}
+	if len(f.Severities) > 0 {
+		q = q.Where("severity IN (?)", f.Severities)
+	}
+	var as []*Anomaly
+	err := q.Order("stamp desc").Limit(f.Limit).Find(&as).Error
+	return as, err
+}
@@ -35,3 +35,41 @@ type Detector struct {
 func (d Detector) TableName() string {
 	return "tsad_detectors"
 }
+
+// Silence .
+type Silence struct {
+	ID        int64  `gorm:"primary_key;AUTO_INCREMENT"`
+	Task      string // glob of the task name
+	Matchers  string // JSON of the tag globs
+	StartsAt  time.Time
+	EndsAt    time.Time
+	CreatedBy string
+	Comment   string
+	CreatedAt time.Time
+}
+
+// TableName .
+func (s Silence) TableName() string {
+	return "tsad_silences"
+}
+
+// Anomaly .
+type Anomaly struct {
+	ID         int64     `json:"id" gorm:"primary_key;AUTO_INCREMENT"`
+	Task       string    `json:"task"`
+	Series     string    `json:"series"` // JSON of the DataSource of the ts
+	Stamp      time.Time `json:"stamp"`
+	Observed   float64   `json:"observed"`
+	Lower      float64   `json:"lower"`
+	Upper      float64   `json:"upper"`
+	Score      float64   `json:"score"`
+	Severity   string    `json:"severity"`
+	Model      string    `json:"model"`
+	IncidentID string    `json:"incident_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// TableName .
+func (a Anomaly) TableName() string {
+	return "tsad_anomalies"
+}
@@ -52,6 +52,10 @@ func Start(c *Config) error {
 	tsadAPI.POST("start_task", StartTask)
 	tsadAPI.POST("retrain_task", RetrainTask)
 	tsadAPI.GET("summary", Summary)
+	tsadAPI.POST("create_silence", CreateSilence)
+	tsadAPI.GET("silences", QuerySilences)
+	tsadAPI.POST("expire_silence", ExpireSilence)
+	tsadAPI.GET("anomalies", QueryAnomalies)
 
 	go func() {
 		err := g.Run(fmt.Sprintf("0.0.0.0:%v", config.ManagerPort))
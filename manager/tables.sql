@@ -38,4 +38,36 @@ CREATE TABLE `tsad_points` (
     `points` TEXT,
 
     UNIQUE INDEX uniq_key (`src_key`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `tsad_silences` (
+    `id` bigint primary key AUTO_INCREMENT,
+    `task` varchar(255),
+    `matchers` text,
+    `starts_at` timestamp NULL DEFAULT '2000-01-01 00:00:00',
+    `ends_at` timestamp NULL DEFAULT '2000-01-01 00:00:00',
+    `created_by` varchar(255),
+    `comment` text,
+    `created_at` timestamp NULL DEFAULT '2000-01-01 00:00:00',
+
+    INDEX idx_ends_at (`ends_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `tsad_anomalies` (
+    `id` bigint primary key AUTO_INCREMENT,
+    `task` varchar(125),
+    `series` text,
+    `stamp` timestamp NULL DEFAULT '2000-01-01 00:00:00',
+    `observed` double,
+    `lower` double,
+    `upper` double,
+    `score` double,
+    `severity` varchar(16),
+    `model` varchar(100),
+    `incident_id` varchar(32),
+    `created_at` timestamp NULL DEFAULT '2000-01-01 00:00:00',
+
+    INDEX idx_task_stamp (`task`, `stamp`),
+    INDEX idx_stamp (`stamp`),
+    INDEX idx_incident (`incident_id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
\ No newline at end of file
@@ -224,6 +224,7 @@ func SubmitTasksToDetector(d *Detector, ts []*Task) error {
 		metas = append(metas, TaskMeta{
 			Name:       t.Name,
 			DataSource: src,
+			Config:     t.Config,
 		})
 	}
 
@@ -0,0 +1,191 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"code.byted.org/microservice/tsad/common"
+	"code.byted.org/microservice/tsad/worker/alertsink"
+	"code.byted.org/microservice/tsad/worker/detector"
+)
+
+const (
+	alertSinkMSBackend  = "msbackend"
+	alertSinkStdout     = "stdout"
+	alertSendTimeout    = time.Second * 30
+	defaultAlertAddress = "http://ms.byted.org/msbackend/api/alarm/gen_alarm"
+
+	silenceSyncInterval = time.Second * 30
+)
+
+var (
+	alertSinks *alertsink.Sinks
+
+	silences     []*common.Silence // the active silences synced from mysql
+	silencesLock sync.RWMutex
+)
+
+// alertSinkConfs the sinks in c.AlertSinks override the builtin ones with the same name
+func alertSinkConfs(c *Config) []alertsink.Config {
+	address := c.AlertAddress
+	if address == "" {
+		address = defaultAlertAddress
+	}
+	confs := []alertsink.Config{
+		{Name: alertSinkStdout, Type: alertsink.TypeFile, URL: "stdout"},
+		{Name: alertSinkMSBackend, Type: alertsink.TypeMSBackend, URL: address},
+	}
+	for _, sc := range c.AlertSinks {
+		for i := range confs {
+			if confs[i].Name == sc.Name {
+				confs = append(confs[:i], confs[i+1:]...)
+				break
+			}
+		}
+		confs = append(confs, sc)
+	}
+	return confs
+}
+
+// AlertSinkNames the names of the sinks configured by c, the manager checks the alert_sinks of the tasks by them
+func AlertSinkNames(c *Config) []string {
+	confs := alertSinkConfs(c)
+	names := make([]string, 0, len(confs))
+	for _, sc := range confs {
+		names = append(names, sc.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func initAlertSinks() error {
+	confs := alertSinkConfs(config)
+	defaults := config.DefaultAlertSinks
+	if len(defaults) == 0 {
+		defaults = []string{alertSinkMSBackend}
+	}
+
+	sinks, err := alertsink.NewSinks(confs, defaults)
+	if err != nil {
+		return fmt.Errorf("init alert sinks err: %v", err)
+	}
+	alertSinks = sinks
+	logger.Infof("alert sinks %v are initialized, default: %v", sinks.Names(), defaults)
+	return nil
+}
+
+// Alert sends the firing or resolved incident to the sinks of the task asynchronously
+func Alert(t *detector.Task, ts *detector.TimeSeries, ev *detector.AlertEvent) {
+	src, _ := json.Marshal(ts.DataSource)
+	alert := &alertsink.Alert{
+		Task:       ts.TaskName,
+		DataSource: string(src),
+		IncidentID: ev.IncidentID,
+		State:      string(ev.State),
+		StartsAt:   ev.StartsAt,
+		EndsAt:     ev.EndsAt,
+		Severity:   string(ev.Severity),
+		Score:      ev.Score,
+		Escalated:  ev.Escalated,
+		Stamp:      ev.Observed.Stamp(),
+		Observed:   ev.Observed.Value(),
+		Lower:      ev.Lower,
+		Upper:      ev.Upper,
+	}
+	buf, _ := json.Marshal(alert)
+	logger.Infof(">>>>> alert %v", string(buf))
+
+	var sinks []string
+	if t.Configs != nil {
+		sinks = t.Configs.AlertSinks
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), alertSendTimeout)
+		defer cancel()
+		if err := alertSinks.Send(ctx, sinks, alert); err != nil {
+			logger.Errorf("send alert of task %v err: %v", t.Name, err)
+		}
+	}()
+}
+
+// startSilenceSyncer syncs the active silences created by the manager periodically,
+//  the incidents are not silenced until the first successful sync
+func startSilenceSyncer() {
+	if err := syncSilences(); err != nil {
+		logger.Errorf("sync silences err: %v", err)
+	}
+	go func() {
+		for range time.Tick(silenceSyncInterval) {
+			if err := syncSilences(); err != nil {
+				logger.Errorf("sync silences err: %v", err)
+			}
+		}
+	}()
+}
+
+func syncSilences() error {
+	ss, err := QueryActiveSilences(time.Now())
+	if err != nil {
+		return fmt.Errorf("QueryActiveSilences err: %v", err)
+	}
+
+	active := make([]*common.Silence, 0, len(ss))
+	for _, s := range ss {
+		sl := &common.Silence{
+			ID:        s.ID,
+			Task:      s.Task,
+			StartsAt:  s.StartsAt,
+			EndsAt:    s.EndsAt,
+			CreatedBy: s.CreatedBy,
+			Comment:   s.Comment,
+		}
+		if s.Matchers != "" {
+			if err := json.Unmarshal([]byte(s.Matchers), &sl.Matchers); err != nil {
+				logger.Errorf("invalid matchers of silence %v: %v, err: %v", s.ID, s.Matchers, err)
+				continue
+			}
+		}
+		active = append(active, sl)
+	}
+
+	silencesLock.Lock()
+	silences = active
+	silencesLock.Unlock()
+	return nil
+}
+
+// Silences .
+func Silences() []*common.Silence {
+	silencesLock.RLock()
+	defer silencesLock.RUnlock()
+	return silences
+}
+
+// RecordAnomaly stores the anomalies into mysql for the post-mortems
+func RecordAnomaly(t *detector.Task, ts *detector.TimeSeries, anomalies []*detector.Anomaly) error {
+	series := ts.DataSource.JSON()
+	as := make([]*Anomaly, 0, len(anomalies))
+	for _, a := range anomalies {
+		as = append(as, &Anomaly{
+			Task:       ts.TaskName,
+			Series:     series,
+			Stamp:      a.Stamp,
+			Observed:   a.Observed,
+			Lower:      a.Lower,
+			Upper:      a.Upper,
+			Score:      a.Score,
+			Severity:   string(a.Severity),
+			Model:      a.Model,
+			IncidentID: a.IncidentID,
+			CreatedAt:  time.Now(),
+		})
+	}
+	if err := InsertAnomalies(as); err != nil {
+		return fmt.Errorf("InsertAnomalies err: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package alertsink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"code.byted.org/gopkg/logs"
+	"code.byted.org/microservice/tsad/common"
+)
+
+// the types of the sinks
+const (
+	TypeWebhook   = "webhook"   // POST the JSON of Alert to URL
+	TypeSlack     = "slack"     // POST {"text": ...} to a Slack-compatible incoming webhook URL
+	TypeSMTP      = "smtp"      // send an email by the SMTP server URL (host:port)
+	TypeFile      = "file"      // append the JSON of Alert to the file URL, stdout or stderr
+	TypeMSBackend = "msbackend" // generate an alarm of msbackend, the task name is the rule id
+)
+
+// the states of Alert
+const (
+	StateFiring   = "firing"
+	StateResolved = "resolved"
+)
+
+// Alert an incident of a task, it is sent when the incident fires and resolves
+type Alert struct {
+	Task       string    `json:"name"`
+	DataSource string    `json:"data_source"`
+	IncidentID string    `json:"incident_id"`
+	State      string    `json:"state"` // firing or resolved
+	StartsAt   time.Time `json:"starts_at"`
+	EndsAt     time.Time `json:"ends_at"`  // zero if firing
+	Severity   string    `json:"severity"` // info, warning or critical
+	Score      float64   `json:"score"`    // the normalized deviation of the check which has the severity
+	Escalated  bool      `json:"escalated"`
+
+	// the latest anomalous point
+	Stamp    time.Time `json:"stamp"`
+	Observed float64   `json:"observed"`
+	Lower    float64   `json:"lower"`
+	Upper    float64   `json:"upper"`
+}
+
+// Resolved .
+func (a *Alert) Resolved() bool {
+	return a.State == StateResolved
+}
+
+// Title .
+func (a *Alert) Title() string {
+	if a.Resolved() {
+		return fmt.Sprintf("tsad resolved: %v", a.Task)
+	}
+	if a.Escalated {
+		return fmt.Sprintf("tsad %v alert escalated: %v", a.Severity, a.Task)
+	}
+	return fmt.Sprintf("tsad %v alert: %v", a.Severity, a.Task)
+}
+
+// Text .
+func (a *Alert) Text() string {
+	if a.Resolved() {
+		return fmt.Sprintf("tsad resolved: task %v, data source %v, incident %v lasted from %v to %v, severity %v",
+			a.Task, a.DataSource, a.IncidentID, a.StartsAt.Format(time.RFC3339), a.EndsAt.Format(time.RFC3339), a.Severity)
+	}
+	return fmt.Sprintf("tsad %v alert: task %v, data source %v, incident %v since %v, observed %v at %v, expected in [%v, %v], score %.2f",
+		a.Severity, a.Task, a.DataSource, a.IncidentID, a.StartsAt.Format(time.RFC3339), a.Observed, a.Stamp.Format(time.RFC3339), a.Lower, a.Upper, a.Score)
+}
+
+// Sink .
+type Sink interface {
+	Send(ctx context.Context, a *Alert) error
+}
+
+/*
+Config 一个sink的配置;
+	URL的含义由Type决定, 见TypeWebhook等;
+	Options为各类型特有的配置:
+		webhook: header.<name>为请求的header;
+		smtp: from, to(以逗号分隔), username, password;
+		msbackend: sender, 默认为tsad;
+*/
+type Config struct {
+	Name    string            `yaml:"Name"`
+	Type    string            `yaml:"Type"`
+	URL     string            `yaml:"URL"`
+	Timeout time.Duration     `yaml:"Timeout"` // milliseconds, default 5s
+	Options map[string]string `yaml:"Options"`
+
+	// the sink only receives the incidents at least as severe as it, all if empty
+	MinSeverity string `yaml:"MinSeverity"`
+}
+
+// New .
+func New(conf Config) (Sink, error) {
+	if conf.URL == "" {
+		return nil, fmt.Errorf("the URL of sink %v can not be null", conf.Name)
+	}
+	timeout := conf.Timeout * time.Millisecond
+	if timeout == 0 {
+		timeout = time.Second * 5
+	}
+	client := &http.Client{Timeout: timeout}
+
+	switch conf.Type {
+	case TypeWebhook:
+		headers := make(map[string]string)
+		for k, v := range conf.Options {
+			if strings.HasPrefix(k, "header.") {
+				headers[strings.TrimPrefix(k, "header.")] = v
+			}
+		}
+		return &webhookSink{client: client, url: conf.URL, headers: headers}, nil
+	case TypeSlack:
+		return &slackSink{client: client, url: conf.URL}, nil
+	case TypeSMTP:
+		return newSMTPSink(conf.URL, conf.Options)
+	case TypeFile:
+		return newFileSink(conf.URL)
+	case TypeMSBackend:
+		sender := conf.Options["sender"]
+		if sender == "" {
+			sender = "tsad"
+		}
+		return &msbackendSink{client: client, url: conf.URL, sender: sender}, nil
+	}
+	return nil, fmt.Errorf("unknown sink type: %v", conf.Type)
+}
+
+// postJSON .
+func postJSON(ctx context.Context, client *http.Client, url string, body interface{}, headers map[string]string) error {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("post %v err: %v", url, err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("post %v err: %v, status: %v", url, strings.TrimSpace(string(respBody)), resp.StatusCode)
+	}
+	return nil
+}
+
+/*
+Sinks 按名字管理的一组sink;
+	defaults为task没有指定sink时使用的sink;
+*/
+type Sinks struct {
+	sinks    map[string]Sink
+	levels   map[string]int // the min severity levels of the sinks
+	defaults []string
+}
+
+// NewSinks .
+func NewSinks(confs []Config, defaults []string) (*Sinks, error) {
+	sinks := make(map[string]Sink, len(confs))
+	levels := make(map[string]int, len(confs))
+	for _, c := range confs {
+		if c.Name == "" {
+			return nil, fmt.Errorf("the name of the %v sink can not be null", c.Type)
+		}
+		if _, ok := sinks[c.Name]; ok {
+			return nil, fmt.Errorf("duplicate sink name: %v", c.Name)
+		}
+		s, err := New(c)
+		if err != nil {
+			return nil, fmt.Errorf("create sink %v err: %v", c.Name, err)
+		}
+		sinks[c.Name] = s
+		if c.MinSeverity != "" {
+			sev, err := common.ParseSeverity(c.MinSeverity)
+			if err != nil {
+				return nil, fmt.Errorf("invalid min severity of sink %v: %v", c.Name, err)
+			}
+			levels[c.Name] = sev.Level()
+		}
+	}
+	for _, name := range defaults {
+		if _, ok := sinks[name]; !ok {
+			return nil, fmt.Errorf("unknown default sink: %v", name)
+		}
+	}
+	return &Sinks{sinks: sinks, levels: levels, defaults: defaults}, nil
+}
+
+// Names 返回所有sink的名字, 已排序
+func (ss *Sinks) Names() []string {
+	names := make([]string, 0, len(ss.sinks))
+	for name := range ss.sinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Send 并发发送到names中的每个sink, names为空时发送到默认的sink; 跳过MinSeverity高于a的sink; 返回第一个错误
+func (ss *Sinks) Send(ctx context.Context, names []string, a *Alert) error {
+	if len(names) == 0 {
+		names = ss.defaults
+	}
+
+	// the unknown sinks are checked before the goroutines which append errs
+	var (
+		wg    sync.WaitGroup
+		lock  sync.Mutex
+		errs  []error
+		known []string
+	)
+	for _, name := range names {
+		if _, ok := ss.sinks[name]; ok {
+			known = append(known, name)
+		} else {
+			errs = append(errs, fmt.Errorf("unknown sink: %v", name))
+		}
+	}
+	for _, name := range known {
+		s := ss.sinks[name]
+		if common.Severity(a.Severity).Level() < ss.levels[name] {
+			continue
+		}
+		wg.Add(1)
+		go func(name string, s Sink) {
+			defer wg.Done()
+			if err := s.Send(ctx, a); err != nil {
+				logs.Errorf("[Sinks] send alert of %v to %v err: %v", a.Task, name, err)
+				lock.Lock()
+				errs = append(errs, fmt.Errorf("send to %v err: %v", name, err))
+				lock.Unlock()
+			}
+		}(name, s)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
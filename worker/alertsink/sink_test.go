@@ -0,0 +1,203 @@
+package alertsink
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testAlert(task string) *Alert {
+	return &Alert{
+		Task:       task,
+		DataSource: `{"type":"tsdb","key":"cpu"}`,
+		IncidentID: "0123456789abcdef",
+		State:      StateFiring,
+		Severity:   "warning",
+		Score:      10,
+		StartsAt:   time.Unix(1499999700, 0),
+		Stamp:      time.Unix(1500000000, 0),
+		Observed:   100,
+		Lower:      1,
+		Upper:      10,
+	}
+}
+
+type recorder struct {
+	lock   sync.Mutex
+	bodies map[string][]byte
+	header http.Header
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.bodies[req.URL.Path] = body
+	r.header = req.Header
+	if req.URL.Path == "/fail" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}
+}
+
+func TestSinks(t *testing.T) {
+	rec := &recorder{bodies: make(map[string][]byte)}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "tsad_alert_sink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "alerts.log")
+
+	confs := []Config{
+		{Name: "hook", Type: TypeWebhook, URL: server.URL + "/hook", Options: map[string]string{"header.X-Token": "abc"}},
+		{Name: "slack", Type: TypeSlack, URL: server.URL + "/slack"},
+		{Name: "ms", Type: TypeMSBackend, URL: server.URL + "/ms"},
+		{Name: "fail", Type: TypeWebhook, URL: server.URL + "/fail"},
+		{Name: "file", Type: TypeFile, URL: path},
+		{Name: "pager", Type: TypeWebhook, URL: server.URL + "/pager", MinSeverity: "critical"},
+	}
+	sinks, err := NewSinks(confs, []string{"file"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sinks.Send(context.Background(), []string{"hook", "slack", "ms"}, testAlert("123")); err != nil {
+		t.Fatal(err)
+	}
+	var alert Alert
+	if err := json.Unmarshal(rec.bodies["/hook"], &alert); err != nil || alert.Task != "123" || alert.Observed != 100 {
+		t.Fatalf("webhook got %s, err: %v", rec.bodies["/hook"], err)
+	}
+	var slack map[string]string
+	if err := json.Unmarshal(rec.bodies["/slack"], &slack); err != nil || !strings.Contains(slack["text"], "task 123") {
+		t.Fatalf("slack got %s, err: %v", rec.bodies["/slack"], err)
+	}
+	var ms MSAlert
+	if err := json.Unmarshal(rec.bodies["/ms"], &ms); err != nil || ms.RuleID != 123 || ms.Vars["observe"] != "100" {
+		t.Fatalf("msbackend got %s, err: %v", rec.bodies["/ms"], err)
+	}
+
+	// the resolved notification of the incident
+	resolved := testAlert("123")
+	resolved.State, resolved.EndsAt = StateResolved, time.Unix(1500000600, 0)
+	if err := sinks.Send(context.Background(), []string{"hook", "slack", "ms"}, resolved); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(rec.bodies["/hook"], &alert); err != nil || alert.State != StateResolved || alert.IncidentID != "0123456789abcdef" {
+		t.Fatalf("webhook got %s, err: %v", rec.bodies["/hook"], err)
+	}
+	json.Unmarshal(rec.bodies["/slack"], &slack)
+	if !strings.HasPrefix(slack["text"], "tsad resolved: task 123") {
+		t.Fatalf("slack got %v", slack["text"])
+	}
+	json.Unmarshal(rec.bodies["/ms"], &ms)
+	if ms.Vars["state"] != StateResolved || ms.Vars["incident_id"] != "0123456789abcdef" {
+		t.Fatalf("msbackend got %s", rec.bodies["/ms"])
+	}
+
+	// the sink with MinSeverity only receives the severe incidents
+	if err := sinks.Send(context.Background(), []string{"pager"}, testAlert("123")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec.bodies["/pager"]; ok {
+		t.Fatal("the warning alert is sent to the critical sink")
+	}
+	critical := testAlert("123")
+	critical.Severity, critical.Escalated = "critical", true
+	if err := sinks.Send(context.Background(), []string{"pager"}, critical); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(rec.bodies["/pager"], &alert); err != nil || alert.Severity != "critical" || !alert.Escalated {
+		t.Fatalf("pager got %s, err: %v", rec.bodies["/pager"], err)
+	}
+
+	// msbackend only accepts numeric task names, the other sinks are not affected
+	if err := sinks.Send(context.Background(), []string{"ms", "hook"}, testAlert("cpu-high")); err == nil {
+		t.Fatal("expect error for non-numeric task name")
+	}
+	if err := json.Unmarshal(rec.bodies["/hook"], &alert); err != nil || alert.Task != "cpu-high" {
+		t.Fatalf("webhook got %s, err: %v", rec.bodies["/hook"], err)
+	}
+
+	if err := sinks.Send(context.Background(), []string{"fail"}, testAlert("1")); err == nil {
+		t.Fatal("expect error for the failed webhook")
+	}
+	if err := sinks.Send(context.Background(), []string{"unknown"}, testAlert("1")); err == nil {
+		t.Fatal("expect error for unknown sink")
+	}
+
+	// the default sinks
+	for i := 0; i < 2; i++ {
+		if err := sinks.Send(context.Background(), nil, testAlert("file")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf, _ := ioutil.ReadFile(path)
+	lines := strings.Split(strings.TrimSpace(string(buf)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("file got %q", buf)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &alert); err != nil || alert.Task != "file" {
+		t.Fatalf("file got %v, err: %v", lines[1], err)
+	}
+}
+
+func TestNewSinks(t *testing.T) {
+	invalid := [][]Config{
+		{{Type: TypeWebhook, URL: "http://a"}},
+		{{Name: "a", Type: TypeWebhook, URL: "http://a"}, {Name: "a", Type: TypeSlack, URL: "http://b"}},
+		{{Name: "a", Type: "pager", URL: "http://a"}},
+		{{Name: "a", Type: TypeWebhook}},
+		{{Name: "a", Type: TypeSMTP, URL: "smtp.example.com", Options: map[string]string{"from": "a@b", "to": "c@d"}}},
+		{{Name: "a", Type: TypeSMTP, URL: "smtp.example.com:25", Options: map[string]string{"from": "a@b"}}},
+		{{Name: "a", Type: TypeWebhook, URL: "http://a", MinSeverity: "fatal"}},
+	}
+	for i, confs := range invalid {
+		if _, err := NewSinks(confs, nil); err == nil {
+			t.Fatalf("case %v: expect error", i)
+		}
+	}
+	if _, err := NewSinks(nil, []string{"a"}); err == nil {
+		t.Fatal("expect error for unknown default sink")
+	}
+
+	s, err := New(Config{Name: "mail", Type: TypeSMTP, URL: "smtp.example.com:25",
+		Options: map[string]string{"from": "tsad@example.com", "to": "a@example.com, b@example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(s.(*smtpSink).message(testAlert("42")))
+	for _, expt := range []string{"To: a@example.com, b@example.com\r\n", "Subject: tsad warning alert: 42\r\n", "observed 100", "score 10.00"} {
+		if !strings.Contains(msg, expt) {
+			t.Fatalf("%q is not in the message: %q", expt, msg)
+		}
+	}
+}
+
+func TestSMTPSubject(t *testing.T) {
+	s, err := New(Config{Name: "mail", Type: TypeSMTP, URL: "smtp.example.com:25",
+		Options: map[string]string{"from": "tsad@example.com", "to": "a@example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the CR/LF in the task name can not inject headers
+	msg := string(s.(*smtpSink).message(testAlert("42\r\nBcc: evil@example.com")))
+	header := msg[:strings.Index(msg, "\r\n\r\n")]
+	if strings.Contains(header, "\r\nBcc:") {
+		t.Fatalf("the header is injected: %q", msg)
+	}
+	if !strings.Contains(msg, "Subject: =?utf-8?q?") {
+		t.Fatalf("the subject is not encoded: %q", msg)
+	}
+}
@@ -0,0 +1,169 @@
+package alertsink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// webhookSink .
+type webhookSink struct {
+	client  *http.Client
+	url     string
+	headers map[string]string
+}
+
+// Send .
+func (s *webhookSink) Send(ctx context.Context, a *Alert) error {
+	return postJSON(ctx, s.client, s.url, a, s.headers)
+}
+
+// slackSink .
+type slackSink struct {
+	client *http.Client
+	url    string
+}
+
+// Send .
+func (s *slackSink) Send(ctx context.Context, a *Alert) error {
+	return postJSON(ctx, s.client, s.url, map[string]string{"text": a.Text()}, nil)
+}
+
+// smtpSink .
+type smtpSink struct {
+	addr string
+	from string
+	to   []string
+	auth smtp.Auth
+}
+
+func newSMTPSink(addr string, options map[string]string) (*smtpSink, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid smtp address %v err: %v", addr, err)
+	}
+	s := &smtpSink{addr: addr, from: options["from"]}
+	if s.from == "" {
+		return nil, fmt.Errorf("the from of the smtp sink can not be null")
+	}
+	for _, to := range strings.Split(options["to"], ",") {
+		if to = strings.TrimSpace(to); to != "" {
+			s.to = append(s.to, to)
+		}
+	}
+	if len(s.to) == 0 {
+		return nil, fmt.Errorf("the to of the smtp sink can not be null")
+	}
+	if options["username"] != "" {
+		s.auth = smtp.PlainAuth("", options["username"], options["password"], host)
+	}
+	return s, nil
+}
+
+// message .
+func (s *smtpSink) message(a *Alert) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + s.from + "\r\n")
+	b.WriteString("To: " + strings.Join(s.to, ", ") + "\r\n")
+	// the title contains the task name, it is encoded so the CR/LF in it can not inject headers
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", a.Title()) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(a.Text() + "\r\n")
+	return []byte(b.String())
+}
+
+// Send smtp.SendMail不支持ctx, 超时由SMTP服务器决定
+func (s *smtpSink) Send(ctx context.Context, a *Alert) error {
+	if err := smtp.SendMail(s.addr, s.auth, s.from, s.to, s.message(a)); err != nil {
+		return fmt.Errorf("send mail by %v err: %v", s.addr, err)
+	}
+	return nil
+}
+
+// fileSink 每个alert写入一行JSON
+type fileSink struct {
+	lock sync.Mutex
+	f    *os.File
+}
+
+func newFileSink(path string) (*fileSink, error) {
+	switch path {
+	case "stdout", "-":
+		return &fileSink{f: os.Stdout}, nil
+	case "stderr":
+		return &fileSink{f: os.Stderr}, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open %v err: %v", path, err)
+	}
+	return &fileSink{f: f}, nil
+}
+
+// Send .
+func (s *fileSink) Send(ctx context.Context, a *Alert) error {
+	buf, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, err = s.f.Write(append(buf, '\n'))
+	return err
+}
+
+// MSAlert .
+type MSAlert struct {
+	RuleID uint   `json:"rule_id"`
+	Sender string `json:"sender"`
+
+	Content    string            `json:"content"`
+	Vars       map[string]string `json:"vars"`
+	Tags       map[string]string `json:"tags"`
+	Metrics    []string          `json:"metrics"`
+	DetailURL  string            `json:"detail_url"`
+	SenderHost string            `json:"sender_host"`
+}
+
+// msbackendSink 只有名字为数字的task可以发送到msbackend
+type msbackendSink struct {
+	client *http.Client
+	url    string
+	sender string
+}
+
+// Send .
+func (s *msbackendSink) Send(ctx context.Context, a *Alert) error {
+	ruleID, err := strconv.ParseUint(a.Task, 10, 0)
+	if err != nil {
+		return fmt.Errorf("the task name %v is not a rule id of msbackend", a.Task)
+	}
+	host, _ := os.Hostname()
+	msAlert := MSAlert{
+		RuleID: uint(ruleID),
+		Sender: s.sender,
+		Vars: map[string]string{
+			"upper":       fmt.Sprintf("%v", a.Upper),
+			"lower":       fmt.Sprintf("%v", a.Lower),
+			"observe":     fmt.Sprintf("%v", a.Observed),
+			"incident_id": a.IncidentID,
+			"state":       a.State,
+			"severity":    a.Severity,
+		},
+		Content:    fmt.Sprintf("%v: %v", a.Title(), a.DataSource),
+		SenderHost: host,
+	}
+	return postJSON(ctx, s.client, s.url, msAlert, nil)
+}
@@ -114,12 +114,17 @@ func QueryTaskDetail(c *gin.Context) {
 		errMsg = err.Error()
 		errStamp = stamp
 	}
+	tss := make([]*detector.TimeSeries, 0, len(t.TSs()))
+	for _, s := range t.TSs() {
+		tss = append(tss, s)
+	}
 	c.JSON(200, map[string]interface{}{
 		"name":             t.Name,
 		"data_source":      t.DataSource,
 		"state":            t.State(),
 		"last_error":       errMsg,
 		"last_error_stamp": errStamp,
+		"timeseries":       tss,
 	})
 }
 
@@ -165,9 +170,10 @@ func AllTSDetail(c *gin.Context) {
 				errStamp = stamp
 			}
 			ts[s.Name()] = map[string]interface{}{
-				"state":     s.State(),
-				"err":       errMsg,
-				"err_stamp": errStamp,
+				"state":        s.State(),
+				"err":          errMsg,
+				"err_stamp":    errStamp,
+				"model_scores": s.ModelScores(),
 			}
 		}
 
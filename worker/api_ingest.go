@@ -0,0 +1,127 @@
+package worker
+
+import (
+	"io/ioutil"
+	"math"
+	"net/http"
+	"time"
+
+	"code.byted.org/microservice/tsad/worker/detector"
+	"code.byted.org/microservice/tsad/worker/ts"
+	"code.byted.org/microservice/tsad/worker/tsfetcher"
+	"github.com/gin-gonic/gin"
+)
+
+const maxIngestBodySize = 10 << 20
+
+// ingestPoint .
+type ingestPoint struct {
+	Stamp float64 `json:"stamp"` // unix seconds
+	Value float64 `json:"value"`
+}
+
+/*
+Ingest 推送一条push类型ts的点, 推送的点会立即被检查;
+	ts由task指定, 或由key和extra指定; task的data_source中extra为空时, 可以用extra指定展开后的ts;
+	只有持有该task的worker会检查这些点, 所以需要推送到该worker;
+*/
+func Ingest(c *gin.Context) {
+	type req struct {
+		Task   string        `json:"task"`
+		Key    string        `json:"key"`
+		Extra  string        `json:"extra"`
+		Points []ingestPoint `json:"points"`
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxIngestBodySize)
+	var r req
+	if err := c.BindJSON(&r); err != nil {
+		c.String(400, "invalid request")
+		return
+	}
+
+	src := detector.DataSource{Type: detector.DataSourceTypePush, Key: r.Key, Extra: r.Extra}
+	if r.Task != "" {
+		t, ok := detector.TaskInfo(r.Task)
+		if !ok {
+			c.String(404, "task %v not found", r.Task)
+			return
+		}
+		if t.DataSource.Type != detector.DataSourceTypePush {
+			c.String(400, "the data source of task %v is not push", r.Task)
+			return
+		}
+		src.Key = t.DataSource.Key
+		if t.DataSource.Extra != "" {
+			src.Extra = t.DataSource.Extra
+		}
+	}
+	if src.Key == "" {
+		c.String(400, "no task or key")
+		return
+	}
+
+	points := make(ts.Points, 0, len(r.Points))
+	for _, p := range r.Points {
+		if math.IsNaN(p.Value) || math.IsInf(p.Value, 0) {
+			c.String(400, "invalid value: %v", p.Value)
+			return
+		}
+		sec, frac := math.Modf(p.Stamp)
+		points = append(points, ts.NewPoint(time.Unix(int64(sec), int64(frac*1e9)), p.Value))
+	}
+
+	fchSrc := tsfetcher.Source{Type: tsfetcher.SourcePush, Key: src.Key, Extra: src.Extra}
+	accepted, err := pushFetcher.Push(fchSrc, points)
+	if err != nil {
+		c.String(500, "push points err: %v", err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"accepted": accepted,
+	})
+}
+
+var linePrecisions = map[string]time.Duration{
+	"":   time.Nanosecond,
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+}
+
+// IngestLine 推送influxdb line protocol格式的点, 见tsfetcher.ParseLineProtocol;
+//  precision为timestamp的单位, 可以是ns(默认), us, ms, s
+func IngestLine(c *gin.Context) {
+	precision, ok := linePrecisions[c.Query("precision")]
+	if !ok {
+		c.String(400, "invalid precision: %v", c.Query("precision"))
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxIngestBodySize))
+	if err != nil {
+		c.String(400, "read body err: %v", err)
+		return
+	}
+	series, err := tsfetcher.ParseLineProtocol(body, precision, time.Now())
+	if err != nil {
+		c.String(400, "invalid line protocol: %v", err)
+		return
+	}
+
+	accepted := 0
+	for _, s := range series {
+		n, err := pushFetcher.Push(s.Src, s.Points)
+		if err != nil {
+			c.String(500, "push points of %v err: %v", s.Src, err)
+			return
+		}
+		accepted += n
+	}
+
+	c.JSON(200, gin.H{
+		"series":   len(series),
+		"accepted": accepted,
+	})
+}
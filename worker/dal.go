@@ -42,7 +42,7 @@ type ModelData struct {
 	SrcKey string `gorm:"primary_key;not null;unique_index:uniq_key"`
 	Name   string
 	Data   string
-	Stamp  time.Time
+	Stamp  time.Time // when the model is trained
 }
 
 // TableName .
@@ -69,3 +69,60 @@ func QueryModelData(key string) (*ModelData, error) {
 func DeleteModelData(key string) error {
 	return db.Where("src_key=?", key).Delete(ModelData{}).Error
 }
+
+// Silence .
+type Silence struct {
+	ID        int64  `gorm:"primary_key;AUTO_INCREMENT"`
+	Task      string // glob of the task name
+	Matchers  string // JSON of the tag globs
+	StartsAt  time.Time
+	EndsAt    time.Time
+	CreatedBy string
+	Comment   string
+	CreatedAt time.Time
+}
+
+// TableName .
+func (s Silence) TableName() string {
+	return "tsad_silences"
+}
+
+// QueryActiveSilences .
+func QueryActiveSilences(now time.Time) ([]*Silence, error) {
+	var ss []*Silence
+	err := db.Where("starts_at<=? AND ends_at>?", now, now).Find(&ss).Error
+	return ss, err
+}
+
+// Anomaly .
+type Anomaly struct {
+	ID         int64 `gorm:"primary_key;AUTO_INCREMENT"`
+	Task       string
+	Series     string // JSON of the DataSource of the ts
+	Stamp      time.Time
+	Observed   float64
+	Lower      float64
+	Upper      float64
+	Score      float64
+	Severity   string
+	Model      string
+	IncidentID string
+	CreatedAt  time.Time
+}
+
+// TableName .
+func (a Anomaly) TableName() string {
+	return "tsad_anomalies"
+}
+
+// InsertAnomalies .
+func InsertAnomalies(as []*Anomaly) error {
+	tx := db.Begin()
+	for _, a := range as {
+		if err := tx.Create(a).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit().Error
+}
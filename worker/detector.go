@@ -1,19 +1,15 @@
 package worker
 
 import (
-	"bytes"
 	"context"
 	"crypto/md5"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
-	"code.byted.org/gopkg/tsdb"
 	"code.byted.org/microservice/tsad/worker/detector"
 	"code.byted.org/microservice/tsad/worker/ts"
 	"code.byted.org/microservice/tsad/worker/tsfetcher"
@@ -24,31 +20,22 @@ import (
 )
 
 var (
-	tsdbClient *tsdb.Client
-	logger     = utils.NewLogger("worker")
+	logger = utils.NewLogger("worker")
 )
 
 func startDetector() error {
-	var err error
-	tsdbClient, err = tsdb.NewClient(&tsdb.Options{
-		MaxConcurrency:       1000,
-		DefaultTimeoutInMs:   int((time.Second * 10) / time.Microsecond),
-		DefaultRetry:         5,
-		DefaultRetryInterval: time.Second,
-	})
-	if err != nil {
-		return fmt.Errorf("create tsdb client err: %v", err)
-	}
-
 	taskLeaser, err := NewDefaultTaskLeaser(config.MysqlDSN)
 	if err != nil {
 		return fmt.Errorf("NewDefaultTaskLeaser err: %v", err)
 	}
 	op := &detector.Options{
-		MaxTasks: config.MaxTasks,
+		MaxTasks:       config.MaxTasks,
+		LongestPeriod:  tsfetcher.TSDBTSAttr.LongestPeriod(),
+		AlertRateLimit: config.AlertRateLimit,
 		P: &detector.Plugins{
 			Heartbeat:   Heartbeat,
 			FetchFromTo: FetchFromTo,
+			Arrival:     Arrival,
 			// fetchFromTo: FetchFrom
 			DeriveSource:   DeriveSource,
 			Train:          Train,
@@ -58,6 +45,8 @@ func startDetector() error {
 			Preprocess:     Preprocess,
 			ModelAdapter:   ModelAdapter,
 			Alert:          Alert,
+			Silences:       Silences,
+			RecordAnomaly:  RecordAnomaly,
 		},
 		TaskLeaser: taskLeaser,
 	}
@@ -65,96 +54,255 @@ func startDetector() error {
 	return detector.Start(op)
 }
 
+// backend a named data source backend, the data sources whose Type is its name are fetched by it
+type backend struct {
+	typ     tsfetcher.SourceType
+	fetcher tsfetcher.TSFetcher
+}
+
 var (
-	tsdbFetcher tsfetcher.TSFetcher
+	backends    = make(map[string]*backend)
+	pushFetcher *tsfetcher.PushFetcher // receives the points of the ingest APIs
 )
 
+// legacyBackends the backends configured by the per-type fields of Config, named by their types
+func legacyBackends(c *Config) []BackendConfig {
+	push := BackendConfig{
+		Name:    detector.DataSourceTypePush,
+		Type:    detector.DataSourceTypePush,
+		Step:    c.PushFrequency,
+		Options: make(map[string]string),
+	}
+	if c.PushCapacity > 0 {
+		push.Options["capacity"] = strconv.Itoa(c.PushCapacity)
+	}
+	if c.PushMaxSeries > 0 {
+		push.Options["max_series"] = strconv.Itoa(c.PushMaxSeries)
+	}
+	confs := []BackendConfig{{
+		Name:    detector.DataSourceTypeTSDB,
+		Type:    detector.DataSourceTypeTSDB,
+		API:     c.TSDBAPI,
+		Retry:   c.TSDBRetry,
+		Timeout: c.TSDBTimeout,
+	}, push, {
+		Name: detector.DataSourceTypeExpr,
+		Type: detector.DataSourceTypeExpr,
+	}}
+
+	if c.PrometheusAPI != "" {
+		confs = append(confs, BackendConfig{
+			Name:    detector.DataSourceTypePrometheus,
+			Type:    detector.DataSourceTypePrometheus,
+			API:     c.PrometheusAPI,
+			Step:    c.PrometheusStep,
+			Retry:   c.PrometheusRetry,
+			Timeout: c.PrometheusTimeout,
+		})
+	}
+	if c.InfluxDBAPI != "" {
+		confs = append(confs, BackendConfig{
+			Name:    detector.DataSourceTypeInfluxDB,
+			Type:    detector.DataSourceTypeInfluxDB,
+			API:     c.InfluxDBAPI,
+			Step:    c.InfluxDBStep,
+			Retry:   c.InfluxDBRetry,
+			Timeout: c.InfluxDBTimeout,
+			Options: map[string]string{
+				"database": c.InfluxDBDatabase,
+				"org":      c.InfluxDBOrg,
+				"token":    c.InfluxDBToken,
+			},
+		})
+	}
+	if c.GraphiteAPI != "" {
+		confs = append(confs, BackendConfig{
+			Name:    detector.DataSourceTypeGraphite,
+			Type:    detector.DataSourceTypeGraphite,
+			API:     c.GraphiteAPI,
+			Step:    c.GraphiteStep,
+			Retry:   c.GraphiteRetry,
+			Timeout: c.GraphiteTimeout,
+		})
+	}
+	if c.FileRoot != "" {
+		confs = append(confs, BackendConfig{
+			Name:    detector.DataSourceTypeFile,
+			Type:    detector.DataSourceTypeFile,
+			API:     c.FileRoot,
+			Step:    c.FileFrequency,
+			Options: map[string]string{"tail": strconv.FormatBool(c.FileTail)},
+		})
+	}
+	if c.SQLDSN != "" {
+		confs = append(confs, BackendConfig{
+			Name:    detector.DataSourceTypeSQL,
+			Type:    detector.DataSourceTypeSQL,
+			API:     c.SQLDSN,
+			Step:    c.SQLFrequency,
+			Timeout: c.SQLTimeout,
+		})
+	}
+	if len(c.HTTPAllowedHosts) > 0 {
+		confs = append(confs, BackendConfig{
+			Name:    detector.DataSourceTypeHTTP,
+			Type:    detector.DataSourceTypeHTTP,
+			Step:    c.HTTPFrequency,
+			Retry:   c.HTTPRetry,
+			Timeout: c.HTTPTimeout,
+			Options: map[string]string{"allowed_hosts": strings.Join(c.HTTPAllowedHosts, ",")},
+		})
+	}
+	return confs
+}
+
 func initFetchers() error {
-	var err error
-	middleStore, err := tsfetcher.NewMysqlMiddleStore(config.MysqlDSN)
+	middleStore, err := newMiddleStore()
 	if err != nil {
-		return fmt.Errorf("NewMysqlMiddleStore err: %v", err)
+		return err
 	}
 
-	tsdbFetcher, err = tsfetcher.NewTSDBFetcher(config.TSDBAPI,
-		config.TSDBRetry,
-		config.TSDBTimeout*time.Millisecond, middleStore)
-	if err != nil {
-		return fmt.Errorf("NewTSDBFetcher err: %v", err)
+	// the backends in config.Backends override the legacy ones with the same name
+	confs := make(map[string]BackendConfig)
+	for _, c := range append(legacyBackends(config), config.Backends...) {
+		if c.Name == "" {
+			return fmt.Errorf("the name of the %v backend can not be null", c.Type)
+		}
+		confs[c.Name] = c
+	}
+
+	for name, c := range confs {
+		fetcher, typ, err := tsfetcher.NewFetcher(tsfetcher.BackendConfig{
+			Name:         name,
+			Type:         tsfetcher.SourceType(c.Type),
+			API:          c.API,
+			Step:         c.Step * time.Second,
+			Retry:        c.Retry,
+			Timeout:      c.Timeout * time.Millisecond,
+			Options:      c.Options,
+			Concurrency:  c.Concurrency,
+			MiddleStorer: middleStore,
+			Operand:      fetchOperand,
+		})
+		if err != nil {
+			return fmt.Errorf("init backend %v err: %v", name, err)
+		}
+		backends[name] = &backend{typ: typ, fetcher: fetcher}
+		logger.Infof("data source backend %v(%v) is initialized", name, typ)
+	}
+
+	if b, ok := backends[detector.DataSourceTypePush]; ok {
+		pushFetcher, _ = b.fetcher.(*tsfetcher.PushFetcher)
+	}
+	if pushFetcher == nil {
+		return fmt.Errorf("backend %v should be a push backend", detector.DataSourceTypePush)
 	}
 	return nil
 }
 
+func newMiddleStore() (tsfetcher.MiddleStorer, error) {
+	if config.MiddleStoreDir == "" {
+		ms, err := tsfetcher.NewMysqlMiddleStore(config.MysqlDSN)
+		if err != nil {
+			return nil, fmt.Errorf("NewMysqlMiddleStore err: %v", err)
+		}
+		return ms, nil
+	}
+
+	ttl := config.MiddleStoreTTL * time.Second
+	if ttl == 0 {
+		ttl = tsfetcher.TSDBTSAttr.LongestPeriod() + time.Hour*24
+	}
+	chunk := config.MiddleStoreChunk
+	if chunk == 0 {
+		chunk = 1024
+	}
+	ms, err := tsfetcher.NewLocalMiddleStore(config.MiddleStoreDir, ttl, chunk)
+	if err != nil {
+		return nil, fmt.Errorf("NewLocalMiddleStore err: %v", err)
+	}
+	return ms, nil
+}
+
+// fetchOperand fetches an operand of an expr source, the operand is a DataSource in JSON
+func fetchOperand(ctx context.Context, operand string, from, to time.Time) (ts.TS, error) {
+	var src detector.DataSource
+	if err := json.Unmarshal([]byte(operand), &src); err != nil {
+		return nil, fmt.Errorf("invalid operand: %v, err: %v", operand, err)
+	}
+	return FetchFromTo(ctx, &detector.TimeSeries{DataSource: src}, from, to)
+}
+
 // FetchFromTo .
 func FetchFromTo(ctx context.Context, tms *detector.TimeSeries, from, to time.Time) (ts.TS, error) {
+	b, fchSrc, err := dataSource2FetcherSource(tms.DataSource)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source and ts: %v, err: %v", tms, err)
+	}
+
 	end := time.Now().Add(-time.Minute * 1) // the latest data is inaccurate
-	if to.After(end) {
+	if to.After(end) && b.typ != tsfetcher.SourcePush {
 		to = end
 	}
 	if to.Before(from) {
 		return nil, fmt.Errorf("latest data is inaccurate, please try later")
 	}
-
-	fchSrc, err := dataSource2FetcherSource(tms.DataSource)
-	if err != nil {
-		return nil, fmt.Errorf("invalid source and ts: %v, err: %v", tms, err)
-	}
-	switch tms.DataSource.Type {
-	case detector.DataSourceTypeTSDB:
-		return tsdbFetcher.Fetch(ctx, fchSrc, from, to)
-	}
-
-	return nil, fmt.Errorf("invalid DataSourceType: %v", tms.DataSource.Type)
+	return b.fetcher.Fetch(ctx, fchSrc, from, to)
 }
 
-func dataSource2FetcherSource(source detector.DataSource) (tsfetcher.Source, error) {
-	switch source.Type {
-	case detector.DataSourceTypeTSDB:
-		return tsfetcher.Source{
-			Type:  tsfetcher.SourceTSDB,
-			Key:   source.Key,
-			Extra: source.Extra,
-		}, nil
+// dataSource2FetcherSource returns the backend of source, and the source for the fetcher of the backend
+func dataSource2FetcherSource(source detector.DataSource) (*backend, tsfetcher.Source, error) {
+	b, ok := backends[string(source.Type)]
+	if !ok {
+		return nil, tsfetcher.Source{}, fmt.Errorf("data source type %v is not configured", source.Type)
 	}
-	return tsfetcher.Source{}, fmt.Errorf("unknown data source type: %v", source.Type)
+	return b, tsfetcher.Source{
+		Type:  b.typ,
+		Key:   source.Key,
+		Extra: source.Extra,
+	}, nil
 }
 
 // DeriveSource .
 func DeriveSource(src detector.DataSource) ([]detector.DataSource, error) {
-	if src.Type != detector.DataSourceTypeTSDB {
-		return []detector.DataSource{src}, nil
-	}
-
-	if src.Type == detector.DataSourceTypeTSDB {
-		if !strings.Contains(src.Extra, "*") {
-			return []detector.DataSource{src}, nil
-		}
+	b, fchSrc, err := dataSource2FetcherSource(src)
+	if err != nil {
+		return nil, err
 	}
-
-	pattern := "%v?start=10m-ago&m=%v%v"
-	tsdbURL := fmt.Sprintf(pattern, config.TSDBAPI, src.Key, src.Extra)
-	var resp []*tsdb.RespModel
-	if err := tsdbClient.Do(context.Background(), tsdbURL, &resp); err != nil {
-		return nil, fmt.Errorf("query tsdb err: %v", err)
+	fchSrcs, err := tsfetcher.Derive(context.Background(), b.fetcher, fchSrc)
+	if err != nil {
+		return nil, err
 	}
 
-	var srcs []detector.DataSource
-	for _, r := range resp {
-		var kvs []string
-		for k, v := range r.Tags {
-			kvs = append(kvs, fmt.Sprintf("%v=%v", k, v))
-		}
-		extra := "{" + strings.Join(kvs, ",") + "}"
+	srcs := make([]detector.DataSource, 0, len(fchSrcs))
+	for _, s := range fchSrcs {
 		srcs = append(srcs, detector.DataSource{
 			Type:  src.Type,
-			Key:   src.Key,
-			Extra: extra,
+			Key:   s.Key,
+			Extra: s.Extra,
 		})
 	}
-
 	return srcs, nil
 }
 
+// Arrival .
+func Arrival(src detector.DataSource) <-chan struct{} {
+	b, fchSrc, err := dataSource2FetcherSource(src)
+	if err != nil {
+		return nil
+	}
+	notifier, ok := b.fetcher.(tsfetcher.ArrivalNotifier)
+	if !ok {
+		return nil
+	}
+	arrival, err := notifier.Arrival(fchSrc)
+	if err != nil {
+		logger.Errorf("watch the arrival of %v err: %v", src, err)
+		return nil
+	}
+	return arrival
+}
+
 // Heartbeat .
 func Heartbeat(numTasks int) error {
 	return UpdateDetectorInfo(&Detector{
@@ -165,8 +313,8 @@ func Heartbeat(numTasks int) error {
 }
 
 // Train .
-func Train(data ts.TS, adapter detector.ModelAdapter) (detector.TSModel, error) {
-	return tstrain.Train(data, adapter)
+func Train(data ts.TS, adapter detector.ModelAdapter, op *detector.TrainOption) (detector.TSModel, []detector.ModelScore, error) {
+	return tstrain.Train(data, adapter, op)
 }
 
 func srcKey(src detector.DataSource) (string, error) {
@@ -182,7 +330,7 @@ func srcKey(src detector.DataSource) (string, error) {
 	return str, nil
 }
 
-// StoreModelData .
+// StoreModelData the stamp is trainStamp rather than now, so storing an online model again keeps its age
 func StoreModelData(src detector.DataSource, mname, data string,
 	trainStamp time.Time) error {
 	key, err := srcKey(src)
@@ -194,7 +342,7 @@ func StoreModelData(src detector.DataSource, mname, data string,
 		SrcKey: key,
 		Name:   mname,
 		Data:   data,
-		Stamp:  time.Now(),
+		Stamp:  trainStamp,
 	}
 	return SaveModelData(m)
 }
@@ -243,78 +391,6 @@ func ModelAdapter(data ts.TS,
 	return true
 }
 
-// Alarm .
-type Alarm struct {
-	Name       string    `json:"name"`
-	DataSource string    `json:"data_source"`
-	Stamp      time.Time `json:"stamp"`
-	Observed   float64   `json:"observed"`
-	Lower      float64   `json:"lower"`
-	Upper      float64   `json:"upper"`
-}
-
-// MSAlert .
-type MSAlert struct {
-	RuleID uint   `json:"rule_id"`
-	Sender string `json:"sender"`
-
-	Content    string            `json:"content"`
-	Vars       map[string]string `json:"vars"`
-	Tags       map[string]string `json:"tags"`
-	Metrics    []string          `json:"metrics"`
-	DetailURL  string            `json:"detail_url"`
-	SenderHost string            `json:"sender_host"`
-}
-
-// Alert .
-func Alert(t *detector.Task, ts *detector.TimeSeries,
-	lower, upper float64, ob ts.Point) {
-
-	src, _ := json.Marshal(ts.DataSource)
-	alarm := &Alarm{
-		Name:       ts.TaskName,
-		DataSource: string(src),
-		Stamp:      ob.Stamp(),
-		Observed:   ob.Value(),
-		Lower:      lower,
-		Upper:      upper,
-	}
-	buf, _ := json.Marshal(alarm)
-	logger.Infof(">>>>> alert", string(buf))
-
-	// TODO(zhangyuanjia): send alert to msbackend
-	rid, err := strconv.Atoi(t.Name)
-	if err != nil {
-		logger.Errorf("invalid ms ruleid ", t.Name)
-		return
-	}
-	ma := &MSAlert{
-		RuleID: uint(rid),
-		Sender: "tsad",
-		Vars: map[string]string{
-			"upper":   fmt.Sprintf("%v", upper),
-			"lower":   fmt.Sprintf("%v", lower),
-			"observe": fmt.Sprintf("%v", ob.Value()),
-		},
-		Content: fmt.Sprintf("tsad alert: %v", ts.DataSource),
-	}
-	buf, _ = json.Marshal(ma)
-	resp, err := http.Post("http://ms.byted.org/msbackend/api/alarm/gen_alarm", "application/json", bytes.NewReader(buf))
-	if err != nil {
-		logger.Errorf("post alert err: %v", err)
-		return
-	}
-
-	buf, err = ioutil.ReadAll(resp.Body)
-	if err != nil {
-		logger.Errorf("read ms alert resp err: %v", err)
-		return
-	}
-	logger.Infof("post ms alert: ", string(buf))
-
-	return
-}
-
 // DefaultTaskLeaser .
 type DefaultTaskLeaser struct {
 	distLocker DistLocker
@@ -0,0 +1,218 @@
+package detector
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"code.byted.org/microservice/tsad/common"
+	"code.byted.org/microservice/tsad/worker/ts"
+)
+
+// AlertState the state of the alert of a ts
+type AlertState string
+
+const (
+	AlertInactive AlertState = "inactive"
+	AlertPending  AlertState = "pending"  // anomalous, but not for alert_pending_checks checks yet
+	AlertFiring   AlertState = "firing"   // the incident has been notified
+	AlertResolved AlertState = "resolved" // normal for alert_resolve_checks checks after firing
+)
+
+// AlertEvent a firing or resolved notification of an incident, it is sent by Plugins.Alert
+type AlertEvent struct {
+	IncidentID string
+	State      AlertState // AlertFiring or AlertResolved
+	StartsAt   time.Time  // the first anomalous check of the incident
+	EndsAt     time.Time  // zero if firing
+
+	// the highest severity of the checks of the incident, and the score of that check
+	Severity common.Severity
+	Score    float64
+
+	// Escalated the incident has fired, and it is notified again for the higher severity
+	Escalated bool
+
+	// the latest anomalous point of the incident and its interval
+	Observed ts.Point
+	Lower    float64
+	Upper    float64
+}
+
+/*
+alertTracker 一个ts的告警状态机;
+	inactive/resolved --异常--> pending --连续pendingChecks次异常--> firing --连续resolveChecks次正常--> resolved;
+	pending时恢复正常则回到inactive, 不会通知;
+	从pending到resolved的连续异常属于同一个incident, 只在firing和resolved时各通知一次;
+	firing后severity升高时再通知一次, Escalated为true;
+*/
+type alertTracker struct {
+	state      AlertState
+	incidentID string
+	startsAt   time.Time
+	endsAt     time.Time
+	badChecks  int
+	goodChecks int
+
+	severity     common.Severity // the highest severity of the checks
+	score        float64
+	observed     ts.Point
+	lower, upper float64
+
+	// whether the incident has been notified, or why it is suppressed
+	notified     bool
+	suppressed   string
+	lastNotified time.Time // when the last incident of the ts fired
+}
+
+// bad records an anomalous check, returns the event to notify or nil
+func (at *alertTracker) bad(name string, now time.Time, pendingChecks int,
+	sev common.Severity, score float64, lower, upper float64, observed ts.Point) *AlertEvent {
+
+	at.goodChecks = 0
+	at.observed, at.lower, at.upper = observed, lower, upper
+	escalated := sev.Level() > at.severity.Level()
+	if escalated || (sev == at.severity && score > at.score) {
+		at.severity, at.score = sev, score
+	}
+	switch at.state {
+	case AlertFiring:
+		if !escalated {
+			return nil
+		}
+		ev := at.event()
+		ev.Escalated = true
+		return ev
+	case AlertPending:
+		at.badChecks++
+	default:
+		at.state = AlertPending
+		at.startsAt = now
+		at.endsAt = time.Time{}
+		at.incidentID = newIncidentID(name, now)
+		at.badChecks = 1
+		at.severity, at.score = sev, score
+		at.notified = false
+		at.suppressed = ""
+	}
+
+	if at.badChecks < pendingChecks {
+		return nil
+	}
+	at.state = AlertFiring
+	return at.event()
+}
+
+// good records a normal check, returns the event to notify or nil
+func (at *alertTracker) good(now time.Time, resolveChecks int) *AlertEvent {
+	switch at.state {
+	case AlertPending:
+		at.state = AlertInactive
+		at.badChecks = 0
+		return nil
+	case AlertFiring:
+		at.goodChecks++
+		if at.goodChecks < resolveChecks {
+			return nil
+		}
+		return at.resolve(now)
+	}
+	return nil
+}
+
+// resolve the firing incident, returns the event to notify or nil
+func (at *alertTracker) resolve(now time.Time) *AlertEvent {
+	if at.state != AlertFiring {
+		return nil
+	}
+	at.state = AlertResolved
+	at.endsAt = now
+	at.badChecks = 0
+	at.goodChecks = 0
+	return at.event()
+}
+
+func (at *alertTracker) event() *AlertEvent {
+	return &AlertEvent{
+		IncidentID: at.incidentID,
+		State:      at.state,
+		StartsAt:   at.startsAt,
+		EndsAt:     at.endsAt,
+		Severity:   at.severity,
+		Score:      at.score,
+		Observed:   at.observed,
+		Lower:      at.lower,
+		Upper:      at.upper,
+	}
+}
+
+func (at *alertTracker) toJSON() map[string]interface{} {
+	state := at.state
+	if state == "" {
+		state = AlertInactive
+	}
+	return map[string]interface{}{
+		"state":       state,
+		"incident_id": at.incidentID,
+		"starts_at":   at.startsAt,
+		"ends_at":     at.endsAt,
+		"severity":    at.severity,
+		"notified":    at.notified,
+		"suppressed":  at.suppressed,
+	}
+}
+
+// newIncidentID .
+func newIncidentID(name string, startsAt time.Time) string {
+	sum := md5.Sum([]byte(fmt.Sprintf("%v@%v", name, startsAt.UnixNano())))
+	return hex.EncodeToString(sum[:8])
+}
+
+// AlertBad records an anomalous check of the ts, returns the event to notify or nil
+func (ts *TimeSeries) AlertBad(pendingChecks int, sev common.Severity, score float64,
+	lower, upper float64, observed ts.Point) *AlertEvent {
+
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	return ts.alert.bad(ts.Name(), time.Now(), pendingChecks, sev, score, lower, upper, observed)
+}
+
+// AlertGood records a normal check of the ts, returns the event to notify or nil
+func (ts *TimeSeries) AlertGood(resolveChecks int) *AlertEvent {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	return ts.alert.good(time.Now(), resolveChecks)
+}
+
+// AlertResolve resolves the firing incident of the ts, such as when the task is canceled
+func (ts *TimeSeries) AlertResolve() *AlertEvent {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	return ts.alert.resolve(time.Now())
+}
+
+func (ts *TimeSeries) alertNotified() bool {
+	ts.lock.RLock()
+	defer ts.lock.RUnlock()
+	return ts.alert.notified
+}
+
+func (ts *TimeSeries) alertLastNotified() time.Time {
+	ts.lock.RLock()
+	defer ts.lock.RUnlock()
+	return ts.alert.lastNotified
+}
+
+func (ts *TimeSeries) setAlertNotified(now time.Time) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	ts.alert.notified = true
+	ts.alert.lastNotified = now
+}
+
+func (ts *TimeSeries) setAlertSuppressed(reason string) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	ts.alert.suppressed = reason
+}
@@ -0,0 +1,125 @@
+package detector
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"code.byted.org/microservice/tsad/common"
+)
+
+// rateLimiter allows at most limit events in the sliding window
+type rateLimiter struct {
+	limit  int
+	window time.Duration
+	stamps []time.Time
+}
+
+func (rl *rateLimiter) expire(now time.Time) {
+	i := 0
+	for i < len(rl.stamps) && now.Sub(rl.stamps[i]) >= rl.window {
+		i++
+	}
+	rl.stamps = rl.stamps[i:]
+}
+
+// allowed without recording, a limiter with limit 0 is unlimited
+func (rl *rateLimiter) allowed(now time.Time) bool {
+	if rl.limit <= 0 {
+		return true
+	}
+	rl.expire(now)
+	return len(rl.stamps) < rl.limit
+}
+
+func (rl *rateLimiter) record(now time.Time) {
+	if rl.limit > 0 {
+		rl.stamps = append(rl.stamps, now)
+	}
+}
+
+/*
+alertGate 决定一个firing的incident是否通知;
+	依次检查: 匹配的silence, 同一ts的dedup窗口, task的限速, 全局的限速;
+	被抑制的incident在resolved时也不通知;
+*/
+type alertGate struct {
+	global *rateLimiter
+	tasks  map[string]*rateLimiter
+	lock   sync.Mutex
+}
+
+func newAlertGate(globalPerHour int) *alertGate {
+	return &alertGate{
+		global: &rateLimiter{limit: globalPerHour, window: time.Hour},
+		tasks:  make(map[string]*rateLimiter),
+	}
+}
+
+// suppress returns the reason if the firing incident should not be notified
+func (g *alertGate) suppress(t *Task, s *TimeSeries, silences []*common.Silence, now time.Time) string {
+	if reason := silencedBy(t, s, silences, now); reason != "" {
+		return reason
+	}
+
+	dedup := time.Minute * time.Duration(t.Configs.AlertDedupMin)
+	if last := s.alertLastNotified(); dedup > 0 && !last.IsZero() && now.Sub(last) < dedup {
+		return fmt.Sprintf("deduplicated, the last incident was notified at %v", last.Format(time.RFC3339))
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	limiter, ok := g.tasks[t.Name]
+	if !ok || limiter.limit != t.Configs.AlertRateLimit {
+		limiter = &rateLimiter{limit: t.Configs.AlertRateLimit, window: time.Hour}
+		g.tasks[t.Name] = limiter
+	}
+	if !limiter.allowed(now) {
+		return fmt.Sprintf("rate limited, the task has notified %v incidents in the last hour", limiter.limit)
+	}
+	if !g.global.allowed(now) {
+		return fmt.Sprintf("rate limited, %v incidents have been notified in the last hour", g.global.limit)
+	}
+	limiter.record(now)
+	g.global.record(now)
+	return ""
+}
+
+// silencedBy returns the reason if the ts is silenced
+func silencedBy(t *Task, s *TimeSeries, silences []*common.Silence, now time.Time) string {
+	for _, sl := range silences {
+		if sl.Active(now) && sl.Match(t.Name, SourceTags(s.DataSource)) {
+			return fmt.Sprintf("silenced by %v", sl.ID)
+		}
+	}
+	return ""
+}
+
+// notify sends the event by Plugins.Alert if it passes the gate
+func (d *detector) notify(t *Task, s *TimeSeries, ev *AlertEvent) {
+	var silences []*common.Silence
+	if ev.State == AlertFiring && d.O.P.Silences != nil {
+		silences = d.O.P.Silences()
+	}
+
+	if ev.State == AlertFiring && ev.Escalated && s.alertNotified() {
+		// the notified incident is only checked by the silences when it escalates
+		if reason := silencedBy(t, s, silences, time.Now()); reason != "" {
+			d.logger.Infof("ts=%v, incident %v escalated to %v is suppressed: %v", s.Name(), ev.IncidentID, ev.Severity, reason)
+			return
+		}
+	} else if ev.State == AlertFiring {
+		if reason := d.gate.suppress(t, s, silences, time.Now()); reason != "" {
+			s.setAlertSuppressed(reason)
+			d.logger.Infof("ts=%v, incident %v is suppressed: %v", s.Name(), ev.IncidentID, reason)
+			return
+		}
+		s.setAlertNotified(time.Now())
+	} else if !s.alertNotified() {
+		d.logger.Infof("ts=%v, incident %v is %v without notification", s.Name(), ev.IncidentID, ev.State)
+		return
+	}
+
+	d.logger.Infof("ts=%v, incident %v is %v, severity: %v", s.Name(), ev.IncidentID, ev.State, ev.Severity)
+	d.O.P.Alert(t, s, ev)
+}
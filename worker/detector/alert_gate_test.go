@@ -0,0 +1,201 @@
+package detector
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"code.byted.org/microservice/tsad/common"
+	"code.byted.org/microservice/tsad/utils"
+	"code.byted.org/microservice/tsad/worker/ts"
+)
+
+func testTask(t *testing.T, name, config string) *Task {
+	task, err := newTask(TaskMeta{Name: name, Config: config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return task
+}
+
+func TestRateLimiter(t *testing.T) {
+	begin := time.Unix(1500000000, 0)
+	rl := &rateLimiter{limit: 2, window: time.Hour}
+	rl.record(begin)
+	rl.record(begin.Add(time.Minute * 10))
+	if rl.allowed(begin.Add(time.Minute * 20)) {
+		t.Fatal("the third event in the window is allowed")
+	}
+	// the first event expires after a window
+	if !rl.allowed(begin.Add(time.Hour)) {
+		t.Fatal("the event is not allowed after the first one expires")
+	}
+	if len(rl.stamps) != 1 {
+		t.Fatalf("%v stamps are kept, expect 1", len(rl.stamps))
+	}
+
+	unlimited := &rateLimiter{window: time.Hour}
+	for i := 0; i < 100; i++ {
+		unlimited.record(begin)
+	}
+	if !unlimited.allowed(begin) || len(unlimited.stamps) != 0 {
+		t.Fatal("the limiter with limit 0 should be unlimited")
+	}
+}
+
+func TestAlertGate(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	g := newAlertGate(3)
+	a := testTask(t, "a", `{"alert_rate_limit": 2}`)
+	b := testTask(t, "b", "")
+	c := testTask(t, "c", "")
+	src := DataSource{Type: DataSourceTypeTSDB, Key: "cpu"}
+
+	expect := func(task *Task, reason string) {
+		got := g.suppress(task, newTimeSeries(task.Name, src), nil, now)
+		if (reason == "") != (got == "") || !strings.Contains(got, reason) {
+			t.Fatalf("task %v suppressed by %q, expect %q", task.Name, got, reason)
+		}
+	}
+	expect(a, "")
+	expect(a, "")
+	expect(a, "the task has notified 2 incidents")
+	expect(b, "")
+	expect(c, "3 incidents have been notified")
+
+	// the limits are sliding windows
+	now = now.Add(time.Hour)
+	expect(a, "")
+	expect(c, "")
+
+	// dedup by the last notified incident of the same ts
+	d := testTask(t, "d", `{"alert_dedup_min": 10}`)
+	s := newTimeSeries(d.Name, src)
+	g = newAlertGate(0)
+	s.setAlertNotified(now)
+	if reason := g.suppress(d, s, nil, now.Add(time.Minute*5)); !strings.Contains(reason, "deduplicated") {
+		t.Fatalf("suppressed by %q, expect deduplicated", reason)
+	}
+	if reason := g.suppress(d, s, nil, now.Add(time.Minute*10)); reason != "" {
+		t.Fatalf("suppressed by %q after the dedup window", reason)
+	}
+}
+
+func TestSourceTags(t *testing.T) {
+	src := DataSource{
+		Type:  DataSourceTypePrometheus,
+		Key:   "up",
+		Extra: `{job="api", instance = 'a:80', env!="test", path=~"/v1.*", region!~"cn.*"}`,
+	}
+	expt := map[string]string{
+		common.SilenceTagType: string(DataSourceTypePrometheus),
+		common.SilenceTagKey:  "up",
+		"job":                 "api",
+		"instance":            "a:80",
+	}
+	if tags := SourceTags(src); !reflect.DeepEqual(tags, expt) {
+		t.Fatalf("got tags %v, expect %v", tags, expt)
+	}
+
+	// the Extra of TSDB is not a tag set
+	src = DataSource{Type: DataSourceTypeTSDB, Key: "cpu", Extra: "host=a"}
+	if tags := SourceTags(src); len(tags) != 2 {
+		t.Fatalf("got tags %v, expect only the pseudo tags", tags)
+	}
+}
+
+func TestSilencedBy(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	task := testTask(t, "cpu_high", "")
+	s := newTimeSeries(task.Name, DataSource{Type: DataSourceTypePrometheus, Key: "node_cpu", Extra: `{host="web-1",env!="test"}`})
+
+	cases := []struct {
+		silence  common.Silence
+		silenced bool
+	}{
+		{common.Silence{Task: "cpu_*"}, true},
+		{common.Silence{Task: "mem_*"}, false},
+		{common.Silence{Matchers: map[string]string{"host": "web-*"}}, true},
+		{common.Silence{Matchers: map[string]string{"host": "db-*"}}, false},
+		{common.Silence{Task: "cpu_high", Matchers: map[string]string{"__type__": "prometheus", "__key__": "node_*"}}, true},
+		{common.Silence{Matchers: map[string]string{"__key__": "disk_*"}}, false},
+		// the tags of the inequalities are not matched
+		{common.Silence{Matchers: map[string]string{"env": "test"}}, false},
+		// all the matchers should be matched
+		{common.Silence{Matchers: map[string]string{"host": "web-*", "dc": "*"}}, false},
+	}
+	for i, c := range cases {
+		sl := c.silence
+		sl.ID = int64(i)
+		sl.StartsAt, sl.EndsAt = now.Add(-time.Minute), now.Add(time.Hour)
+		if silenced := silencedBy(task, s, []*common.Silence{&sl}, now) != ""; silenced != c.silenced {
+			t.Fatalf("case %v: silenced %v, expect %v", i, silenced, c.silenced)
+		}
+	}
+
+	// * matches / in the keys of the urls and the graphite paths
+	hs := newTimeSeries(task.Name, DataSource{Type: DataSourceTypeHTTP, Key: "http://metrics.host/api/v1/cpu"})
+	for _, c := range []struct {
+		pattern  string
+		silenced bool
+	}{
+		{"http://metrics.host/*", true},
+		{"*/v1/*", true},
+		{"http://metrics.host/api/v?/cpu", true},
+		{"http://metrics.host/*/mem", false},
+	} {
+		sl := &common.Silence{Matchers: map[string]string{"__key__": c.pattern}, StartsAt: now.Add(-time.Minute), EndsAt: now.Add(time.Hour)}
+		if silenced := silencedBy(task, hs, []*common.Silence{sl}, now) != ""; silenced != c.silenced {
+			t.Fatalf("pattern %v: silenced %v, expect %v", c.pattern, silenced, c.silenced)
+		}
+	}
+
+	// the silence is not active
+	sl := &common.Silence{Task: "*", StartsAt: now.Add(time.Minute), EndsAt: now.Add(time.Hour)}
+	if reason := silencedBy(task, s, []*common.Silence{sl}, now); reason != "" {
+		t.Fatalf("silenced by the pending silence: %v", reason)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	var (
+		silences []*common.Silence
+		sent     []*AlertEvent
+	)
+	d := &detector{
+		O: &Options{P: &Plugins{
+			Alert: func(t *Task, ts *TimeSeries, ev *AlertEvent) {
+				sent = append(sent, ev)
+			},
+			Silences: func() []*common.Silence {
+				return silences
+			},
+		}},
+		gate:   newAlertGate(0),
+		logger: utils.NewLogger("detector_test"),
+	}
+	task := testTask(t, "a", "")
+	s := newTimeSeries(task.Name, DataSource{Type: DataSourceTypeTSDB, Key: "cpu"})
+	p := ts.NewPoint(time.Now(), 100)
+
+	// the silenced incident is neither notified when it fires nor when it resolves
+	silences = []*common.Silence{{Task: "a", StartsAt: time.Now().Add(-time.Minute), EndsAt: time.Now().Add(time.Hour)}}
+	d.notify(task, s, s.AlertBad(1, common.SeverityInfo, 0.5, 0, 1, p))
+	d.notify(task, s, s.AlertGood(1))
+	if len(sent) != 0 {
+		t.Fatalf("%v events of the silenced incident are sent", len(sent))
+	}
+
+	// the silence expires, the next incident is notified, and so are its escalation and resolution
+	silences = nil
+	d.notify(task, s, s.AlertBad(1, common.SeverityInfo, 0.5, 0, 1, p))
+	d.notify(task, s, s.AlertBad(1, common.SeverityCritical, 5, 0, 1, p))
+	d.notify(task, s, s.AlertResolve())
+	if len(sent) != 3 || sent[0].State != AlertFiring || !sent[1].Escalated || sent[2].State != AlertResolved {
+		t.Fatalf("sent %v events, expect firing, escalated and resolved", len(sent))
+	}
+	if sent[0].IncidentID != sent[2].IncidentID {
+		t.Fatalf("resolved incident %v, expect %v", sent[2].IncidentID, sent[0].IncidentID)
+	}
+}
@@ -0,0 +1,140 @@
+package detector
+
+import (
+	"testing"
+	"time"
+
+	"code.byted.org/microservice/tsad/common"
+	"code.byted.org/microservice/tsad/worker/ts"
+)
+
+// alertStep a check of the ts: b for anomalous, g for normal, r for resolving it (the task is canceled);
+//  expt is the state of the emitted event, "escalated", or "" if no event is emitted
+type alertStep struct {
+	check byte
+	sev   common.Severity
+	expt  string
+	state AlertState
+}
+
+func TestAlertTracker(t *testing.T) {
+	info, warning, critical := common.SeverityInfo, common.SeverityWarning, common.SeverityCritical
+	cases := []struct {
+		name          string
+		pendingChecks int
+		resolveChecks int
+		steps         []alertStep
+	}{
+		{"pending recovers to inactive", 3, 2, []alertStep{
+			{'b', info, "", AlertPending},
+			{'b', info, "", AlertPending},
+			{'g', "", "", AlertInactive},
+			{'b', info, "", AlertPending},
+			{'b', info, "", AlertPending},
+			{'b', info, "firing", AlertFiring},
+		}},
+		{"resolves after consecutive normal checks", 2, 2, []alertStep{
+			{'b', warning, "", AlertPending},
+			{'b', warning, "firing", AlertFiring},
+			{'g', "", "", AlertFiring},
+			{'b', warning, "", AlertFiring},
+			{'g', "", "", AlertFiring},
+			{'g', "", "resolved", AlertResolved},
+			{'g', "", "", AlertResolved},
+		}},
+		{"escalates only to the higher severity", 1, 1, []alertStep{
+			{'b', info, "firing", AlertFiring},
+			{'b', warning, "escalated", AlertFiring},
+			{'b', warning, "", AlertFiring},
+			{'b', info, "", AlertFiring},
+			{'b', critical, "escalated", AlertFiring},
+			{'g', "", "resolved", AlertResolved},
+		}},
+		{"a new incident after resolved", 2, 1, []alertStep{
+			{'b', info, "", AlertPending},
+			{'b', info, "firing", AlertFiring},
+			{'g', "", "resolved", AlertResolved},
+			{'b', info, "", AlertPending},
+			{'b', info, "firing", AlertFiring},
+		}},
+		{"resolve on cancel", 2, 3, []alertStep{
+			{'b', info, "", AlertPending},
+			{'r', "", "", AlertPending},
+			{'b', info, "firing", AlertFiring},
+			{'g', "", "", AlertFiring},
+			{'r', "", "resolved", AlertResolved},
+			{'r', "", "", AlertResolved},
+		}},
+	}
+
+	begin := time.Unix(1500000000, 0)
+	for _, c := range cases {
+		var (
+			at       alertTracker
+			incident string    // the id of the latest fired incident
+			startsAt time.Time // the first anomalous check of the current incident
+			maxSev   common.Severity
+		)
+		for i, step := range c.steps {
+			now := begin.Add(time.Minute * time.Duration(i))
+			if step.check == 'b' && at.state != AlertPending && at.state != AlertFiring {
+				startsAt, maxSev = now, step.sev
+			}
+			if step.sev.Level() > maxSev.Level() {
+				maxSev = step.sev
+			}
+
+			var ev *AlertEvent
+			switch step.check {
+			case 'b':
+				ev = at.bad("ts", now, c.pendingChecks, step.sev, float64(step.sev.Level()), 0, 1, ts.NewPoint(now, 10))
+			case 'g':
+				ev = at.good(now, c.resolveChecks)
+			case 'r':
+				ev = at.resolve(now)
+			}
+
+			if at.state != step.state {
+				t.Fatalf("%v: step %v state %v, expect %v", c.name, i, at.state, step.state)
+			}
+			got := ""
+			if ev != nil {
+				got = string(ev.State)
+				if ev.Escalated {
+					got = "escalated"
+				}
+			}
+			if got != step.expt {
+				t.Fatalf("%v: step %v emitted %q, expect %q", c.name, i, got, step.expt)
+			}
+			if ev == nil {
+				continue
+			}
+
+			switch step.expt {
+			case "firing":
+				if ev.IncidentID == "" || ev.IncidentID == incident {
+					t.Fatalf("%v: step %v fired incident %q, expect a new one", c.name, i, ev.IncidentID)
+				}
+				incident = ev.IncidentID
+			default:
+				if ev.IncidentID != incident {
+					t.Fatalf("%v: step %v incident %q, expect the fired %q", c.name, i, ev.IncidentID, incident)
+				}
+			}
+			if !ev.StartsAt.Equal(startsAt) {
+				t.Fatalf("%v: step %v starts at %v, expect %v", c.name, i, ev.StartsAt, startsAt)
+			}
+			if ev.Severity != maxSev {
+				t.Fatalf("%v: step %v severity %v, expect %v", c.name, i, ev.Severity, maxSev)
+			}
+			if ev.State == AlertResolved {
+				if !ev.EndsAt.Equal(now) {
+					t.Fatalf("%v: step %v ends at %v, expect %v", c.name, i, ev.EndsAt, now)
+				}
+			} else if !ev.EndsAt.IsZero() {
+				t.Fatalf("%v: step %v the firing incident ends at %v", c.name, i, ev.EndsAt)
+			}
+		}
+	}
+}
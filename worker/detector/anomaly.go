@@ -0,0 +1,120 @@
+package detector
+
+import (
+	"math"
+	"time"
+
+	"code.byted.org/microservice/tsad/common"
+	"code.byted.org/microservice/tsad/worker/ts"
+)
+
+// Anomaly an anomalous point detected by the model, it is recorded by Plugins.RecordAnomaly
+type Anomaly struct {
+	Stamp    time.Time
+	Observed float64
+	Lower    float64
+	Upper    float64
+	Score    float64         // see AnomalyScore
+	Severity common.Severity // by the SeverityThresholds of the task
+	Model    string
+
+	// the incident of the ts when the point is detected, empty if there is none
+	IncidentID string
+}
+
+/*
+AnomalyScore 点偏离预测区间的程度, 以区间半宽为单位;
+	在区间内为0, 刚好超过上界一个半宽为1;
+	区间宽度为0时以|bound|为单位, bound也为0时以1为单位;
+*/
+func AnomalyScore(lower, upper, observed float64) float64 {
+	var dev, bound float64
+	switch {
+	case observed > upper:
+		dev, bound = observed-upper, upper
+	case observed < lower:
+		dev, bound = lower-observed, lower
+	default:
+		return 0
+	}
+
+	spread := (upper - lower) / 2
+	if spread <= 0 || math.IsNaN(spread) {
+		spread = math.Abs(bound)
+	}
+	if spread == 0 {
+		spread = 1
+	}
+	return dev / spread
+}
+
+/*
+anomalous 返回点的AnomalyScore, 以及按task的配置点是否异常;
+	score不低于SeverityThresholds.Info, 并且超出区间的幅度同时超过AlertSensitive*|bound|和AlertMinDeviation;
+*/
+func anomalous(conf *common.TaskConfig, lower, upper, observed float64) (float64, bool) {
+	score := AnomalyScore(lower, upper, observed)
+	if score <= 0 || score < conf.SeverityThresholds.Info {
+		return score, false
+	}
+	dev, bound := observed-upper, upper
+	if observed < lower {
+		dev, bound = lower-observed, lower
+	}
+	return score, dev > math.Abs(bound*conf.AlertSensitive) && dev > conf.AlertMinDeviation
+}
+
+// newAnomalies filters the anomalous points which haven't been recorded
+func (ts *TimeSeries) newAnomalies(points ts.Points) ts.Points {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	fresh := points[:0:0]
+	for _, p := range points {
+		if p.Stamp().After(ts.anomalyStamp) {
+			fresh = append(fresh, p)
+			ts.anomalyStamp = p.Stamp()
+		}
+	}
+	return fresh
+}
+
+// alertIncident returns the incident which is pending or firing
+func (ts *TimeSeries) alertIncident() string {
+	ts.lock.RLock()
+	defer ts.lock.RUnlock()
+	if ts.alert.state == AlertPending || ts.alert.state == AlertFiring {
+		return ts.alert.incidentID
+	}
+	return ""
+}
+
+// recordAnomalies records the new anomalous points by Plugins.RecordAnomaly
+func (d *detector) recordAnomalies(t *Task, s *TimeSeries, m TSModel, points ts.Points) {
+	if d.O.P.RecordAnomaly == nil {
+		return
+	}
+	points = s.newAnomalies(points)
+	if len(points) == 0 {
+		return
+	}
+
+	incident := s.alertIncident()
+	anomalies := make([]*Anomaly, 0, len(points))
+	for _, p := range points {
+		lower, upper := m.ForecastInterval(p.Stamp())
+		score := AnomalyScore(lower, upper, p.Value())
+		anomalies = append(anomalies, &Anomaly{
+			Stamp:      p.Stamp(),
+			Observed:   p.Value(),
+			Lower:      lower,
+			Upper:      upper,
+			Score:      score,
+			Severity:   t.Configs.SeverityThresholds.Of(score),
+			Model:      m.Name(),
+			IncidentID: incident,
+		})
+	}
+	if err := d.O.P.RecordAnomaly(t, s, anomalies); err != nil {
+		d.logger.Errorf("ts=%v, record %v anomalies err: %v", s.Name(), len(anomalies), err)
+	}
+}
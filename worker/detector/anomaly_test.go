@@ -0,0 +1,36 @@
+package detector
+
+import (
+	"testing"
+
+	"code.byted.org/microservice/tsad/common"
+)
+
+func TestAnomalous(t *testing.T) {
+	def := common.DefaultTaskConfig()
+	exact := common.DefaultTaskConfig()
+	exact.AlertMinDeviation = 0
+	strict := common.DefaultTaskConfig()
+	strict.SeverityThresholds.Info = 30
+
+	cases := []struct {
+		conf                   *common.TaskConfig
+		lower, upper, observed float64
+		score                  float64
+		bad                    bool
+	}{
+		{def, 90, 100, 95, 0, false},
+		{def, 90, 100, 140, 8, false}, // less than alert_sensitive*|upper|
+		{def, 90, 100, 200, 20, true},
+		{def, 100, 120, 20, 8, true},
+		{def, 0, 4, 9, 2.5, false}, // less than alert_min_deviation
+		{exact, 0, 4, 9, 2.5, true},
+		{strict, 90, 100, 200, 20, false}, // less than the info threshold
+	}
+	for i, c := range cases {
+		score, bad := anomalous(c.conf, c.lower, c.upper, c.observed)
+		if score != c.score || bad != c.bad {
+			t.Fatalf("case %v: got score %v, bad %v, expect %v, %v", i, score, bad, c.score, c.bad)
+		}
+	}
+}
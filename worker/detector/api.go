@@ -39,6 +39,7 @@ func Start(op *Options) error {
 		contexts:  make(map[string]context.Context),
 		cancels:   make(map[string]func()),
 		exit:      make(chan struct{}),
+		gate:      newAlertGate(op.AlertRateLimit),
 		logger:    utils.NewLogger("detector"),
 		metricser: utils.NewDefaultMetricser(),
 	}
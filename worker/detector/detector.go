@@ -16,6 +16,13 @@ import (
 const (
 	_DefaultTaskLeaseDuration = time.Minute * 30
 
+	// _ModelExpiration a stored model older than it will be retrained instead of recovered
+	_ModelExpiration = time.Hour * 24
+	// _OnlineModelExpiration an OnlineTSModel is updated by the latest points, so it expires later
+	_OnlineModelExpiration = time.Hour * 24 * 6
+	// _StoreOnlineModelInterval store the updated OnlineTSModel at this interval
+	_StoreOnlineModelInterval = time.Hour
+
 	_STATUS_INIT    = iota
 	_STATUS_STARTED
 	_STATUS_STOPPED
@@ -25,6 +32,13 @@ const (
 type Options struct {
 	MaxTasks int
 
+	// LongestPeriod the longest period of the time-series,
+	//  the default training data should cover it
+	LongestPeriod time.Duration
+
+	// AlertRateLimit max incidents notified per hour of all the tasks, 0 for unlimited
+	AlertRateLimit int
+
 	P          *Plugins
 	TaskLeaser TaskLeaser
 }
@@ -38,6 +52,7 @@ type detector struct {
 	cancels  map[string]func()
 	status   int
 	exit     chan struct{}
+	gate     *alertGate
 	lock     sync.RWMutex
 
 	// dependency
@@ -237,13 +252,16 @@ func (d *detector) processTS(t *Task, s *TimeSeries) (normal bool) {
 	// recover model from stored data
 	recovered := false
 	var model TSModel
+	var trainedAt time.Time
 	if name, data, stamp, err := d.O.P.ReadModelData(s.DataSource); err == nil {
-		expiration := time.Hour * 24
-		if stamp.Add(expiration).After(time.Now()) {
+		if stamp.Add(_OnlineModelExpiration).After(time.Now()) {
 			model, err = d.O.P.RecoverModel(name, []byte(data))
 			if err == nil {
-				recovered = true
-				d.metricser.EmitCounter("detector.recover.succ", 1, nil)
+				if stamp.Add(modelExpiration(model)).After(time.Now()) {
+					recovered = true
+					trainedAt = stamp
+					d.metricser.EmitCounter("detector.recover.succ", 1, nil)
+				}
 			} else {
 				d.logger.Errorf("ts=%v, recover model %v err: %v", t.Name, s.Name(), name, err)
 				d.metricser.EmitCounter("detector.recover.err", 1, nil)
@@ -265,7 +283,10 @@ func (d *detector) processTS(t *Task, s *TimeSeries) (normal bool) {
 			return false
 		}
 		end := time.Now()
-		trainingDataLength := getInt(t.Configs, "training_data_length", 3) // day
+		trainingDataLength := t.Configs.TrainingDataLength // day
+		if trainingDataLength == 0 {
+			trainingDataLength = d.defaultTrainingDays()
+		}
 		begin := end.Add(-time.Hour * 24 * time.Duration(trainingDataLength))
 		tsData, err := d.O.P.FetchFromTo(context.Background(), s, begin, end)
 		if err != nil {
@@ -295,7 +316,9 @@ func (d *detector) processTS(t *Task, s *TimeSeries) (normal bool) {
 		}
 
 		// train model
-		model, err = d.O.P.Train(tsData, d.O.P.ModelAdapter)
+		var scores []ModelScore
+		model, scores, err = d.O.P.Train(tsData, d.O.P.ModelAdapter, NewTrainOption(t.Configs))
+		s.SetModelScores(scores)
 		if err != nil {
 			d.logger.Errorf("ts=%v, train model err=%v", s.Name(), err)
 			d.metricser.EmitCounter("detector.train.err", 1, nil)
@@ -310,14 +333,8 @@ func (d *detector) processTS(t *Task, s *TimeSeries) (normal bool) {
 		}
 
 		// store this model
-		data, err := model.ModelData()
-		if err != nil {
-			d.logger.Errorf("ts=%v, model %v data err: %v", s.Name(), model.Name(), err)
-		} else {
-			if err := d.O.P.StoreModelData(s.DataSource, model.Name(), string(data), time.Now()); err != nil {
-				d.logger.Errorf("ts=%v, store model(%v) data err: %v", s.Name(), model.Name(), err)
-			}
-		}
+		trainedAt = time.Now()
+		d.storeModel(s, model, trainedAt)
 	}
 
 	if d.taskHasDone(t) {
@@ -325,30 +342,109 @@ func (d *detector) processTS(t *Task, s *TimeSeries) (normal bool) {
 	}
 
 	d.metricser.EmitCounter("detector.process.succ", 1, nil)
-	return d.monitor(t, s)
+	return d.monitor(t, s, trainedAt)
+}
+
+func (d *detector) storeModel(s *TimeSeries, model TSModel, trainedAt time.Time) {
+	data, err := model.ModelData()
+	if err != nil {
+		d.logger.Errorf("ts=%v, model %v data err: %v", s.Name(), model.Name(), err)
+		return
+	}
+	if err := d.O.P.StoreModelData(s.DataSource, model.Name(), string(data), trainedAt); err != nil {
+		d.logger.Errorf("ts=%v, store model(%v) data err: %v", s.Name(), model.Name(), err)
+	}
+}
+
+// modelExpiration .
+func modelExpiration(model TSModel) time.Duration {
+	if _, ok := model.(OnlineTSModel); ok {
+		return _OnlineModelExpiration
+	}
+	return _ModelExpiration
+}
+
+/*
+feedLatest 将检查过的正常点喂给OnlineTSModel;
+	为了不影响同时在使用该模型的ForecastInterval等接口, 先通过Clone复制模型,
+	更新后再替换ts的模型;
+*/
+func (d *detector) feedLatest(s *TimeSeries, model TSModel, points ts.Points) (TSModel, error) {
+	online, ok := model.(OnlineTSModel)
+	if !ok {
+		return nil, fmt.Errorf("model %v is not online", model.Name())
+	}
+
+	copied := online.Clone()
+	copied.FeedLatest(points)
+	s.SetModel(copied)
+	return copied, nil
 }
 
-func (d *detector) monitor(t *Task, s *TimeSeries) (normal bool) {
+// defaultTrainingDays at least 3 days, and 2 more days than the longest period,
+//  because the decomposition loses half a period at both ends
+func (d *detector) defaultTrainingDays() int {
+	days := 3
+	day := time.Hour * 24
+	if d.O.LongestPeriod > 0 {
+		need := int((d.O.LongestPeriod+day-1)/day) + 2
+		if need > days {
+			days = need
+		}
+	}
+	return days
+}
+
+func (d *detector) monitor(t *Task, s *TimeSeries, trainedAt time.Time) (normal bool) {
 	s.SetState(TSMonitor)
 	m := s.Model()
 
 	beginAt := time.Now()
 	min := time.Hour * 24 // half day
 	max := time.Hour * 36 // one day
-	retrain := time.Duration(rand.Intn(int(max-min))) + min
+	_, online := m.(OnlineTSModel)
+	if online {
+		// the online model expires when it will be retrained, so it won't be recovered
+		min = _OnlineModelExpiration
+		max = _OnlineModelExpiration + time.Hour*24
+	}
+	retrain := time.Duration(rand.Intn(int(max-min))) + min // since trainedAt
+	lastFed := beginAt
+	lastStored := beginAt
 
-	checkFreqMin := getInt(t.Configs, "check_freq_min", 5)
-	consAlert := 0
-	for range time.Tick(time.Minute * time.Duration(checkFreqMin)) {
+	var arrival <-chan struct{}
+	if d.O.P.Arrival != nil {
+		arrival = d.O.P.Arrival(s.DataSource)
+	}
+
+	checkFreq := time.Minute * time.Duration(t.Configs.CheckFreqMin)
+	ticker := time.NewTicker(checkFreq)
+	defer ticker.Stop()
+	var alertSince time.Time // the first alert of the consecutive alerts
+	var lastChecked time.Time
+	for {
+		select {
+		case <-ticker.C:
+		case <-arrival:
+			// 到达触发的检查最多每checkFreq一次, 并推迟下一次tick
+			if time.Now().Sub(lastChecked) < checkFreq {
+				continue
+			}
+			ticker.Reset(checkFreq)
+		}
+		lastChecked = time.Now()
 		if d.taskHasDone(t) {
+			if ev := s.AlertResolve(); ev != nil {
+				d.notify(t, s, ev)
+			}
 			return false
 		}
 
-		if time.Now().Sub(beginAt) > retrain {
+		if time.Now().Sub(trainedAt) > retrain {
 			return true // let it retrain
 		}
 
-		checkDataMin := getInt(t.Configs, "check_data_min", 8)
+		checkDataMin := t.Configs.CheckDataMin
 		latestData, err := d.O.P.FetchFromTo(context.Background(), s, time.Now().Add(-time.Minute*time.Duration(checkDataMin)), time.Now())
 		if err != nil {
 			d.logger.Errorf("ts=%v, fetch latest data when monitor err=%v", s.Name(), err)
@@ -362,33 +458,59 @@ func (d *detector) monitor(t *Task, s *TimeSeries) (normal bool) {
 
 		badPoints := 0
 		var latestBad ts.Point
-		alertSensitive := getFloat64(t.Configs, "alert_sensitive", 0.5)
+		var badList, normalPoints ts.Points
+		minScore := math.Inf(1) // the score of the mildest anomalous point
 		for _, p := range latestData.Points() {
 			lower, upper := m.ForecastInterval(p.Stamp())
-			if (p.Value() > upper+math.Abs(upper*alertSensitive) &&
-				p.Value()-upper > 10) ||
-				(p.Value() < lower-math.Abs(lower*alertSensitive) &&
-					lower-p.Value() > 10) {
+			if score, bad := anomalous(t.Configs, lower, upper, p.Value()); bad {
 				badPoints++
 				latestBad = p
+				badList = append(badList, p)
+				minScore = math.Min(minScore, score)
+			} else if p.Stamp().After(lastFed) {
+				normalPoints = append(normalPoints, p)
+			}
+		}
+
+		// 只用正常的点更新模型, 避免异常被模型吸收
+		if online && len(normalPoints) > 0 {
+			fed, err := d.feedLatest(s, m, normalPoints)
+			if err != nil {
+				d.logger.Errorf("ts=%v, feed latest points err: %v", s.Name(), err)
+			} else {
+				m = fed
+				lastFed = normalPoints[len(normalPoints)-1].Stamp()
+				if time.Now().Sub(lastStored) > _StoreOnlineModelInterval {
+					d.storeModel(s, m, trainedAt)
+					lastStored = time.Now()
+				}
 			}
 		}
 
+		var ev *AlertEvent
 		if badPoints == latestData.N() {
+			// all the points are anomalous, so the check is as severe as the mildest one
 			lower, upper := m.ForecastInterval(latestBad.Stamp())
-			d.O.P.Alert(t, s, lower, upper, latestBad)
-			consAlert++
+			sev := t.Configs.SeverityThresholds.Of(minScore)
+			ev = s.AlertBad(t.Configs.AlertPendingChecks, sev, minScore, lower, upper, latestBad)
+			if alertSince.IsZero() {
+				alertSince = time.Now()
+			}
 		} else {
-			consAlert = 0
+			ev = s.AlertGood(t.Configs.AlertResolveChecks)
+			alertSince = time.Time{}
+		}
+		if ev != nil {
+			d.notify(t, s, ev)
+		}
+		if len(badList) > 0 {
+			d.recordAnomalies(t, s, m, badList)
 		}
 
-		if consAlert * checkFreqMin > 15 {
+		if !alertSince.IsZero() && time.Now().Sub(alertSince) >= time.Minute*15 {
 			return true // 如果长时间异常, 我们认为是模型数据不够充分, 自动重新训练
 		}
 	}
-
-	// assert(false)
-	return false
 }
 
 func (d *detector) ForecastInterval(name string, stamps []time.Time) ([]*ForecastTS, error) {
@@ -6,13 +6,22 @@ import (
 	"time"
 
 	"code.byted.org/collect/grass/pkg/util"
+	"code.byted.org/microservice/tsad/common"
 	"sync"
 )
 
 type DataSourceType string
 
 const (
-	DataSourceTypeTSDB = "tsdb"
+	DataSourceTypeTSDB       = "tsdb"
+	DataSourceTypePrometheus = "prometheus"
+	DataSourceTypeInfluxDB   = "influxdb"
+	DataSourceTypeGraphite   = "graphite"
+	DataSourceTypePush       = "push" // the points are pushed by the ingest APIs
+	DataSourceTypeFile       = "file" // Key is the path or glob of the local CSV/JSON-lines files
+	DataSourceTypeSQL        = "sql"  // Key is a query returning (timestamp, value[, dimension...])
+	DataSourceTypeExpr       = "expr" // Key is an expression over the data sources in Extra, such as a / b * 100
+	DataSourceTypeHTTP       = "http" // Key is a url template, Extra describes how to extract the points from the JSON
 )
 
 type DataSource struct {
@@ -47,7 +56,7 @@ type TaskMeta struct {
 
 type TaskRuntime struct {
 	// these fields are created when init and immutable
-	Configs map[string]interface{}
+	Configs *common.TaskConfig
 
 	// these fields protected by lock
 	state    TaskState
@@ -104,17 +113,15 @@ type Task struct {
 }
 
 func newTask(meta TaskMeta) (*Task, error) {
-	confMap := make(map[string]interface{})
-	if meta.Config != "" {
-		if err := json.Unmarshal([]byte(meta.Config), confMap); err != nil {
-			return nil, fmt.Errorf("invalid config")
-		}
+	conf, err := common.ParseTaskConfig(meta.Config)
+	if err != nil {
+		return nil, err
 	}
 
 	return &Task{
 		TaskMeta: meta,
 		TaskRuntime: TaskRuntime{
-			Configs: confMap,
+			Configs: conf,
 			state:   TaskInit,
 			tss:     make(map[string]*TimeSeries),
 		},
@@ -160,12 +167,15 @@ type TimeSeries struct {
 	DerivedHost string
 
 	// runtime information
-	state      TSState
-	model      TSModel
-	err        error
-	errStamp   time.Time
-	detectedAt time.Time
-	lock       sync.RWMutex
+	state        TSState
+	model        TSModel
+	scores       []ModelScore // scores of the candidate models when the model was trained
+	err          error
+	errStamp     time.Time
+	detectedAt   time.Time
+	alert        alertTracker // kept when the ts is retrained
+	anomalyStamp time.Time    // the latest recorded anomaly
+	lock         sync.RWMutex
 }
 
 func (ts *TimeSeries) State() TSState {
@@ -192,6 +202,18 @@ func (ts *TimeSeries) Model() TSModel {
 	return ts.model
 }
 
+func (ts *TimeSeries) SetModelScores(scores []ModelScore) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	ts.scores = scores
+}
+
+func (ts *TimeSeries) ModelScores() []ModelScore {
+	ts.lock.RLock()
+	defer ts.lock.RUnlock()
+	return ts.scores
+}
+
 func (ts *TimeSeries) SetErr(err error) {
 	ts.lock.Lock()
 	defer ts.lock.Unlock()
@@ -210,6 +232,7 @@ func (ts *TimeSeries) Reset() {
 	defer ts.lock.Unlock()
 	ts.state = TSInit
 	ts.model = nil
+	ts.scores = nil
 	ts.err = nil
 	ts.errStamp = time.Unix(0, 0)
 }
@@ -223,15 +246,27 @@ func (ts *TimeSeries) Clear() {
 func (ts *TimeSeries) MarshalJSON() ([]byte, error) {
 	ts.lock.RLock()
 	defer ts.lock.RUnlock()
+
+	model := ""
+	if ts.model != nil {
+		model = ts.model.Name()
+	}
+	errMsg := ""
+	if ts.err != nil {
+		errMsg = ts.err.Error()
+	}
 	return json.Marshal(map[string]interface{}{
 		"task_name":        ts.TaskName,
 		"data_source":      ts.DataSource,
 		"derived_at":       ts.DerivedAt,
-		"state":            ts.State,
-		"model":            ts.model.Name(),
-		"last_error":       ts.err,
+		"derived_host":     ts.DerivedHost,
+		"state":            ts.state,
+		"model":            model,
+		"model_scores":     ts.scores,
+		"last_error":       errMsg,
 		"last_error_stamp": ts.errStamp,
-		"last_detect_at":   ts.detectedAt,
+		"last_detected_at": ts.detectedAt,
+		"alert":            ts.alert.toJSON(),
 	})
 }
 
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"code.byted.org/microservice/tsad/common"
 	"code.byted.org/microservice/tsad/worker/ts"
 )
 
@@ -22,8 +23,52 @@ type TSModel interface {
 	ModelData() ([]byte, error)
 	Recover(data []byte) error
 	// SourceData() ts.TS
-	// FeedLatest(points ts.Points)        // append the latest points to this model
-	// Retrain(adapter ModelAdapter) error // retrain this model after feed some latest points
+}
+
+// OnlineTSModel a TSModel which can be updated incrementally by the latest points,
+//  so it needs to be retrained rarely
+type OnlineTSModel interface {
+	TSModel
+	// FeedLatest update this model by the normal points which are checked by the detector,
+	//  the points are sorted and newer than the points fed before
+	FeedLatest(points ts.Points)
+	// Clone returns a copy which can be fed without changing this model,
+	//  this model may be being used by ForecastInterval concurrently
+	Clone() OnlineTSModel
+}
+
+// TunableTSModel a TSModel whose hyper-parameters can be set by the task configs,
+//  SetParams is called before Train
+type TunableTSModel interface {
+	TSModel
+	SetParams(params map[string]float64) error
+}
+
+// TrainOption options of training a time-series, from the task configs
+type TrainOption struct {
+	Picker string                        // name of the model picker, use the default picker if empty
+	Models []string                      // names of the candidate models, use tstrain.DefaultModels if empty
+	Params map[string]map[string]float64 // [model name]params, see TunableTSModel
+}
+
+// NewTrainOption .
+func NewTrainOption(c *common.TaskConfig) *TrainOption {
+	op := &TrainOption{
+		Picker: c.ModelPicker,
+		Models: c.Models,
+		Params: c.ModelParams,
+	}
+	if c.Model != "" {
+		op.Models = []string{c.Model}
+	}
+	return op
+}
+
+// ModelScore the score of a candidate model given by the model picker, smaller is better
+type ModelScore struct {
+	Model string  `json:"model"`
+	Score float64 `json:"score"`
+	Err   string  `json:"error,omitempty"` // the model can't be trained or evaluated
 }
 
 // Plugins .
@@ -43,8 +88,12 @@ type Plugins struct {
 	// funcs for fetching time-series data
 	FetchFromTo func(ctx context.Context, ts *TimeSeries, from, to time.Time) (ts.TS, error)
 
+	// Arrival optional, returns a chan which is notified when the latest points of src arrive,
+	//  so the detector checks them on arrival instead of waiting the tick; nil if src is pulled
+	Arrival func(src DataSource) <-chan struct{}
+
 	// train model from this data
-	Train          func(data ts.TS, adapter ModelAdapter) (TSModel, error)
+	Train          func(data ts.TS, adapter ModelAdapter, op *TrainOption) (TSModel, []ModelScore, error)
 	StoreModelData func(src DataSource, mname, data string, trainStamp time.Time) error
 	ReadModelData  func(src DataSource) (mname, data string, trainStamp time.Time, err error)
 	RecoverModel   func(mname string, data []byte) (TSModel, error)
@@ -55,8 +104,14 @@ type Plugins struct {
 	// ModelAdapter .
 	ModelAdapter ModelAdapter
 
-	// alert anomaly for this point in the time-series
-	Alert func(t *Task, ts *TimeSeries, lower, upper float64, ob ts.Point)
+	// notify the firing or resolved incident of the time-series
+	Alert func(t *Task, ts *TimeSeries, ev *AlertEvent)
+
+	// Silences optional, the silences checked before an incident is notified by Alert
+	Silences func() []*common.Silence
+
+	// RecordAnomaly optional, records the anomalous points of the time-series, each point once
+	RecordAnomaly func(t *Task, ts *TimeSeries, anomalies []*Anomaly) error
 }
 
 // Valid .
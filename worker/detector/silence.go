@@ -0,0 +1,36 @@
+package detector
+
+import (
+	"strings"
+
+	"code.byted.org/microservice/tsad/common"
+)
+
+/*
+SourceTags 返回DataSource的tags, 用于匹配common.Silence;
+	Extra为{a=b,c="d"}形式时解析其中的tag, 其他形式的Extra没有tag;
+	另外包含__type__和__key__;
+*/
+func SourceTags(src DataSource) map[string]string {
+	tags := map[string]string{
+		common.SilenceTagType: string(src.Type),
+		common.SilenceTagKey:  src.Key,
+	}
+	extra := strings.TrimSpace(src.Extra)
+	if !strings.HasPrefix(extra, "{") || !strings.HasSuffix(extra, "}") {
+		return tags
+	}
+	for _, kv := range strings.Split(extra[1:len(extra)-1], ",") {
+		i := strings.Index(kv, "=")
+		if i <= 0 {
+			continue
+		}
+		k := strings.TrimSpace(kv[:i])
+		v := strings.Trim(strings.TrimSpace(kv[i+1:]), `"'`)
+		if strings.HasSuffix(k, "!") || strings.HasSuffix(k, "=") || strings.HasPrefix(v, "~") {
+			continue // not an equality
+		}
+		tags[k] = v
+	}
+	return tags
+}
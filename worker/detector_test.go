@@ -0,0 +1,162 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"code.byted.org/microservice/tsad/worker/detector"
+	"code.byted.org/microservice/tsad/worker/tsfetcher"
+)
+
+func TestLegacyBackends(t *testing.T) {
+	cases := []struct {
+		conf  Config
+		names []string
+	}{
+		{Config{}, []string{"tsdb", "push", "expr"}},
+		{Config{PrometheusAPI: "http://prom", GraphiteAPI: "http://graphite"}, []string{"tsdb", "push", "expr", "prometheus", "graphite"}},
+		{Config{InfluxDBAPI: "http://influx", FileRoot: "/data", SQLDSN: "root@/metrics"}, []string{"tsdb", "push", "expr", "influxdb", "file", "sql"}},
+		{Config{HTTPAllowedHosts: []string{"a.host", "b.host"}}, []string{"tsdb", "push", "expr", "http"}},
+	}
+	for i, c := range cases {
+		confs := legacyBackends(&c.conf)
+		names := make([]string, 0, len(confs))
+		for _, conf := range confs {
+			if conf.Name != conf.Type {
+				t.Fatalf("case %v: backend %v of type %v", i, conf.Name, conf.Type)
+			}
+			names = append(names, conf.Name)
+		}
+		if !reflect.DeepEqual(names, c.names) {
+			t.Fatalf("case %v: backends %v, expect %v", i, names, c.names)
+		}
+	}
+
+	confs := legacyBackends(&Config{PushCapacity: 100, PushMaxSeries: 10, HTTPAllowedHosts: []string{"a.host", "b.host"}})
+	if opts := confs[1].Options; opts["capacity"] != "100" || opts["max_series"] != "10" {
+		t.Fatalf("push options %v", opts)
+	}
+	if opts := confs[3].Options; opts["allowed_hosts"] != "a.host,b.host" {
+		t.Fatalf("http options %v", opts)
+	}
+}
+
+func TestInitFetchers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsad_worker_backends")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the points of the last hour, for the file backends
+	now := time.Now().Truncate(time.Minute)
+	buf := "timestamp,value\n"
+	for i := 60; i > 0; i-- {
+		buf += fmt.Sprintf("%v,%v\n", now.Add(-time.Minute*time.Duration(i)).Unix(), i)
+	}
+	for _, sub := range []string{"legacy", "named"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, sub, "cpu.csv"), []byte(buf), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		backends []BackendConfig
+		types    map[string]tsfetcher.SourceType // the expected backends
+		err      string
+	}{
+		{
+			types: map[string]tsfetcher.SourceType{
+				"tsdb": tsfetcher.SourceTSDB,
+				"push": tsfetcher.SourcePush,
+				"expr": tsfetcher.SourceExpr,
+				"file": tsfetcher.SourceFile,
+			},
+		},
+		{
+			backends: []BackendConfig{
+				{Name: "tsdb_backup", Type: "tsdb", API: "http://tsdb.backup", Timeout: 1000},
+				{Name: "logs", Type: "file", API: filepath.Join(dir, "named"), Step: 60},
+			},
+			types: map[string]tsfetcher.SourceType{
+				"tsdb":        tsfetcher.SourceTSDB,
+				"tsdb_backup": tsfetcher.SourceTSDB,
+				"push":        tsfetcher.SourcePush,
+				"expr":        tsfetcher.SourceExpr,
+				"file":        tsfetcher.SourceFile,
+				"logs":        tsfetcher.SourceFile,
+			},
+		},
+		{
+			backends: []BackendConfig{{Type: "tsdb"}},
+			err:      "the name of the tsdb backend can not be null",
+		},
+		{
+			backends: []BackendConfig{{Name: "metrics", Type: "opentsdb"}},
+			err:      "init backend metrics",
+		},
+		{
+			backends: []BackendConfig{{Name: "push", Type: "tsdb", Timeout: 1000}}, // the ingest APIs need a push backend
+			err:      "backend push should be a push backend",
+		},
+	}
+	for i, c := range cases {
+		storeDir, err := ioutil.TempDir(dir, "middle_store")
+		if err != nil {
+			t.Fatal(err)
+		}
+		config = &Config{
+			MiddleStoreDir: storeDir,
+			TSDBTimeout:    1000,
+			FileRoot:       filepath.Join(dir, "legacy"),
+			FileFrequency:  60,
+			Backends:       c.backends,
+		}
+		backends = make(map[string]*backend)
+		pushFetcher = nil
+
+		err = initFetchers()
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Fatalf("case %v: err %v, expect %v", i, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("case %v: %v", i, err)
+		}
+		if len(backends) != len(c.types) {
+			t.Fatalf("case %v: %v backends, expect %v", i, len(backends), len(c.types))
+		}
+		for name, typ := range c.types {
+			b, src, err := dataSource2FetcherSource(detector.DataSource{Type: detector.DataSourceType(name), Key: "cpu"})
+			if err != nil {
+				t.Fatalf("case %v: %v", i, err)
+			}
+			if b.typ != typ || src.Type != typ || src.Key != "cpu" {
+				t.Fatalf("case %v: backend %v is %v, source %+v, expect %v", i, name, b.typ, src, typ)
+			}
+			if typ != tsfetcher.SourceFile {
+				continue
+			}
+			tms := &detector.TimeSeries{DataSource: detector.DataSource{Type: detector.DataSourceType(name), Key: "cpu.csv"}}
+			data, err := FetchFromTo(context.Background(), tms, now.Add(-time.Hour), now)
+			if err != nil || data.N() == 0 {
+				t.Fatalf("case %v: fetch from %v, %v points, err: %v", i, name, data, err)
+			}
+		}
+		if _, _, err := dataSource2FetcherSource(detector.DataSource{Type: "opentsdb"}); err == nil {
+			t.Fatalf("case %v: unknown backend is resolved", i)
+		}
+	}
+}
@@ -86,7 +86,7 @@ func (mdl *MysqlDistLocker) LockLease(key string, lease time.Duration) error {
 		key,
 		time.Now())
 
-	logs.Debugf("[MysqlDistLocker] LockLease: ", mdl.leaseSQL,
+	logs.Debugf("[MysqlDistLocker] LockLease: %v, %v, %v, %v, %v", mdl.leaseSQL,
 		mdl.op.Identity,
 		time.Now().Add(lease),
 		key,
@@ -116,14 +116,14 @@ func (mdl *MysqlDistLocker) RenewalLease(key string, lease time.Duration) error
 		mdl.op.Identity,
 		now)
 
-	logs.Debug("[MysqlDistLocker] RenewalLease: ", mdl.renewalSQL,
+	logs.Debug("[MysqlDistLocker] RenewalLease: %v, %v, %v, %v, %v", mdl.renewalSQL,
 		newExp,
 		key,
 		mdl.op.Identity,
 		now)
 
 	if err != nil {
-		logs.Debug("[MysqlDistLocker] RenewalLease: ", mdl.renewalSQL,
+		logs.Debug("[MysqlDistLocker] RenewalLease: %v, %v, %v, %v, %v, err: %v", mdl.renewalSQL,
 			newExp,
 			key,
 			mdl.op.Identity,
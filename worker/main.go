@@ -24,6 +24,10 @@ func Start(c *Config) error {
 	if err := initFetchers(); err != nil {
 		return err
 	}
+	if err := initAlertSinks(); err != nil {
+		return err
+	}
+	startSilenceSyncer()
 	if err := startDetector(); err != nil {
 		return err
 	}
@@ -45,6 +49,8 @@ func Start(c *Config) error {
 		det.POST("forecast_task", ForecastTask)
 		det.POST("retrain_task", RetrainTask)
 		det.GET("summary", Summary)
+		det.POST("ingest", Ingest)
+		det.POST("ingest_line", IngestLine)
 	}
 
 	go func() {
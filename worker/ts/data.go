@@ -1,6 +1,9 @@
 package ts
 
-import "time"
+import (
+	"sort"
+	"time"
+)
 
 // Point represent a point in a TS
 type Point interface {
@@ -71,8 +74,44 @@ const UnknownOrInvalid = 0
 
 // Attributes attributes for this TS
 type Attributes struct {
-	Frequency time.Duration // points[i+1].Stamp() - points[i].Stamp()
-	Period    time.Duration // period of this TS
+	Frequency time.Duration   // points[i+1].Stamp() - points[i].Stamp()
+	Period    time.Duration   // period of this TS, the shortest one if there are several periods
+	Periods   []time.Duration // all periods of this TS, such as [1day, 1week], Period is used if empty
+}
+
+// AllPeriods returns all valid periods in ascending order
+func (attr Attributes) AllPeriods() []time.Duration {
+	periods := make([]time.Duration, 0, len(attr.Periods)+1)
+	if attr.Period != UnknownOrInvalid {
+		periods = append(periods, attr.Period)
+	}
+	for _, p := range attr.Periods {
+		if p == UnknownOrInvalid {
+			continue
+		}
+		exist := false
+		for _, q := range periods {
+			if p == q {
+				exist = true
+			}
+		}
+		if !exist {
+			periods = append(periods, p)
+		}
+	}
+	sort.Slice(periods, func(i, j int) bool {
+		return periods[i] < periods[j]
+	})
+	return periods
+}
+
+// LongestPeriod .
+func (attr Attributes) LongestPeriod() time.Duration {
+	periods := attr.AllPeriods()
+	if len(periods) == 0 {
+		return UnknownOrInvalid
+	}
+	return periods[len(periods)-1]
 }
 
 // TS represent a time-series
@@ -80,6 +119,7 @@ type TS interface {
 	Attributes() Attributes
 	Frequency() time.Duration
 	Period() time.Duration
+	Periods() []time.Duration
 	Points() Points
 	GetPoint(stamp time.Time) (Point, bool)
 	GetPoints(begin, end time.Time) Points
@@ -98,6 +138,10 @@ type ts struct {
 // NewTS .
 func NewTS(attr Attributes, points Points) TS {
 	at := attr
+	if len(attr.Periods) > 0 {
+		at.Periods = make([]time.Duration, len(attr.Periods))
+		copy(at.Periods, attr.Periods)
+	}
 	ps := make(Points, len(points))
 	copy(ps, points)
 	return ts{at, ps}
@@ -139,6 +183,11 @@ func (ts ts) Period() time.Duration {
 	return ts.attr.Period
 }
 
+// Periods all periods in ascending order
+func (ts ts) Periods() []time.Duration {
+	return ts.attr.AllPeriods()
+}
+
 // Points .
 func (ts ts) Points() Points {
 	points := make(Points, len(ts.points))
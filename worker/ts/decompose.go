@@ -6,7 +6,41 @@ import (
 )
 
 // ClassicalDecompose https://www.otexts.org/fpp/6/3
+//  如果data有多个周期, s为各个周期季节项之和, 参见ClassicalMultiDecompose;
 func ClassicalDecompose(data TS) (s, t, e TS, err error) {
+	s, seasons, t, e, err := ClassicalMultiDecompose(data)
+	if err != nil || len(seasons) == 0 {
+		return s, t, e, err
+	}
+
+	sPs := s.Points()
+	for _, season := range seasons {
+		for i, p := range season.Points() {
+			sPs[i] = NewPoint(p.Stamp(), sPs[i].Value()+p.Value())
+		}
+	}
+	return NewTS(data.Attributes(), sPs), t, e, nil
+}
+
+// ClassicalMultiDecompose .
+//  对data的主周期(最短周期)做经典分解, 得到s, t, e;
+//  然后利用ExtractSeasons从e中提取其他更长周期的季节项seasons([period]季节项), e为剩余残差;
+//  更长周期的季节项使用主周期1/24长度的窗口做平滑, 如日周期对应1小时;
+func ClassicalMultiDecompose(data TS) (s TS, seasons map[time.Duration]TS, t, e TS, err error) {
+	s, t, e, err = classicalDecompose(data)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	periods := data.Periods()
+	if len(periods) > 1 {
+		window := int(data.Period() / data.Frequency() / 24)
+		seasons, e = ExtractSeasons(e, data.Begin(), periods[1:], window)
+	}
+	return s, seasons, t, e, nil
+}
+
+func classicalDecompose(data TS) (s, t, e TS, err error) {
 	if data.Period() == UnknownOrInvalid {
 		return nil, nil, nil, fmt.Errorf("no period")
 	}
@@ -42,7 +76,7 @@ func ClassicalDecompose(data TS) (s, t, e TS, err error) {
 
 	// cal season
 	detrendedTs := NewTS(data.Attributes(), detrendedPs)
-	periodPoints, _ := AggregatePeriodPoints(detrendedTs)
+	periodPoints, _ := AggregatePointsByPeriod(detrendedTs, data.Begin(), data.Period())
 	periodAVG := make(map[time.Duration]float64)
 	for shift, ps := range periodPoints {
 		periodAVG[shift] = AVGPoints(ps)
@@ -0,0 +1,140 @@
+package ts
+
+import (
+	"math"
+	"time"
+)
+
+var (
+	// CommonPeriods 常见的周期, 检测到的周期与其相差不超过5%时, 对齐到该周期
+	CommonPeriods = []time.Duration{
+		time.Minute * 5,
+		time.Minute * 10,
+		time.Minute * 15,
+		time.Minute * 30,
+		time.Hour,
+		time.Hour * 2,
+		time.Hour * 3,
+		time.Hour * 4,
+		time.Hour * 6,
+		time.Hour * 8,
+		time.Hour * 12,
+		time.Hour * 24,
+		time.Hour * 24 * 7,
+	}
+
+	// maxACFPoints 计算自相关前, 将数据按桶求平均, 使点数不超过该值
+	maxACFPoints = 2000
+)
+
+/*
+DetectPeriod 利用自相关函数(ACF)检测TS的周期;
+	1) 补全TS, 按桶求平均降采样, 并用LSFit去掉线性趋势;
+	2) 计算lag在 [1, n/2] 上的ACF, 即至少需要两个完整周期;
+	3) 在ACF第一次穿过0之后, 找到所有的局部极大值;
+	4) 选取lag最小的, ACF不小于最大局部极大值80%的峰, 以避免选到周期的倍数;
+	5) 将lag转换为时长, 并对齐到CommonPeriods;
+
+	返回周期和置信度(该lag的ACF值, 范围[-1, 1]);
+	如果找不到任何峰, 返回UnknownOrInvalid和0;
+*/
+func DetectPeriod(data TS) (time.Duration, float64) {
+	if data.Frequency() == UnknownOrInvalid || data.N() < 8 {
+		return UnknownOrInvalid, 0
+	}
+	if !data.Completed() {
+		data = LastValueComplete(data)
+	}
+
+	vals := data.Values()
+	bucket := (len(vals) + maxACFPoints - 1) / maxACFPoints
+	vals = bucketAVG(vals, bucket)
+	step := data.Frequency() * time.Duration(bucket)
+
+	// detrend
+	xys := make(XYPoints, len(vals))
+	for i, v := range vals {
+		xys[i] = XYPoint{X: float64(i), Y: v}
+	}
+	a, b := LSFit(xys)
+	for i := range vals {
+		vals[i] -= a*float64(i) + b
+	}
+
+	acf := autoCorrelation(vals, len(vals)/2)
+	if acf == nil {
+		return UnknownOrInvalid, 0
+	}
+
+	start := 1
+	for start < len(acf) && acf[start] > 0 {
+		start++
+	}
+
+	var peaks []int
+	maxPeak := math.Inf(-1)
+	for k := start + 1; k < len(acf)-1; k++ {
+		if acf[k] > 0 && acf[k] >= acf[k-1] && acf[k] >= acf[k+1] {
+			peaks = append(peaks, k)
+			maxPeak = math.Max(maxPeak, acf[k])
+		}
+	}
+	if len(peaks) == 0 {
+		return UnknownOrInvalid, 0
+	}
+
+	best := peaks[0]
+	for _, k := range peaks {
+		if acf[k] >= 0.8*maxPeak {
+			best = k
+			break
+		}
+	}
+
+	return snapPeriod(step*time.Duration(best), data.Frequency()), acf[best]
+}
+
+// snapPeriod 对齐到CommonPeriods或者频率的整数倍
+func snapPeriod(period, freq time.Duration) time.Duration {
+	for _, p := range CommonPeriods {
+		if math.Abs(float64(period-p)) <= 0.05*float64(p) && p%freq == 0 {
+			return p
+		}
+	}
+	return (period + freq/2) / freq * freq
+}
+
+// autoCorrelation 计算lag在 [0, maxLag] 上的自相关, vals的均值需要为0
+func autoCorrelation(vals []float64, maxLag int) []float64 {
+	var variance float64
+	for _, v := range vals {
+		variance += v * v
+	}
+	if variance <= 0 || maxLag < 2 {
+		return nil
+	}
+
+	acf := make([]float64, maxLag+1)
+	for k := 0; k <= maxLag; k++ {
+		var sum float64
+		for i := 0; i+k < len(vals); i++ {
+			sum += vals[i] * vals[i+k]
+		}
+		acf[k] = sum / variance
+	}
+	return acf
+}
+
+func bucketAVG(vals []float64, bucket int) []float64 {
+	if bucket <= 1 {
+		results := make([]float64, len(vals))
+		copy(results, vals)
+		return results
+	}
+
+	results := make([]float64, 0, len(vals)/bucket)
+	for i := 0; i+bucket <= len(vals); i += bucket {
+		results = append(results, AVG(vals[i:i+bucket]))
+	}
+	return results
+}
@@ -0,0 +1,60 @@
+package ts
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func genPeriodTS(freq, period, length time.Duration, noise float64) TS {
+	r := rand.New(rand.NewSource(1))
+	begin := time.Unix(1500000000, 0)
+	n := int(length / freq)
+	ps := make(Points, 0, n)
+	for i := 0; i < n; i++ {
+		stamp := begin.Add(freq * time.Duration(i))
+		v := 100 + 0.001*float64(i) + r.NormFloat64()*noise
+		if period != UnknownOrInvalid {
+			v += 10 * math.Sin(2*math.Pi*float64(stamp.Sub(begin))/float64(period))
+		}
+		ps = append(ps, NewPoint(stamp, v))
+	}
+	return NewTS(Attributes{Frequency: freq}, ps)
+}
+
+func TestDetectPeriod(t *testing.T) {
+	cases := []struct {
+		freq   time.Duration
+		period time.Duration
+		length time.Duration
+	}{
+		{time.Second * 30, time.Hour, time.Hour * 24},
+		{time.Second * 30, time.Hour * 6, time.Hour * 24 * 3},
+		{time.Second * 30, time.Hour * 24, time.Hour * 24 * 9},
+		{time.Minute, time.Minute * 90, time.Hour * 12},
+	}
+
+	for _, c := range cases {
+		period, confidence := DetectPeriod(genPeriodTS(c.freq, c.period, c.length, 2))
+		if period != c.period {
+			t.Fatalf("detect period %v, expect %v", period, c.period)
+		}
+		if confidence < 0.5 {
+			t.Fatalf("confidence of %v is too low: %v", c.period, confidence)
+		}
+	}
+}
+
+func TestDetectPeriodNoise(t *testing.T) {
+	period, confidence := DetectPeriod(genPeriodTS(time.Second*30, UnknownOrInvalid, time.Hour*24, 2))
+	if period != UnknownOrInvalid && confidence > 0.2 {
+		t.Fatalf("detect period %v with confidence %v from noise", period, confidence)
+	}
+
+	constant := genPeriodTS(time.Second*30, UnknownOrInvalid, time.Hour, 0)
+	constant = NewTS(constant.Attributes(), Points{NewPoint(time.Unix(0, 0), 1)})
+	if period, _ := DetectPeriod(constant); period != UnknownOrInvalid {
+		t.Fatalf("detect period %v from a single point", period)
+	}
+}
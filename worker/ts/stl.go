@@ -0,0 +1,334 @@
+package ts
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// STLDecomposeOp .
+//  窗口均为点数, 需要为奇数, 为0时使用默认值;
+type STLDecomposeOp struct {
+	SeasonalWindow int  // 季节项loess窗口, 默认7
+	TrendWindow    int  // 趋势项loess窗口, 默认为 >= 1.5*period/(1-1.5/SeasonalWindow) 的最小奇数
+	LowPassWindow  int  // 低通滤波loess窗口, 默认为 >= period 的最小奇数
+	Inner          int  // 内循环次数, 默认2
+	Robust         bool // 是否做鲁棒迭代, 降低离群点对趋势和季节项的影响
+	Outer          int  // 鲁棒迭代次数, 仅在Robust时有效, 默认5
+}
+
+/*
+STLDecompose Seasonal-Trend decomposition using Loess
+	http://www.wessa.net/download/stl.pdf
+
+	内循环:
+		1) 去趋势: y - t;
+		2) 对各周期同位置的子序列做loess平滑, 并向两端各外推一个周期, 得到c;
+		3) 对c做低通滤波(周期长度MA, 周期长度MA, 3点MA, loess), 得到l;
+		4) 季节项 s = c - l;
+		5) 对 y - s 做loess平滑, 得到趋势项t;
+	外循环(Robust):
+		根据残差 e = y - s - t 计算bisquare鲁棒权重, 离群点权重接近0;
+
+	相对于ClassicalDecompose, 该分解不会丢失两端的数据;
+	缺失的点会先用LastValueComplete补全, 但其权重为0, 不参与拟合;
+	返回的s, t, e只包含data中原有的点;
+*/
+func STLDecompose(data TS, op *STLDecomposeOp) (s, t, e TS, err error) {
+	if data.Period() == UnknownOrInvalid {
+		return nil, nil, nil, fmt.Errorf("no period")
+	}
+	if data.Frequency() == UnknownOrInvalid {
+		return nil, nil, nil, fmt.Errorf("no frequency")
+	}
+
+	np := int(data.Period() / data.Frequency())
+	if np < 2 {
+		return nil, nil, nil, fmt.Errorf("period %v is too short for frequency %v", data.Period(), data.Frequency())
+	}
+
+	completed := data
+	if !data.Completed() {
+		completed = LastValueComplete(data)
+	}
+	if completed.N() < 2*np {
+		return nil, nil, nil, fmt.Errorf("need at least two periods, got %v points for period %v", completed.N(), np)
+	}
+
+	if op == nil {
+		op = &STLDecomposeOp{}
+	}
+	ns := oddWindow(op.SeasonalWindow, 7)
+	nt := oddWindow(op.TrendWindow, int(math.Ceil(1.5*float64(np)/(1-1.5/float64(ns)))))
+	nl := oddWindow(op.LowPassWindow, np)
+	inner := op.Inner
+	if inner <= 0 {
+		inner = 2
+	}
+	outer := 0
+	if op.Robust {
+		outer = op.Outer
+		if outer <= 0 {
+			outer = 5
+		}
+	}
+
+	ps := completed.Points()
+	n := len(ps)
+	y := completed.Values()
+
+	// weight of the completed points is 0
+	observed := make([]float64, n)
+	for i, p := range ps {
+		if _, ok := data.GetPoint(p.Stamp()); ok {
+			observed[i] = 1
+		}
+	}
+
+	weights := make([]float64, n)
+	copy(weights, observed)
+	season := make([]float64, n)
+	trend := make([]float64, n)
+	for k := 0; k <= outer; k++ {
+		for j := 0; j < inner; j++ {
+			stlInner(y, weights, np, ns, nt, nl, season, trend)
+		}
+
+		if k < outer {
+			resid := make([]float64, n)
+			for i := range y {
+				resid[i] = y[i] - season[i] - trend[i]
+			}
+			robustWeights(resid, weights)
+			for i := range weights {
+				weights[i] *= observed[i]
+			}
+		}
+	}
+
+	sPs := make(Points, 0, data.N())
+	tPs := make(Points, 0, data.N())
+	ePs := make(Points, 0, data.N())
+	for i, p := range ps {
+		if observed[i] == 0 {
+			continue
+		}
+		stamp := p.Stamp()
+		sPs = append(sPs, NewPoint(stamp, season[i]))
+		tPs = append(tPs, NewPoint(stamp, trend[i]))
+		ePs = append(ePs, NewPoint(stamp, y[i]-season[i]-trend[i]))
+	}
+
+	attr := data.Attributes()
+	return NewTS(attr, sPs), NewTS(attr, tPs), NewTS(attr, ePs), nil
+}
+
+func oddWindow(w, defaultVal int) int {
+	if w <= 0 {
+		w = defaultVal
+	}
+	if w < 3 {
+		w = 3
+	}
+	if w%2 == 0 {
+		w++
+	}
+	return w
+}
+
+func stlInner(y, w []float64, np, ns, nt, nl int, season, trend []float64) {
+	n := len(y)
+
+	// step 1 & 2: detrend and smooth the cycle-subseries
+	c := make([]float64, n+2*np)
+	for j := 0; j < np; j++ {
+		var sub, subW []float64
+		for i := j; i < n; i += np {
+			sub = append(sub, y[i]-trend[i])
+			subW = append(subW, w[i])
+		}
+		for k := -1; k <= len(sub); k++ {
+			v, ok := loessAt(sub, subW, ns, 0, float64(k))
+			if !ok { // all the points around are outliers
+				v = median(sub)
+			}
+			c[(k+1)*np+j] = v
+		}
+	}
+
+	// step 3: low-pass filter of c
+	l := movingAVGVals(c, np)
+	l = movingAVGVals(l, np)
+	l = movingAVGVals(l, 3)
+	ones := make([]float64, len(l))
+	for i := range ones {
+		ones[i] = 1
+	}
+	l = loessSmooth(l, ones, nl, 1)
+
+	// step 4 & 5: season and deseasonalize
+	deseason := make([]float64, n)
+	for i := 0; i < n; i++ {
+		season[i] = c[np+i] - l[i]
+		deseason[i] = y[i] - season[i]
+	}
+
+	// step 6: trend
+	copy(trend, loessSmooth(deseason, w, nt, 1))
+}
+
+// robustWeights bisquare weights of the residuals
+func robustWeights(resid, weights []float64) {
+	abs := make([]float64, len(resid))
+	for i, r := range resid {
+		abs[i] = math.Abs(r)
+	}
+
+	h := 6 * median(abs)
+	for i, r := range abs {
+		switch {
+		case h == 0 || r <= 0.001*h:
+			weights[i] = 1
+		case r > 0.999*h:
+			weights[i] = 0
+		default:
+			u := r / h
+			weights[i] = (1 - u*u) * (1 - u*u)
+		}
+	}
+}
+
+func median(vals []float64) float64 {
+	sorted := make([]float64, len(vals))
+	copy(sorted, vals)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+func movingAVGVals(vals []float64, window int) []float64 {
+	if len(vals) < window {
+		return nil
+	}
+	results := make([]float64, 0, len(vals)-window+1)
+	sum := Sum(vals[:window])
+	results = append(results, sum/float64(window))
+	for i := window; i < len(vals); i++ {
+		sum += vals[i] - vals[i-window]
+		results = append(results, sum/float64(window))
+	}
+	return results
+}
+
+// loessSmooth 对vals中每个点做loess平滑;
+//  每隔jump个点计算一次, 中间的点线性插值;
+func loessSmooth(vals, w []float64, q, degree int) []float64 {
+	n := len(vals)
+	results := make([]float64, n)
+	jump := int(math.Ceil(float64(q) / 10))
+	if jump < 1 {
+		jump = 1
+	}
+
+	last := -1
+	for i := 0; i < n; i += jump {
+		results[i] = loessOrOrigin(vals, w, q, degree, i)
+		if last >= 0 {
+			interpolate(results, last, i)
+		}
+		last = i
+	}
+	if last != n-1 {
+		results[n-1] = loessOrOrigin(vals, w, q, degree, n-1)
+		interpolate(results, last, n-1)
+	}
+	return results
+}
+
+func loessOrOrigin(vals, w []float64, q, degree, i int) float64 {
+	if v, ok := loessAt(vals, w, q, degree, float64(i)); ok {
+		return v
+	}
+	return vals[i]
+}
+
+func interpolate(vals []float64, left, right int) {
+	delta := (vals[right] - vals[left]) / float64(right-left)
+	for i := left + 1; i < right; i++ {
+		vals[i] = vals[left] + delta*float64(i-left)
+	}
+}
+
+// loessAt 在位置x处做局部加权回归(degree为0或1);
+//  选取距离x最近的q个点, 权重为 tricube(距离) * w;
+//  如果所有点的权重都为0, 则返回false;
+func loessAt(vals, w []float64, q, degree int, x float64) (float64, bool) {
+	n := len(vals)
+	left := 0
+	if q < n {
+		left = clampInt(int(math.Floor(x-float64(q-1)/2+0.5)), 0, n-q)
+	}
+	right := left + q - 1
+	if right > n-1 {
+		right = n - 1
+	}
+
+	h := math.Max(x-float64(left), float64(right)-x)
+	if q > n {
+		h += float64((q - n) / 2)
+	}
+	h9 := 0.999 * h
+	h1 := 0.001 * h
+
+	var sumW, sumWX, sumWY float64
+	tw := make([]float64, right-left+1)
+	for i := left; i <= right; i++ {
+		d := math.Abs(float64(i) - x)
+		if d > h9 {
+			continue
+		}
+		k := 1.0
+		if d > h1 {
+			r := d / h
+			k = (1 - r*r*r) * (1 - r*r*r) * (1 - r*r*r)
+		}
+		tw[i-left] = k * w[i]
+		sumW += tw[i-left]
+		sumWX += tw[i-left] * float64(i)
+		sumWY += tw[i-left] * vals[i]
+	}
+	if sumW <= 0 {
+		return 0, false
+	}
+
+	mx := sumWX / sumW
+	my := sumWY / sumW
+	if degree == 0 {
+		return my, true
+	}
+
+	var sxx, sxy float64
+	for i := left; i <= right; i++ {
+		dx := float64(i) - mx
+		sxx += tw[i-left] * dx * dx
+		sxy += tw[i-left] * dx * (vals[i] - my)
+	}
+	rng := float64(right - left)
+	if math.Sqrt(sxx/sumW) <= 0.001*rng {
+		return my, true
+	}
+	return my + sxy/sxx*(x-mx), true
+}
+
+func clampInt(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
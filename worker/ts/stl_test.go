@@ -0,0 +1,63 @@
+package ts
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestSTLDecompose(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	begin := time.Unix(1500000000, 0)
+	freq := time.Minute
+	period := time.Hour
+	n := 60 * 6
+
+	season := func(i int) float64 { return 10 * math.Sin(2*math.Pi*float64(i%60)/60) }
+	trend := func(i int) float64 { return 100 + 0.05*float64(i) }
+
+	ps := make(Points, 0, n)
+	for i := 0; i < n; i++ {
+		if i%37 == 5 { // missing points
+			continue
+		}
+		v := trend(i) + season(i) + r.NormFloat64()*0.5
+		if i%53 == 7 { // outliers
+			v += 1000
+		}
+		ps = append(ps, NewPoint(begin.Add(freq*time.Duration(i)), v))
+	}
+	data := NewTS(Attributes{Frequency: freq, Period: period}, ps)
+
+	s, tr, e, err := STLDecompose(data, &STLDecomposeOp{Robust: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.N() != data.N() || tr.N() != data.N() || e.N() != data.N() {
+		t.Fatalf("decomposed length %v %v %v, expect %v", s.N(), tr.N(), e.N(), data.N())
+	}
+
+	sPs, tPs := s.Points(), tr.Points()
+	for i, p := range data.Points() {
+		idx := int(p.Stamp().Sub(begin) / freq)
+		if math.Abs(sPs[i].Value()-season(idx)) > 2 {
+			t.Fatalf("season at %v is %v, expect %v", idx, sPs[i].Value(), season(idx))
+		}
+		if math.Abs(tPs[i].Value()-trend(idx)) > 2 {
+			t.Fatalf("trend at %v is %v, expect %v", idx, tPs[i].Value(), trend(idx))
+		}
+	}
+}
+
+func TestSTLDecomposeTooShort(t *testing.T) {
+	begin := time.Unix(1500000000, 0)
+	ps := make(Points, 0, 10)
+	for i := 0; i < 10; i++ {
+		ps = append(ps, NewPoint(begin.Add(time.Minute*time.Duration(i)), 1))
+	}
+	data := NewTS(Attributes{Frequency: time.Minute, Period: time.Hour}, ps)
+	if _, _, _, err := STLDecompose(data, nil); err == nil {
+		t.Fatal("expect err")
+	}
+}
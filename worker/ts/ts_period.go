@@ -2,6 +2,7 @@ package ts
 
 import (
 	"fmt"
+	"sort"
 	"time"
 )
 
@@ -18,16 +19,104 @@ func PeriodShift(stamp, begin time.Time, period time.Duration) time.Duration {
 //  聚合TS中, 所有周期同位置的点;
 //  返回值为 [shift]points, shift为各点相对于所在周期的起始位移
 func AggregatePeriodPoints(data TS) (map[time.Duration]Points, error) {
-	if data.Period() == UnknownOrInvalid {
+	return AggregatePointsByPeriod(data, data.Begin(), data.Period())
+}
+
+// AggregatePointsByPeriod .
+//  同AggregatePeriodPoints, 但是周期为period, 位移相对于begin计算;
+//  用于对齐多个起始时间不同的TS, 如分解得到的t, s, e;
+func AggregatePointsByPeriod(data TS, begin time.Time, period time.Duration) (map[time.Duration]Points, error) {
+	if period == UnknownOrInvalid {
 		return nil, fmt.Errorf("period UnknownOrInvalid")
 	}
 
 	periodPs := make(map[time.Duration]Points)
 
 	for _, p := range data.Points() {
-		shift := PeriodShift(p.Stamp(), data.Begin(), data.Period())
+		shift := PeriodShift(p.Stamp(), begin, period)
 		periodPs[shift] = append(periodPs[shift], p)
 	}
 
 	return periodPs, nil
 }
+
+// AggregateMultiPeriodPoints .
+//  对TS的每一个周期做AggregatePeriodPoints;
+//  返回值为 [period][shift]points
+func AggregateMultiPeriodPoints(data TS) (map[time.Duration]map[time.Duration]Points, error) {
+	periods := data.Periods()
+	if len(periods) == 0 {
+		return nil, fmt.Errorf("period UnknownOrInvalid")
+	}
+
+	results := make(map[time.Duration]map[time.Duration]Points, len(periods))
+	for _, period := range periods {
+		periodPs, err := AggregatePointsByPeriod(data, data.Begin(), period)
+		if err != nil {
+			return nil, err
+		}
+		results[period] = periodPs
+	}
+	return results, nil
+}
+
+// CoverPeriod 判断TS的观测时长是否覆盖了一个完整的周期
+func CoverPeriod(data TS, period time.Duration) bool {
+	if data.N() == 0 || period == UnknownOrInvalid {
+		return false
+	}
+	return data.End().Sub(data.Begin())+data.Frequency() >= period
+}
+
+/*
+ExtractSeasons .
+	从残差e中依次提取periods中各个周期的季节项:
+		对当前残差按周期同位置(相对于begin)求平均, 并在周期内做窗口为window个点的循环滑动平均;
+		从残差中减去该季节项, 继续提取下一个周期;
+	未被e完整覆盖的周期会被跳过;
+	返回值为 [period]季节项, 以及剩余的残差;
+*/
+func ExtractSeasons(e TS, begin time.Time, periods []time.Duration, window int) (map[time.Duration]TS, TS) {
+	seasons := make(map[time.Duration]TS, len(periods))
+	remainder := e
+	for _, period := range periods {
+		if !CoverPeriod(remainder, period) {
+			continue
+		}
+
+		periodPs, _ := AggregatePointsByPeriod(remainder, begin, period)
+		shifts := make([]time.Duration, 0, len(periodPs))
+		for shift := range periodPs {
+			shifts = append(shifts, shift)
+		}
+		sort.Slice(shifts, func(i, j int) bool {
+			return shifts[i] < shifts[j]
+		})
+		avgs := make([]float64, len(shifts))
+		for i, shift := range shifts {
+			avgs[i] = AVGPoints(periodPs[shift])
+		}
+
+		smoothed := make(map[time.Duration]float64, len(shifts))
+		half := window / 2
+		for i, shift := range shifts {
+			sum := 0.0
+			for j := i - half; j <= i+half; j++ {
+				sum += avgs[(j%len(avgs)+len(avgs))%len(avgs)]
+			}
+			smoothed[shift] = sum / float64(2*half+1)
+		}
+
+		seasonPs := make(Points, 0, remainder.N())
+		remainderPs := make(Points, 0, remainder.N())
+		for _, p := range remainder.Points() {
+			v := smoothed[PeriodShift(p.Stamp(), begin, period)]
+			seasonPs = append(seasonPs, NewPoint(p.Stamp(), v))
+			remainderPs = append(remainderPs, NewPoint(p.Stamp(), p.Value()-v))
+		}
+		seasons[period] = NewTS(e.Attributes(), seasonPs)
+		remainder = NewTS(e.Attributes(), remainderPs)
+	}
+
+	return seasons, remainder
+}
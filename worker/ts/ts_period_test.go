@@ -17,3 +17,44 @@ func TestPeriodShift(t *testing.T) {
 		t.Fatal("error")
 	}
 }
+
+func TestAllPeriods(t *testing.T) {
+	attr := Attributes{
+		Period:  time.Hour * 24,
+		Periods: []time.Duration{time.Hour * 24 * 7, time.Hour * 24, UnknownOrInvalid},
+	}
+	periods := attr.AllPeriods()
+	if len(periods) != 2 || periods[0] != time.Hour*24 || periods[1] != time.Hour*24*7 {
+		t.Fatalf("invalid periods %v", periods)
+	}
+	if attr.LongestPeriod() != time.Hour*24*7 {
+		t.Fatal("error")
+	}
+	if (Attributes{}).LongestPeriod() != UnknownOrInvalid {
+		t.Fatal("error")
+	}
+}
+
+func TestAggregateMultiPeriodPoints(t *testing.T) {
+	begin := time.Unix(1500000000, 0)
+	ps := make(Points, 0, 240)
+	for i := 0; i < 240; i++ {
+		ps = append(ps, NewPoint(begin.Add(time.Minute*time.Duration(i)), float64(i)))
+	}
+	data := NewTS(Attributes{
+		Frequency: time.Minute,
+		Period:    time.Minute * 10,
+		Periods:   []time.Duration{time.Hour},
+	}, ps)
+
+	aggregated, err := AggregateMultiPeriodPoints(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aggregated[time.Minute*10]) != 10 || len(aggregated[time.Minute*10][0]) != 24 {
+		t.Fatal("error")
+	}
+	if len(aggregated[time.Hour]) != 60 || len(aggregated[time.Hour][time.Minute]) != 4 {
+		t.Fatal("error")
+	}
+}
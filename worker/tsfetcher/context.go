@@ -5,9 +5,11 @@ import (
 	"time"
 )
 
-var (
-	ctxRetry   = struct{}{}
-	ctxTimeout = struct{}{}
+type ctxKey int
+
+const (
+	ctxRetry ctxKey = iota
+	ctxTimeout
 )
 
 // WithRetry .
@@ -36,7 +38,7 @@ func GetTimeout(ctx context.Context) (time.Duration, bool) {
 	v := ctx.Value(ctxTimeout)
 	if v != nil {
 		if timeout, ok := v.(time.Duration); ok {
-			return timeout, false
+			return timeout, true
 		}
 	}
 	return 0, false
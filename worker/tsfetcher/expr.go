@@ -0,0 +1,423 @@
+package tsfetcher
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+	"unicode"
+
+	"code.byted.org/microservice/tsad/worker/ts"
+)
+
+/*
+Expr 数据源之间的算术表达式, 如: a / b * 100, rate(a), sum(a, b);
+	支持+, -, *, /, 括号, 数字, 操作数和以下函数:
+		rate(x): 每秒的增长率, 值减小(如计数器重置)的点被丢弃;
+		abs(x);
+		sum(x, ...), avg(x, ...), min(x, ...), max(x, ...): 同一时间点上多个参数的聚合;
+	操作数的点按时间对齐, 只保留所有操作数都有值的时间点; 除以0的点被丢弃;
+*/
+type Expr struct {
+	root *exprNode
+	str  string
+}
+
+type exprNode struct {
+	op    string // +, -, *, /, neg, num, operand, or function name
+	num   float64
+	name  string
+	args  []*exprNode
+	start int // position in the expression, for the error message
+}
+
+var exprFuncs = map[string]bool{
+	"rate": true,
+	"abs":  true,
+	"sum":  true,
+	"avg":  true,
+	"min":  true,
+	"max":  true,
+}
+
+// ParseExpr .
+func ParseExpr(str string) (*Expr, error) {
+	p := &exprParser{str: str}
+	p.next()
+	root, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok != "" {
+		return nil, fmt.Errorf("unexpected %q at %v", p.tok, p.tokPos)
+	}
+	return &Expr{root: root, str: str}, nil
+}
+
+func (e *Expr) String() string {
+	return e.str
+}
+
+// Operands 返回表达式中的操作数, 已排序
+func (e *Expr) Operands() []string {
+	set := make(map[string]bool)
+	var walk func(n *exprNode)
+	walk = func(n *exprNode) {
+		if n.op == "operand" {
+			set[n.name] = true
+		}
+		for _, arg := range n.args {
+			walk(arg)
+		}
+	}
+	walk(e.root)
+
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// exprValue a scalar or a series, the stamps of the series are sorted and unique
+type exprValue struct {
+	scalar bool
+	num    float64
+	stamps []time.Time
+	vals   []float64
+}
+
+/*
+Eval 计算表达式, operands为各个操作数的数据;
+	操作数的点按freq对齐, 同一时间段中的多个点取平均值;
+*/
+func (e *Expr) Eval(operands map[string]ts.TS, freq time.Duration) (ts.Points, error) {
+	if freq <= 0 {
+		return nil, fmt.Errorf("invalid frequency: %v", freq)
+	}
+	values := make(map[string]*exprValue, len(operands))
+	for name, data := range operands {
+		values[name] = alignSeries(data.Points(), freq)
+	}
+
+	v, err := evalExpr(e.root, values)
+	if err != nil {
+		return nil, err
+	}
+	if v.scalar {
+		return nil, fmt.Errorf("the expression has no operand: %v", e.str)
+	}
+
+	points := make(ts.Points, 0, len(v.vals))
+	for i, val := range v.vals {
+		if math.IsNaN(val) || math.IsInf(val, 0) {
+			continue
+		}
+		points = append(points, ts.NewPoint(v.stamps[i], val))
+	}
+	return points, nil
+}
+
+func alignSeries(points ts.Points, freq time.Duration) *exprValue {
+	points = bucketPoints(points, freq, aggregateAvg)
+	v := &exprValue{
+		stamps: make([]time.Time, 0, len(points)),
+		vals:   make([]float64, 0, len(points)),
+	}
+	for _, p := range points {
+		v.stamps = append(v.stamps, p.Stamp())
+		v.vals = append(v.vals, p.Value())
+	}
+	return v
+}
+
+func evalExpr(n *exprNode, operands map[string]*exprValue) (*exprValue, error) {
+	switch n.op {
+	case "num":
+		return &exprValue{scalar: true, num: n.num}, nil
+	case "operand":
+		v, ok := operands[n.name]
+		if !ok {
+			return nil, fmt.Errorf("unknown operand: %v", n.name)
+		}
+		return v, nil
+	}
+
+	args := make([]*exprValue, 0, len(n.args))
+	for _, arg := range n.args {
+		v, err := evalExpr(arg, operands)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+
+	switch n.op {
+	case "neg":
+		return mapValue(args[0], func(x float64) float64 { return -x }), nil
+	case "abs":
+		return mapValue(args[0], math.Abs), nil
+	case "rate":
+		if args[0].scalar {
+			return nil, fmt.Errorf("rate of a number at %v", n.start)
+		}
+		return rateValue(args[0]), nil
+	case "+", "-", "*", "/":
+		return joinValues(args, func(xs []float64) float64 {
+			switch n.op {
+			case "+":
+				return xs[0] + xs[1]
+			case "-":
+				return xs[0] - xs[1]
+			case "*":
+				return xs[0] * xs[1]
+			}
+			if xs[1] == 0 {
+				return math.NaN()
+			}
+			return xs[0] / xs[1]
+		}), nil
+	case "sum", "avg", "min", "max":
+		return joinValues(args, func(xs []float64) float64 {
+			result := xs[0]
+			for _, x := range xs[1:] {
+				switch n.op {
+				case "sum", "avg":
+					result += x
+				case "min":
+					result = math.Min(result, x)
+				case "max":
+					result = math.Max(result, x)
+				}
+			}
+			if n.op == "avg" {
+				result /= float64(len(xs))
+			}
+			return result
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown operator: %v", n.op)
+}
+
+func mapValue(v *exprValue, f func(float64) float64) *exprValue {
+	if v.scalar {
+		return &exprValue{scalar: true, num: f(v.num)}
+	}
+	result := &exprValue{stamps: v.stamps, vals: make([]float64, len(v.vals))}
+	for i, x := range v.vals {
+		result.vals[i] = f(x)
+	}
+	return result
+}
+
+func rateValue(v *exprValue) *exprValue {
+	result := &exprValue{}
+	for i := 1; i < len(v.vals); i++ {
+		diff := v.vals[i] - v.vals[i-1]
+		if diff < 0 {
+			continue // reset
+		}
+		result.stamps = append(result.stamps, v.stamps[i])
+		result.vals = append(result.vals, diff/v.stamps[i].Sub(v.stamps[i-1]).Seconds())
+	}
+	return result
+}
+
+// joinValues 在所有series都有值的时间点上计算f, 数字作为每个时间点上的值
+func joinValues(args []*exprValue, f func(xs []float64) float64) *exprValue {
+	xs := make([]float64, len(args))
+	var series []*exprValue
+	for _, a := range args {
+		if !a.scalar {
+			series = append(series, a)
+		}
+	}
+	if len(series) == 0 {
+		for i, a := range args {
+			xs[i] = a.num
+		}
+		return &exprValue{scalar: true, num: f(xs)}
+	}
+
+	result := &exprValue{}
+	idx := make([]int, len(args))
+	for _, stamp := range series[0].stamps {
+		matched := true
+		for i, a := range args {
+			if a.scalar {
+				xs[i] = a.num
+				continue
+			}
+			for idx[i] < len(a.stamps) && a.stamps[idx[i]].Before(stamp) {
+				idx[i]++
+			}
+			if idx[i] >= len(a.stamps) || !a.stamps[idx[i]].Equal(stamp) {
+				matched = false
+				break
+			}
+			xs[i] = a.vals[idx[i]]
+		}
+		if matched {
+			result.stamps = append(result.stamps, stamp)
+			result.vals = append(result.vals, f(xs))
+		}
+	}
+	return result
+}
+
+// exprParser a recursive descent parser:
+//  expr    := term (('+' | '-') term)*
+//  term    := unary (('*' | '/') unary)*
+//  unary   := '-' unary | primary
+//  primary := number | name | name '(' expr (',' expr)* ')' | '(' expr ')'
+type exprParser struct {
+	str    string
+	pos    int
+	tok    string
+	tokPos int
+}
+
+// next 读取下一个token, 结束时tok为空
+func (p *exprParser) next() {
+	for p.pos < len(p.str) && unicode.IsSpace(rune(p.str[p.pos])) {
+		p.pos++
+	}
+	p.tokPos = p.pos
+	if p.pos >= len(p.str) {
+		p.tok = ""
+		return
+	}
+
+	c := p.str[p.pos]
+	end := p.pos + 1
+	switch {
+	case isExprNameChar(c) && !isExprDigit(c):
+		for end < len(p.str) && isExprNameChar(p.str[end]) {
+			end++
+		}
+	case isExprDigit(c) || c == '.':
+		for end < len(p.str) && (isExprDigit(p.str[end]) || p.str[end] == '.' || p.str[end] == 'e' || p.str[end] == 'E' ||
+			((p.str[end] == '+' || p.str[end] == '-') && (p.str[end-1] == 'e' || p.str[end-1] == 'E'))) {
+			end++
+		}
+	}
+	p.tok = p.str[p.pos:end]
+	p.pos = end
+}
+
+func isExprDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isExprNameChar(c byte) bool {
+	return c == '_' || isExprDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func (p *exprParser) parseExpr() (*exprNode, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == "+" || p.tok == "-" {
+		op, start := p.tok, p.tokPos
+		p.next()
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &exprNode{op: op, args: []*exprNode{left, right}, start: start}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseTerm() (*exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == "*" || p.tok == "/" {
+		op, start := p.tok, p.tokPos
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &exprNode{op: op, args: []*exprNode{left, right}, start: start}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (*exprNode, error) {
+	if p.tok == "-" {
+		start := p.tokPos
+		p.next()
+		arg, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &exprNode{op: "neg", args: []*exprNode{arg}, start: start}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (*exprNode, error) {
+	tok, start := p.tok, p.tokPos
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("unexpected end of the expression")
+	case tok == "(":
+		p.next()
+		n, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok != ")" {
+			return nil, fmt.Errorf("expect ) at %v", p.tokPos)
+		}
+		p.next()
+		return n, nil
+	case isExprDigit(tok[0]) || tok[0] == '.':
+		num, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at %v", tok, start)
+		}
+		p.next()
+		return &exprNode{op: "num", num: num, start: start}, nil
+	case isExprNameChar(tok[0]):
+		p.next()
+		if p.tok != "(" {
+			if exprFuncs[tok] {
+				return nil, fmt.Errorf("function %v should be called at %v", tok, start)
+			}
+			return &exprNode{op: "operand", name: tok, start: start}, nil
+		}
+		if !exprFuncs[tok] {
+			return nil, fmt.Errorf("unknown function %v at %v", tok, start)
+		}
+
+		p.next()
+		n := &exprNode{op: tok, start: start}
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			n.args = append(n.args, arg)
+			if p.tok == ")" {
+				break
+			}
+			if p.tok != "," {
+				return nil, fmt.Errorf("expect , or ) at %v", p.tokPos)
+			}
+			p.next()
+		}
+		p.next()
+		if (tok == "rate" || tok == "abs") && len(n.args) != 1 {
+			return nil, fmt.Errorf("function %v takes one argument at %v", tok, start)
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("unexpected %q at %v", tok, start)
+}
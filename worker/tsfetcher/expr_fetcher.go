@@ -0,0 +1,126 @@
+package tsfetcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"code.byted.org/microservice/tsad/worker/ts"
+)
+
+// OperandFetcher 读取表达式中一个操作数的数据, operand为source的Extra中该操作数对应的JSON
+type OperandFetcher func(ctx context.Context, operand string, begin, end time.Time) (ts.TS, error)
+
+/*
+ExprFetcher 读取由其他数据源计算得到的数据;
+	source的Key为表达式(见Expr), 如: errors / requests * 100;
+	Extra为JSON对象, 表达式中的每个操作数对应一个数据源, 如:
+		{"errors": {"type": "prometheus", "key": "..."}, "requests": {"type": "tsdb", "key": "..."}}
+	每个操作数通过OperandFetcher读取, 按所有操作数中最大的frequency对齐后计算;
+*/
+type ExprFetcher struct {
+	fetch OperandFetcher
+}
+
+func init() {
+	Register(SourceExpr, func(conf BackendConfig) (TSFetcher, error) {
+		return NewExprFetcher(conf.Operand)
+	})
+}
+
+// NewExprFetcher .
+func NewExprFetcher(fetch OperandFetcher) (*ExprFetcher, error) {
+	if fetch == nil {
+		return nil, fmt.Errorf("OperandFetcher can not be nil")
+	}
+	return &ExprFetcher{fetch: fetch}, nil
+}
+
+// ParseExprSource 解析expr类型source的Key和Extra, 返回表达式和每个操作数对应的JSON
+func ParseExprSource(src Source) (*Expr, map[string]string, error) {
+	if src.Key == "" {
+		return nil, nil, fmt.Errorf("source Key can not be null")
+	}
+	expr, err := ParseExpr(src.Key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid expression: %v, err: %v", src.Key, err)
+	}
+
+	var raws map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(src.Extra), &raws); err != nil {
+		return nil, nil, fmt.Errorf("invalid source Extra: %v, err: %v", src.Extra, err)
+	}
+	operands := make(map[string]string, len(raws))
+	for _, name := range expr.Operands() {
+		raw, ok := raws[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("operand %v is not defined in Extra", name)
+		}
+		operands[name] = string(raw)
+	}
+	return expr, operands, nil
+}
+
+// Fetch .
+func (ef *ExprFetcher) Fetch(ctx context.Context, src Source, begin, end time.Time) (ts.TS, error) {
+	if src.Type != SourceExpr {
+		return nil, fmt.Errorf("not an expr source type: %v", src.Type)
+	}
+	expr, operands, err := ParseExprSource(src)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		lock    sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]ts.TS, len(operands))
+		errs    []error
+	)
+	for name, operand := range operands {
+		wg.Add(1)
+		go func(name, operand string) {
+			defer wg.Done()
+			data, err := ef.fetch(ctx, operand, begin, end)
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("fetch operand %v err: %v", name, err))
+				return
+			}
+			results[name] = data
+		}(name, operand)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	// align the operands on the largest frequency
+	var attrs ts.Attributes
+	for _, data := range results {
+		if data.Frequency() > attrs.Frequency {
+			attrs = data.Attributes()
+		}
+	}
+	if attrs.Frequency <= 0 {
+		return nil, fmt.Errorf("invalid frequency of the operands: %v", attrs.Frequency)
+	}
+
+	points, err := expr.Eval(results, attrs.Frequency)
+	if err != nil {
+		return nil, err
+	}
+	points = complete(points, attrs.Frequency)
+	return ts.NewTS(attrs, points), nil
+}
+
+// Derive 检查表达式和操作数, 返回src本身
+func (ef *ExprFetcher) Derive(ctx context.Context, src Source) ([]Source, error) {
+	if _, _, err := ParseExprSource(src); err != nil {
+		return nil, err
+	}
+	return []Source{src}, nil
+}
@@ -0,0 +1,145 @@
+package tsfetcher
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"code.byted.org/microservice/tsad/worker/ts"
+)
+
+func TestParseExpr(t *testing.T) {
+	cases := []struct {
+		str      string
+		operands []string
+		ok       bool
+	}{
+		{"a / b * 100", []string{"a", "b"}, true},
+		{"rate(a)", []string{"a"}, true},
+		{"sum(a, b, c) - -1.5e2", []string{"a", "b", "c"}, true},
+		{"(errors + 1) / max(requests, 1)", []string{"errors", "requests"}, true},
+		{"a +", nil, false},
+		{"(a", nil, false},
+		{"a b", nil, false},
+		{"foo(a)", nil, false},
+		{"rate(a, b)", nil, false},
+		{"sum", nil, false},
+		{"a % b", nil, false},
+	}
+	for _, c := range cases {
+		expr, err := ParseExpr(c.str)
+		if (err == nil) != c.ok {
+			t.Fatalf("%v: err %v, expect ok %v", c.str, err, c.ok)
+		}
+		if err == nil && !reflect.DeepEqual(expr.Operands(), c.operands) {
+			t.Fatalf("%v: operands %v, expect %v", c.str, expr.Operands(), c.operands)
+		}
+	}
+}
+
+func TestExprEval(t *testing.T) {
+	freq := time.Minute
+	begin := time.Unix(1500000000, 0).Truncate(freq)
+	series := func(vals ...float64) ts.TS {
+		var ps ts.Points
+		for i, v := range vals {
+			if !math.IsNaN(v) {
+				ps = append(ps, ts.NewPoint(begin.Add(freq*time.Duration(i)), v))
+			}
+		}
+		return ts.NewTS(StepTSAttrs(freq), ps)
+	}
+	nan := math.NaN()
+	operands := map[string]ts.TS{
+		"a": series(1, 2, 3, nan, 5),
+		"b": series(2, 0, 4, 4, 10),
+		"c": series(0, 60, 180, 120, 240),
+	}
+
+	cases := []struct {
+		str  string
+		expt []float64 // NaN means no point
+	}{
+		{"a / b * 100", []float64{50, nan, 75, nan, 50}},
+		{"-a + 2 * b", []float64{3, -2, 5, nan, 15}},
+		{"sum(a, b)", []float64{3, 2, 7, nan, 15}},
+		{"avg(a, b)", []float64{1.5, 1, 3.5, nan, 7.5}},
+		{"max(a, b, 3)", []float64{3, 3, 4, nan, 10}},
+		{"rate(c)", []float64{nan, 1, 2, nan, 2}},
+		{"abs(a - b)", []float64{1, 2, 1, nan, 5}},
+	}
+	for _, c := range cases {
+		expr, err := ParseExpr(c.str)
+		if err != nil {
+			t.Fatal(err)
+		}
+		points, err := expr.Eval(operands, freq)
+		if err != nil {
+			t.Fatalf("%v: %v", c.str, err)
+		}
+		got := make([]float64, len(c.expt))
+		for i := range got {
+			got[i] = nan
+		}
+		for _, p := range points {
+			got[p.Stamp().Sub(begin)/freq] = p.Value()
+		}
+		if fmt.Sprint(got) != fmt.Sprint(c.expt) {
+			t.Fatalf("%v: %v, expect %v", c.str, got, c.expt)
+		}
+	}
+
+	expr, _ := ParseExpr("1 + 2")
+	if _, err := expr.Eval(operands, freq); err == nil {
+		t.Fatal("expect error for an expression without operand")
+	}
+}
+
+func TestExprFetcher(t *testing.T) {
+	begin := time.Unix(1500000000, 0).Truncate(time.Minute)
+	fetch := func(ctx context.Context, operand string, from, to time.Time) (ts.TS, error) {
+		var freq time.Duration
+		var val float64
+		switch operand {
+		case `"errors"`:
+			freq, val = time.Second*30, 1
+		case `"requests"`:
+			freq, val = time.Minute, 4
+		default:
+			return nil, fmt.Errorf("unknown operand: %v", operand)
+		}
+		var ps ts.Points
+		for stamp := from; stamp.Before(to); stamp = stamp.Add(freq) {
+			ps = append(ps, ts.NewPoint(stamp, val))
+		}
+		return ts.NewTS(StepTSAttrs(freq), ps), nil
+	}
+	ef, err := NewExprFetcher(fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := Source{Type: SourceExpr, Key: "errors / requests * 100", Extra: `{"errors": "errors", "requests": "requests"}`}
+	data, err := ef.Fetch(context.Background(), src, begin, begin.Add(time.Minute*10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.N() != 10 || data.Frequency() != time.Minute {
+		t.Fatalf("%v points, frequency %v", data.N(), data.Frequency())
+	}
+	for _, p := range data.Points() {
+		if p.Value() != 25 {
+			t.Fatalf("value %v at %v, expect 25", p.Value(), p.Stamp())
+		}
+	}
+
+	for _, extra := range []string{`{"errors": "errors"}`, `{"errors": "errors", "requests": "qps"}`, `not json`} {
+		src.Extra = extra
+		if _, err := ef.Fetch(context.Background(), src, begin, begin.Add(time.Minute*10)); err == nil {
+			t.Fatalf("expect error for Extra %v", extra)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package tsfetcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"code.byted.org/microservice/tsad/worker/ts"
+)
+
+// fileCache the points which have been read from a file when tailing
+type fileCache struct {
+	offset int64 // the size which has been read
+	points ts.Points
+	read   time.Time // the last time it is read
+}
+
+// fileCacheExpiration the cache of a file which hasn't been fetched for it is evicted, it is read again when it is fetched
+var fileCacheExpiration = time.Hour
+
+/*
+FileFetcher 从本地文件中读取数据;
+	source的Key为文件路径, 不能包含通配符, 通配符需要先通过Expand展开;
+	文件格式由扩展名决定:
+		.csv: 每行为timestamp,value, 第一行可以是header;
+		.json, .jsonl, .ndjson: 每行为一个JSON, 如{"stamp": 1500000000, "value": 1.5};
+	timestamp为unix秒数(可以有小数)或RFC3339格式的时间;
+	点按freq对齐, 同一个间隔中的多个点取平均值;
+	tail为true时, 缓存已读取的点, 之后只读取文件新追加的行, 文件变小时重新读取;
+	root不为空时, 相对路径相对于root, 且只能读取root下的文件(解析符号链接之后);
+*/
+type FileFetcher struct {
+	freq     time.Duration
+	tail     bool
+	root     string
+	realRoot string // root with the symlinks evaluated
+
+	caches map[string]*fileCache
+	lock   sync.Mutex
+}
+
+/*
+init 注册File, API为根目录, 不能为空, Options:
+	tail: 为true时只读取文件新追加的行;
+*/
+func init() {
+	Register(SourceFile, func(conf BackendConfig) (TSFetcher, error) {
+		if conf.API == "" {
+			return nil, fmt.Errorf("the root of the file source can not be null")
+		}
+		tail, _ := strconv.ParseBool(conf.Options["tail"])
+		return NewFileFetcher(stepOrDefault(conf.Step, TSDBTSAttr.Frequency), tail, conf.API)
+	})
+}
+
+// NewFileFetcher .
+func NewFileFetcher(freq time.Duration, tail bool, root string) (*FileFetcher, error) {
+	if freq <= 0 {
+		return nil, fmt.Errorf("invalid frequency: %v", freq)
+	}
+	var realRoot string
+	if root != "" {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return nil, fmt.Errorf("invalid root: %v, err: %v", root, err)
+		}
+		if realRoot, err = filepath.EvalSymlinks(abs); err != nil {
+			return nil, fmt.Errorf("invalid root: %v, err: %v", root, err)
+		}
+		root = abs
+	}
+	return &FileFetcher{
+		freq:     freq,
+		tail:     tail,
+		root:     root,
+		realRoot: realRoot,
+		caches:   make(map[string]*fileCache),
+	}, nil
+}
+
+func hasGlobMeta(path string) bool {
+	return strings.ContainsAny(path, `*?[\`)
+}
+
+func inDir(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// absPath 返回path的绝对路径, 相对路径相对于root, path需要在root下(不解析符号链接)
+func (ff *FileFetcher) absPath(path string) (string, error) {
+	if ff.root != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(ff.root, path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid path: %v, err: %v", path, err)
+	}
+	if ff.root != "" && !inDir(abs, ff.root) {
+		return "", fmt.Errorf("path %v is not in %v", path, ff.root)
+	}
+	return abs, nil
+}
+
+// checkPath 返回path的绝对路径, 解析符号链接之后path也需要在root下
+func (ff *FileFetcher) checkPath(path string) (string, error) {
+	abs, err := ff.absPath(path)
+	if err != nil || ff.root == "" {
+		return abs, err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", fmt.Errorf("invalid path: %v, err: %v", path, err)
+	}
+	if !inDir(resolved, ff.realRoot) {
+		return "", fmt.Errorf("path %v links to %v which is not in %v", path, resolved, ff.root)
+	}
+	return abs, nil
+}
+
+// Derive 展开路径中的通配符
+func (ff *FileFetcher) Derive(ctx context.Context, src Source) ([]Source, error) {
+	return deriveExpanded(ctx, src, ff.Expand)
+}
+
+// Expand 展开含有通配符的路径, 返回所有匹配的文件的绝对路径, 已排序;
+func (ff *FileFetcher) Expand(ctx context.Context, pattern string) ([]string, error) {
+	pattern, err := ff.absPath(pattern)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %v, err: %v", pattern, err)
+	}
+
+	var paths []string
+	for _, m := range matches {
+		if info, err := os.Stat(m); err != nil || info.IsDir() {
+			continue
+		}
+		if _, err := ff.checkPath(m); err != nil {
+			continue // linked out of the root
+		}
+		paths = append(paths, m)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// Fetch 返回[begin, end]中的点
+func (ff *FileFetcher) Fetch(ctx context.Context, src Source, begin, end time.Time) (ts.TS, error) {
+	if src.Type != SourceFile {
+		return nil, fmt.Errorf("not a file source type: %v", src.Type)
+	}
+	if src.Key == "" {
+		return nil, fmt.Errorf("source Key can not be null")
+	}
+	if hasGlobMeta(src.Key) {
+		return nil, fmt.Errorf("source Key can not contains wildcards, Key: %v", src.Key)
+	}
+	path, err := ff.checkPath(src.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	all, err := ff.read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	from := sort.Search(len(all), func(i int) bool {
+		return !all[i].Stamp().Before(begin)
+	})
+	points := make(ts.Points, 0, len(all)-from)
+	for i := from; i < len(all) && !all[i].Stamp().After(end); i++ {
+		points = append(points, all[i])
+	}
+
+	points = complete(bucketPoints(points, ff.freq, aggregateAvg), ff.freq)
+	return ts.NewTS(StepTSAttrs(ff.freq), points), nil
+}
+
+// read 返回文件中所有的点, 已排序
+func (ff *FileFetcher) read(path string) (ts.Points, error) {
+	if !ff.tail {
+		buf, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read file err: %v", err)
+		}
+		points, _, err := parseFileRows(path, buf, true, false)
+		if err != nil {
+			return nil, err
+		}
+		sortPoints(points)
+		return points, nil
+	}
+
+	ff.lock.Lock()
+	defer ff.lock.Unlock()
+	now := time.Now()
+	for p, c := range ff.caches {
+		if now.Sub(c.read) > fileCacheExpiration {
+			delete(ff.caches, p)
+		}
+	}
+	cache, ok := ff.caches[path]
+	if !ok {
+		cache = &fileCache{}
+		ff.caches[path] = cache
+	}
+	cache.read = now
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open file err: %v", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("stat file err: %v", err)
+	}
+	if info.Size() < cache.offset {
+		// truncated or rotated, read it again
+		cache.offset = 0
+		cache.points = nil
+	}
+	if info.Size() == cache.offset {
+		return cache.points, nil
+	}
+
+	if _, err := f.Seek(cache.offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("seek file err: %v", err)
+	}
+	buf, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("read file err: %v", err)
+	}
+	points, n, err := parseFileRows(path, buf, cache.offset == 0, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// the returned points may be being read, so don't sort them in place
+	cache.offset += int64(n)
+	sortPoints(points)
+	if len(cache.points) > 0 && len(points) > 0 && points[0].Stamp().Before(cache.points[len(cache.points)-1].Stamp()) {
+		all := make(ts.Points, 0, len(cache.points)+len(points))
+		all = append(append(all, cache.points...), points...)
+		sortPoints(all)
+		cache.points = all
+	} else {
+		cache.points = append(cache.points, points...)
+	}
+	return cache.points, nil
+}
+
+func sortPoints(points ts.Points) {
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].Stamp().Before(points[j].Stamp())
+	})
+}
+
+/*
+parseFileRows 解析buf中的行, 返回解析的点和解析的字节数;
+	first表示buf从文件开头开始, 此时csv的第一行可以是header;
+	tailing为true时, 最后一行如果没有换行符, 可能还在写入, 不解析它;
+*/
+func parseFileRows(path string, buf []byte, first, tailing bool) (ts.Points, int, error) {
+	n := len(buf)
+	if tailing {
+		n = bytes.LastIndexByte(buf, '\n') + 1
+		buf = buf[:n]
+	}
+
+	var points ts.Points
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		r := csv.NewReader(bytes.NewReader(buf))
+		r.FieldsPerRecord = -1
+		for {
+			record, err := r.Read()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, 0, fmt.Errorf("read csv file %v err: %v", path, err)
+			}
+			if len(record) < 2 {
+				return nil, 0, fmt.Errorf("invalid row in %v: %v, expect timestamp,value", path, record)
+			}
+
+			stamp, err := parseFileStamp(record[0])
+			var val float64
+			if err == nil {
+				val, err = strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+			}
+			if err != nil {
+				if first && len(points) == 0 {
+					first = false
+					continue // header
+				}
+				return nil, 0, fmt.Errorf("invalid row in %v: %v, err: %v", path, record, err)
+			}
+			first = false
+			if math.IsNaN(val) || math.IsInf(val, 0) {
+				continue
+			}
+			points = append(points, ts.NewPoint(stamp, val))
+		}
+	case ".json", ".jsonl", ".ndjson":
+		for _, line := range bytes.Split(buf, []byte("\n")) {
+			line = bytes.TrimSpace(line)
+			if len(line) == 0 {
+				continue
+			}
+			var row struct {
+				Stamp json.RawMessage `json:"stamp"`
+				Value *float64        `json:"value"`
+			}
+			if err := json.Unmarshal(line, &row); err != nil || row.Stamp == nil || row.Value == nil {
+				return nil, 0, fmt.Errorf("invalid row in %v: %s, expect {\"stamp\": ..., \"value\": ...}", path, line)
+			}
+			stamp, err := parseFileStamp(strings.Trim(string(row.Stamp), `"`))
+			if err != nil {
+				return nil, 0, fmt.Errorf("invalid row in %v: %s, err: %v", path, line, err)
+			}
+			if math.IsNaN(*row.Value) || math.IsInf(*row.Value, 0) {
+				continue
+			}
+			points = append(points, ts.NewPoint(stamp, *row.Value))
+		}
+	default:
+		return nil, 0, fmt.Errorf("unknown file format: %v", path)
+	}
+	return points, n, nil
+}
+
+// parseFileStamp unix秒数(可以有小数)或RFC3339格式的时间
+func parseFileStamp(str string) (time.Time, error) {
+	str = strings.TrimSpace(str)
+	if sec, err := strconv.ParseFloat(str, 64); err == nil {
+		i, frac := math.Modf(sec)
+		return time.Unix(int64(i), int64(frac*1e9)), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, str); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp: %v", str)
+}
@@ -0,0 +1,162 @@
+package tsfetcher
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileFetcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsad_file_fetcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	begin := time.Unix(1500000000, 0)
+	csvBuf := "timestamp,value\n"
+	jsonBuf := ""
+	for i := 0; i < 120; i++ {
+		stamp := begin.Add(time.Second * 30 * time.Duration(i))
+		if i%10 == 5 {
+			continue // missing points are completed
+		}
+		csvBuf += fmt.Sprintf("%v,%v\n", stamp.Unix(), i)
+		jsonBuf += fmt.Sprintf(`{"stamp": "%v", "value": %v}`+"\n", stamp.UTC().Format(time.RFC3339), i)
+	}
+	files := map[string]string{
+		"a.csv":   csvBuf,
+		"b.jsonl": jsonBuf,
+		"c.txt":   csvBuf,
+	}
+	for name, buf := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(buf), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ff, err := NewFileFetcher(time.Second*30, false, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths, err := ff.Expand(context.Background(), filepath.Join(dir, "*"))
+	if err != nil || len(paths) != 3 {
+		t.Fatalf("expand %v, err: %v", paths, err)
+	}
+
+	for _, path := range paths[:2] {
+		data, err := ff.Fetch(context.Background(), Source{Type: SourceFile, Key: path}, begin, begin.Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data.N() != 120 {
+			t.Fatalf("%v: %v points", path, data.N())
+		}
+		for i, p := range data.Points() {
+			if p.Value() != float64(i) {
+				t.Fatalf("%v: point %v: %v", path, i, p.Value())
+			}
+		}
+	}
+
+	// the relative keys are relative to the root
+	if data, err := ff.Fetch(context.Background(), Source{Type: SourceFile, Key: "a.csv"}, begin, begin.Add(time.Hour)); err != nil || data.N() != 120 {
+		t.Fatalf("fetch the relative key, err: %v", err)
+	}
+	if paths, err := ff.Expand(context.Background(), "*.csv"); err != nil || len(paths) != 1 || paths[0] != filepath.Join(ff.root, "a.csv") {
+		t.Fatalf("expand the relative pattern %v, err: %v", paths, err)
+	}
+
+	// the links out of the root are neither expanded nor fetched
+	outside, err := ioutil.TempFile("", "tsad_file_fetcher*.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(outside.Name())
+	outside.WriteString(csvBuf)
+	outside.Close()
+	if err := os.Symlink(outside.Name(), filepath.Join(dir, "d.csv")); err != nil {
+		t.Fatal(err)
+	}
+	if paths, err := ff.Expand(context.Background(), filepath.Join(dir, "*.csv")); err != nil || len(paths) != 1 {
+		t.Fatalf("expand %v with the link out of the root, err: %v", paths, err)
+	}
+
+	for _, src := range []Source{
+		{Type: SourceFile, Key: paths[2]},                       // unknown format
+		{Type: SourceFile, Key: filepath.Join(dir, "*.csv")},    // wildcards
+		{Type: SourceFile, Key: filepath.Join(dir, "../x.csv")}, // not in root
+		{Type: SourceFile, Key: "../x.csv"},                     // not in root
+		{Type: SourceFile, Key: filepath.Join(dir, "d.csv")},    // linked out of root
+	} {
+		if _, err := ff.Fetch(context.Background(), src, begin, begin.Add(time.Hour)); err == nil {
+			t.Fatalf("expect err for %v", src)
+		}
+	}
+}
+
+func TestFileFetcherTail(t *testing.T) {
+	f, err := ioutil.TempFile("", "tsad_file_fetcher*.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	ff, err := NewFileFetcher(time.Second*30, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	begin := time.Unix(1500000000, 0)
+	src := Source{Type: SourceFile, Key: f.Name()}
+	fetch := func() int {
+		data, err := ff.Fetch(context.Background(), src, begin, begin.Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data.N()
+	}
+
+	fmt.Fprintf(f, "timestamp,value\n%v,1\n%v,2\n%v,", begin.Unix(), begin.Unix()+30, begin.Unix()+60)
+	if n := fetch(); n != 2 {
+		t.Fatalf("%v points, the last row is not completed", n)
+	}
+	fmt.Fprintf(f, "3\n%v,4\n", begin.Unix()+90)
+	if n := fetch(); n != 4 {
+		t.Fatalf("%v points after appending", n)
+	}
+
+	// the caches of the files which are no longer fetched are evicted
+	fileCacheExpiration = 0
+	defer func() { fileCacheExpiration = time.Hour }()
+	other, err := ioutil.TempFile("", "tsad_file_fetcher*.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(other.Name())
+	other.Close()
+	time.Sleep(time.Millisecond)
+	if _, err := ff.Fetch(context.Background(), Source{Type: SourceFile, Key: other.Name()}, begin, begin.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ff.caches[f.Name()]; ok || len(ff.caches) != 1 {
+		t.Fatalf("the cache of %v is not evicted", f.Name())
+	}
+	if n := fetch(); n != 4 {
+		t.Fatalf("%v points after evicting", n)
+	}
+
+	// truncated
+	if err := f.Truncate(0); err != nil {
+		t.Fatal(err)
+	}
+	f.Seek(0, 0)
+	fmt.Fprintf(f, "%v,1\n", begin.Unix())
+	if n := fetch(); n != 1 {
+		t.Fatalf("%v points after truncating", n)
+	}
+}
@@ -0,0 +1,224 @@
+package tsfetcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.byted.org/gopkg/logs"
+	"code.byted.org/microservice/tsad/worker/ts"
+)
+
+// GraphiteTarget the placeholder of the metric path in the function wrapper, such as
+//  scale(nonNegativeDerivative($target), 0.5)
+const GraphiteTarget = "$target"
+
+type graphiteSeries struct {
+	Target     string           `json:"target"`
+	Datapoints [][2]interface{} `json:"datapoints"` // [value, timestamp]
+}
+
+/*
+GraphiteFetcher 通过graphite的/render API获取数据;
+	source的Key为metric路径, 不能包含通配符, 通配符需要先通过Expand展开;
+	Extra为函数包装, 包含GraphiteTarget时用Key替换它, 否则Extra为函数名, 如
+	nonNegativeDerivative, 查询的target为nonNegativeDerivative(Key);
+*/
+type GraphiteFetcher struct {
+	client *http.Client
+
+	graphiteAPI string // such as http://my_host:8080
+	step        time.Duration
+	timeout     time.Duration
+	retry       int
+	limiter     *ConcLimiter
+}
+
+func init() {
+	Register(SourceGraphite, func(conf BackendConfig) (TSFetcher, error) {
+		gf, err := NewGraphiteFetcher(conf.API, stepOrDefault(conf.Step, time.Minute), conf.Retry, conf.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		gf.limiter = newBackendLimiter(conf)
+		return gf, nil
+	})
+}
+
+// NewGraphiteFetcher .
+func NewGraphiteFetcher(graphiteAPI string, step time.Duration, defaultRetry int, defaultTimeout time.Duration) (*GraphiteFetcher, error) {
+	if _, err := url.Parse(graphiteAPI); err != nil || graphiteAPI == "" {
+		return nil, fmt.Errorf("invalid graphite api: %v", graphiteAPI)
+	}
+	if step <= 0 {
+		return nil, fmt.Errorf("invalid step: %v", step)
+	}
+
+	return &GraphiteFetcher{
+		client:      &http.Client{},
+		graphiteAPI: strings.TrimRight(graphiteAPI, "/"),
+		step:        step,
+		timeout:     defaultTimeout,
+		retry:       defaultRetry,
+		limiter:     NewConcLimiter(DefaultConcurrency),
+	}, nil
+}
+
+// Fetch .
+func (gf *GraphiteFetcher) Fetch(ctx context.Context, src Source, begin, end time.Time) (ts.TS, error) {
+	target, err := graphiteTarget(src)
+	if err != nil {
+		return nil, err
+	}
+
+	points, err := fetchByDay(begin, end, func(begin, end time.Time) (ts.Points, error) {
+		return gf.fetch(ctx, target, begin, end)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	points = complete(points, gf.step)
+	return ts.NewTS(StepTSAttrs(gf.step), points), nil
+}
+
+func graphiteTarget(src Source) (string, error) {
+	if src.Type != SourceGraphite {
+		return "", fmt.Errorf("not a graphite source type: %v", src.Type)
+	}
+	if src.Key == "" {
+		return "", fmt.Errorf("source Key can not be null")
+	}
+	if hasGraphiteWildcard(src.Key) {
+		return "", fmt.Errorf("source Key can not contains wildcards, Key: %v", src.Key)
+	}
+
+	wrapper := strings.TrimSpace(src.Extra)
+	switch {
+	case wrapper == "":
+		return src.Key, nil
+	case strings.Contains(wrapper, GraphiteTarget):
+		return strings.Replace(wrapper, GraphiteTarget, src.Key, -1), nil
+	default:
+		return fmt.Sprintf("%v(%v)", wrapper, src.Key), nil
+	}
+}
+
+func hasGraphiteWildcard(path string) bool {
+	return strings.ContainsAny(path, "*?[]{}")
+}
+
+func (gf *GraphiteFetcher) fetch(ctx context.Context, target string, begin, end time.Time) (ts.Points, error) {
+	params := url.Values{}
+	params.Set("target", target)
+	params.Set("from", strconv.FormatInt(begin.Unix(), 10))
+	params.Set("until", strconv.FormatInt(end.Unix(), 10))
+	params.Set("format", "json")
+
+	var series []*graphiteSeries
+	if err := gf.query(ctx, "/render", params, &series); err != nil {
+		return nil, err
+	}
+	if len(series) == 0 {
+		return nil, nil
+	}
+	if len(series) > 1 {
+		return nil, fmt.Errorf("%v series in target: %v", len(series), target)
+	}
+
+	points := make(ts.Points, 0, len(series[0].Datapoints))
+	for _, dp := range series[0].Datapoints {
+		if dp[0] == nil {
+			continue
+		}
+		val, ok := dp[0].(float64)
+		if !ok {
+			return nil, fmt.Errorf("invalid value: %v", dp[0])
+		}
+		stamp, ok := dp[1].(float64)
+		if !ok {
+			return nil, fmt.Errorf("invalid timestamp: %v", dp[1])
+		}
+		points = append(points, ts.NewPoint(time.Unix(int64(stamp), 0), val))
+	}
+	return points, nil
+}
+
+// Derive 展开metric路径中的通配符
+func (gf *GraphiteFetcher) Derive(ctx context.Context, src Source) ([]Source, error) {
+	return deriveExpanded(ctx, src, gf.Expand)
+}
+
+// Expand 展开含有通配符的metric路径, 返回所有匹配的叶子节点, 已排序;
+func (gf *GraphiteFetcher) Expand(ctx context.Context, pattern string) ([]string, error) {
+	if !hasGraphiteWildcard(pattern) {
+		return []string{pattern}, nil
+	}
+
+	params := url.Values{}
+	params.Set("query", pattern)
+	params.Set("leavesOnly", "1")
+
+	var resp struct {
+		Results []string `json:"results"`
+	}
+	if err := gf.query(ctx, "/metrics/expand", params, &resp); err != nil {
+		return nil, err
+	}
+	sort.Strings(resp.Results)
+	return resp.Results, nil
+}
+
+func (gf *GraphiteFetcher) query(ctx context.Context, path string, params url.Values, result interface{}) (rerr error) {
+	timeout := gf.timeout
+	retry := gf.retry
+	if t, ok := GetTimeout(ctx); ok {
+		timeout = t
+	}
+	if r, ok := GetRetry(ctx); ok {
+		retry = r
+	}
+
+	graphiteURL := gf.graphiteAPI + path + "?" + params.Encode()
+	defer func(begin time.Time) {
+		cost := time.Now().Sub(begin)
+		if rerr == nil {
+			logs.Infof("[GraphiteFetcher] query url=%v successfully, cost=%v", graphiteURL, cost)
+		} else {
+			logs.Errorf("[GraphiteFetcher] query url=%v error, cost=%v, err=%v", graphiteURL, cost, rerr)
+		}
+	}(time.Now())
+
+	if v := ctx.Value("noblock"); v == nil {
+		gf.limiter.Wait()
+		defer gf.limiter.Release()
+	}
+
+	return retryQuery(ctx, retry, func() error {
+		req, err := http.NewRequest("GET", graphiteURL, nil)
+		if err != nil {
+			return err
+		}
+		status, buf, err := doHTTP(ctx, gf.client, req, timeout)
+		if err != nil {
+			return fmt.Errorf("request graphite err: %v", err)
+		}
+		if status != http.StatusOK {
+			err := fmt.Errorf("query graphite err: %v, status: %v", strings.TrimSpace(string(buf)), status)
+			if status == http.StatusBadRequest {
+				return &queryError{err}
+			}
+			return err
+		}
+		if err := json.Unmarshal(buf, result); err != nil {
+			return fmt.Errorf("invalid graphite resp: %v", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,109 @@
+package tsfetcher
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newGraphiteServer a stand-in of graphite, servers.*.cpu matches two metrics,
+//  and the value of each point is its timestamp
+func newGraphiteServer(t *testing.T) *httptest.Server {
+	metrics := []string{"servers.b.cpu", "servers.a.cpu"}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch r.URL.Path {
+		case "/metrics/expand":
+			if q.Get("query") != "servers.*.cpu" || q.Get("leavesOnly") != "1" {
+				t.Errorf("unexpected expand: %v", r.URL)
+			}
+			fmt.Fprintf(w, `{"results":["%v"]}`, strings.Join(metrics, `","`))
+		case "/render":
+			target := q.Get("target")
+			if q.Get("format") != "json" || (target != "servers.a.cpu" && target != "scale(servers.a.cpu, 1)") {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, "invalid target")
+				return
+			}
+			from, _ := strconv.ParseInt(q.Get("from"), 10, 64)
+			until, _ := strconv.ParseInt(q.Get("until"), 10, 64)
+			var dps []string
+			for s := from - from%60 + 60; s <= until; s += 60 {
+				if s%3600 == 0 {
+					dps = append(dps, fmt.Sprintf("[null,%v]", s))
+					continue
+				}
+				dps = append(dps, fmt.Sprintf("[%v,%v]", s, s))
+			}
+			fmt.Fprintf(w, `[{"target":"%v","datapoints":[%v]}]`, target, strings.Join(dps, ","))
+		default:
+			t.Errorf("unexpected path: %v", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestGraphiteFetcher(t *testing.T) {
+	server := newGraphiteServer(t)
+	defer server.Close()
+
+	gf, err := NewGraphiteFetcher(server.URL, time.Minute, 1, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := gf.Expand(context.Background(), "servers.*.cpu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 || paths[0] != "servers.a.cpu" {
+		t.Fatalf("unexpected paths: %v", paths)
+	}
+
+	begin := time.Unix(1500000000, 0)
+	end := begin.Add(time.Hour * 36)
+	for _, extra := range []string{"", "scale($target, 1)"} {
+		src := Source{Type: SourceGraphite, Key: paths[0], Extra: extra}
+		data, err := gf.Fetch(context.Background(), src, begin, end)
+		if err != nil {
+			t.Fatalf("extra %v: %v", extra, err)
+		}
+		if n := int(end.Sub(begin) / time.Minute); data.N() != n {
+			t.Fatalf("extra %v: %v points, expect %v", extra, data.N(), n)
+		}
+		for _, p := range data.Points() {
+			if float64(p.Stamp().Unix()) != p.Value() {
+				t.Fatalf("extra %v: point %v: %v", extra, p.Stamp(), p.Value())
+			}
+		}
+	}
+
+	for _, src := range []Source{
+		{Type: SourceGraphite, Key: "servers.*.cpu"},
+		{Type: SourceGraphite, Key: "servers.a.cpu", Extra: "unknown"},
+		{Type: SourceTSDB, Key: "servers.a.cpu"},
+	} {
+		if _, err := gf.Fetch(context.Background(), src, begin, end); err == nil {
+			t.Fatalf("expect err for %v", src)
+		}
+	}
+}
+
+func TestGraphiteTarget(t *testing.T) {
+	cases := map[string]string{
+		"":                      "a.b",
+		"nonNegativeDerivative": "nonNegativeDerivative(a.b)",
+		"scale($target, 0.5)":   "scale(a.b, 0.5)",
+	}
+	for extra, expect := range cases {
+		target, err := graphiteTarget(Source{Type: SourceGraphite, Key: "a.b", Extra: extra})
+		if err != nil || target != expect {
+			t.Fatalf("extra %v: target %v, err: %v, expect %v", extra, target, err, expect)
+		}
+	}
+}
@@ -0,0 +1,441 @@
+package tsfetcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.byted.org/gopkg/logs"
+	"code.byted.org/microservice/tsad/worker/ts"
+)
+
+// the placeholders in the url template of a http source
+const (
+	HTTPBegin   = "{begin}"    // unix seconds of the begin time
+	HTTPEnd     = "{end}"      // unix seconds of the end time
+	HTTPBeginMS = "{begin_ms}" // unix milliseconds of the begin time
+	HTTPEndMS   = "{end_ms}"   // unix milliseconds of the end time
+)
+
+/*
+HTTPSourceSpec http类型source的Extra, 描述如何从返回的JSON中提取数据, 路径为JSONPath(见parseJSONPath);
+	Points不为空时, 它匹配的每个节点是一行, Stamp, Value, Labels为相对于行的路径, 如:
+		{"points": "$.data[*]", "stamp": "@.time", "value": "@.count", "labels": {"host": "@.host"}}
+	Points为空时, Stamp和Value匹配的节点按顺序组成点, Labels为相对于根节点的路径, 如:
+		{"stamp": "$.timestamps[*]", "value": "$.values[*]"}
+	StampUnit为数值类型的timestamp的单位, 可以是s, ms, us, ns, 默认为s; 字符串类型的timestamp为RFC3339格式;
+	Series为选中的labels, 只取labels与它完全相同的行; 为空时, 返回结果必须只有一组labels;
+*/
+type HTTPSourceSpec struct {
+	Points    string            `json:"points,omitempty"`
+	Stamp     string            `json:"stamp"`
+	Value     string            `json:"value"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	StampUnit string            `json:"stamp_unit,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Series    map[string]string `json:"series,omitempty"`
+}
+
+// httpRow .
+type httpRow struct {
+	stamp  time.Time
+	value  float64
+	labels map[string]string
+}
+
+/*
+HTTPFetcher 通过GET请求任意返回JSON的HTTP接口获取数据;
+	source的Key为url模板, 其中的HTTPBegin, HTTPEnd, HTTPBeginMS, HTTPEndMS会被替换成查询的时间, 如:
+		http://my_host/api/stats?from={begin}&to={end}
+	Extra为HTTPSourceSpec的JSON;
+	点按freq对齐, 同一个间隔中的多个点取平均值;
+	allowedHosts为可以请求的host, 包含*时允许所有host, 重定向的目标也必须是允许的host;
+*/
+type HTTPFetcher struct {
+	client *http.Client
+
+	freq         time.Duration
+	timeout      time.Duration
+	retry        int
+	allowedHosts map[string]bool
+	limiter      *ConcLimiter
+}
+
+/*
+init 注册HTTP, Options:
+	allowed_hosts: 可以请求的host, 以逗号分隔, *表示所有host;
+*/
+func init() {
+	Register(SourceHTTP, func(conf BackendConfig) (TSFetcher, error) {
+		var hosts []string
+		for _, h := range strings.Split(conf.Options["allowed_hosts"], ",") {
+			if h = strings.TrimSpace(h); h != "" {
+				hosts = append(hosts, h)
+			}
+		}
+		hf, err := NewHTTPFetcher(hosts, stepOrDefault(conf.Step, TSDBTSAttr.Frequency), conf.Retry, conf.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		hf.limiter = newBackendLimiter(conf)
+		return hf, nil
+	})
+}
+
+// NewHTTPFetcher .
+func NewHTTPFetcher(allowedHosts []string, freq time.Duration, defaultRetry int, defaultTimeout time.Duration) (*HTTPFetcher, error) {
+	if len(allowedHosts) == 0 {
+		return nil, fmt.Errorf("no allowed hosts")
+	}
+	if freq <= 0 {
+		return nil, fmt.Errorf("invalid frequency: %v", freq)
+	}
+
+	hosts := make(map[string]bool, len(allowedHosts))
+	for _, h := range allowedHosts {
+		hosts[strings.ToLower(h)] = true
+	}
+	hf := &HTTPFetcher{
+		freq:         freq,
+		timeout:      defaultTimeout,
+		retry:        defaultRetry,
+		allowedHosts: hosts,
+		limiter:      NewConcLimiter(DefaultConcurrency),
+	}
+	hf.client = &http.Client{CheckRedirect: hf.checkRedirect}
+	return hf, nil
+}
+
+// allowed .
+func (hf *HTTPFetcher) allowed(u *url.URL) bool {
+	return hf.allowedHosts["*"] || hf.allowedHosts[strings.ToLower(u.Host)] || hf.allowedHosts[strings.ToLower(u.Hostname())]
+}
+
+// checkRedirect 重定向的目标也必须是允许的host
+func (hf *HTTPFetcher) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return fmt.Errorf("stopped after 10 redirects")
+	}
+	if !hf.allowed(req.URL) {
+		return fmt.Errorf("redirect to host %v is not allowed", req.URL.Host)
+	}
+	return nil
+}
+
+// ParseHTTPSourceSpec .
+func ParseHTTPSourceSpec(extra string) (*HTTPSourceSpec, error) {
+	spec := &HTTPSourceSpec{}
+	if err := json.Unmarshal([]byte(extra), spec); err != nil {
+		return nil, fmt.Errorf("invalid source Extra: %v, err: %v", extra, err)
+	}
+	if spec.Stamp == "" || spec.Value == "" {
+		return nil, fmt.Errorf("stamp and value paths are required, Extra: %v", extra)
+	}
+	if _, err := httpStampUnit(spec.StampUnit); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+func httpStampUnit(unit string) (time.Duration, error) {
+	switch unit {
+	case "", "s":
+		return time.Second, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "us":
+		return time.Microsecond, nil
+	case "ns":
+		return time.Nanosecond, nil
+	}
+	return 0, fmt.Errorf("invalid stamp unit: %v", unit)
+}
+
+// Fetch .
+func (hf *HTTPFetcher) Fetch(ctx context.Context, src Source, begin, end time.Time) (ts.TS, error) {
+	if src.Type != SourceHTTP {
+		return nil, fmt.Errorf("not a http source type: %v", src.Type)
+	}
+	spec, err := ParseHTTPSourceSpec(src.Extra)
+	if err != nil {
+		return nil, err
+	}
+
+	points, err := fetchByDay(begin, end, func(begin, end time.Time) (ts.Points, error) {
+		rows, err := hf.query(ctx, src.Key, spec, begin, end)
+		if err != nil {
+			return nil, err
+		}
+
+		var points ts.Points
+		labels := ""
+		for _, r := range rows {
+			if len(spec.Series) > 0 {
+				if !tagsEqual(r.labels, spec.Series) {
+					continue
+				}
+			} else if l := formatTags(r.labels); labels == "" {
+				labels = l
+			} else if l != labels {
+				return nil, fmt.Errorf("more than one series in %v, please derive it", src.Key)
+			}
+			if r.stamp.Before(begin) || r.stamp.After(end) {
+				continue
+			}
+			points = append(points, ts.NewPoint(r.stamp, r.value))
+		}
+		sortPoints(points)
+		return points, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	points = complete(bucketPoints(points, hf.freq, aggregateAvg), hf.freq)
+	return ts.NewTS(StepTSAttrs(hf.freq), points), nil
+}
+
+// Derive 返回src最近10分钟结果中的每组labels对应的source, 已排序;
+func (hf *HTTPFetcher) Derive(ctx context.Context, src Source) ([]Source, error) {
+	spec, err := ParseHTTPSourceSpec(src.Extra)
+	if err != nil {
+		return nil, err
+	}
+	if len(spec.Series) > 0 || len(spec.Labels) == 0 {
+		return []Source{src}, nil
+	}
+
+	end := time.Now()
+	rows, err := hf.query(ctx, src.Key, spec, end.Add(-time.Minute*10), end)
+	if err != nil {
+		return nil, err
+	}
+
+	series := make(map[string]map[string]string)
+	for _, r := range rows {
+		series[formatTags(r.labels)] = r.labels
+	}
+	keys := make([]string, 0, len(series))
+	for k := range series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	srcs := make([]Source, 0, len(keys))
+	for _, k := range keys {
+		derived := *spec
+		derived.Series = series[k]
+		buf, err := json.Marshal(derived)
+		if err != nil {
+			return nil, err
+		}
+		srcs = append(srcs, Source{Type: src.Type, Key: src.Key, Extra: string(buf)})
+	}
+	return srcs, nil
+}
+
+// httpURL 替换tmpl中的占位符, 并检查host
+func (hf *HTTPFetcher) httpURL(tmpl string, begin, end time.Time) (string, error) {
+	if tmpl == "" {
+		return "", fmt.Errorf("source Key can not be null")
+	}
+	r := strings.NewReplacer(
+		HTTPBeginMS, strconv.FormatInt(begin.UnixNano()/int64(time.Millisecond), 10),
+		HTTPEndMS, strconv.FormatInt(end.UnixNano()/int64(time.Millisecond), 10),
+		HTTPBegin, strconv.FormatInt(begin.Unix(), 10),
+		HTTPEnd, strconv.FormatInt(end.Unix(), 10),
+	)
+	str := r.Replace(tmpl)
+
+	u, err := url.Parse(str)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", fmt.Errorf("invalid url: %v", str)
+	}
+	if !hf.allowed(u) {
+		return "", fmt.Errorf("host %v is not allowed", u.Host)
+	}
+	return str, nil
+}
+
+func (hf *HTTPFetcher) query(ctx context.Context, tmpl string, spec *HTTPSourceSpec, begin, end time.Time) (rows []*httpRow, rerr error) {
+	httpURL, err := hf.httpURL(tmpl, begin, end)
+	if err != nil {
+		return nil, err
+	}
+	timeout := hf.timeout
+	retry := hf.retry
+	if t, ok := GetTimeout(ctx); ok {
+		timeout = t
+	}
+	if r, ok := GetRetry(ctx); ok {
+		retry = r
+	}
+
+	defer func(begin time.Time) {
+		cost := time.Now().Sub(begin)
+		if rerr == nil {
+			logs.Infof("[HTTPFetcher] query url=%v successfully, cost=%v", httpURL, cost)
+		} else {
+			logs.Errorf("[HTTPFetcher] query url=%v error, cost=%v, err=%v", httpURL, cost, rerr)
+		}
+	}(time.Now())
+
+	if v := ctx.Value("noblock"); v == nil {
+		hf.limiter.Wait()
+		defer hf.limiter.Release()
+	}
+
+	var data interface{}
+	err = retryQuery(ctx, retry, func() error {
+		req, err := http.NewRequest("GET", httpURL, nil)
+		if err != nil {
+			return &queryError{err}
+		}
+		req.Header.Set("Accept", "application/json")
+		for k, v := range spec.Headers {
+			req.Header.Set(k, v)
+		}
+		status, buf, err := doHTTP(ctx, hf.client, req, timeout)
+		if err != nil {
+			return fmt.Errorf("request err: %v", err)
+		}
+		if status != http.StatusOK {
+			err := fmt.Errorf("query err: %v, status: %v", strings.TrimSpace(string(buf)), status)
+			if status >= http.StatusBadRequest && status < http.StatusInternalServerError {
+				return &queryError{err}
+			}
+			return err
+		}
+		if err := json.Unmarshal(buf, &data); err != nil {
+			return &queryError{fmt.Errorf("invalid JSON: %v", err)}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return extractHTTPRows(data, spec)
+}
+
+// extractHTTPRows 按spec从data中提取行
+func extractHTTPRows(data interface{}, spec *HTTPSourceSpec) ([]*httpRow, error) {
+	unit, err := httpStampUnit(spec.StampUnit)
+	if err != nil {
+		return nil, err
+	}
+	stampPath, err := parseJSONPath(spec.Stamp)
+	if err != nil {
+		return nil, err
+	}
+	valuePath, err := parseJSONPath(spec.Value)
+	if err != nil {
+		return nil, err
+	}
+	labelPaths := make(map[string][]jsonPathStep, len(spec.Labels))
+	for name, path := range spec.Labels {
+		if labelPaths[name], err = parseJSONPath(path); err != nil {
+			return nil, err
+		}
+	}
+	labelsOf := func(node interface{}) map[string]string {
+		labels := make(map[string]string, len(labelPaths))
+		for name, path := range labelPaths {
+			if vals := evalJSONPath(node, path); len(vals) > 0 && vals[0] != nil {
+				labels[name] = fmt.Sprint(vals[0])
+			}
+		}
+		return labels
+	}
+
+	var rows []*httpRow
+	appendRow := func(stampVal, valueVal interface{}, labels map[string]string) error {
+		if valueVal == nil {
+			return nil
+		}
+		stamp, err := httpStamp(stampVal, unit)
+		if err != nil {
+			return err
+		}
+		value, err := httpFloat(valueVal)
+		if err != nil {
+			return err
+		}
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return nil
+		}
+		rows = append(rows, &httpRow{stamp: stamp, value: value, labels: labels})
+		return nil
+	}
+
+	if spec.Points == "" {
+		stamps := evalJSONPath(data, stampPath)
+		values := evalJSONPath(data, valuePath)
+		if len(stamps) != len(values) {
+			return nil, fmt.Errorf("%v stamps but %v values", len(stamps), len(values))
+		}
+		labels := labelsOf(data)
+		for i := range stamps {
+			if err := appendRow(stamps[i], values[i], labels); err != nil {
+				return nil, err
+			}
+		}
+		return rows, nil
+	}
+
+	pointsPath, err := parseJSONPath(spec.Points)
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range evalJSONPath(data, pointsPath) {
+		stamps := evalJSONPath(node, stampPath)
+		values := evalJSONPath(node, valuePath)
+		if len(stamps) == 0 || len(values) == 0 {
+			continue
+		}
+		if err := appendRow(stamps[0], values[0], labelsOf(node)); err != nil {
+			return nil, err
+		}
+	}
+	return rows, nil
+}
+
+func httpStamp(v interface{}, unit time.Duration) (time.Time, error) {
+	switch val := v.(type) {
+	case float64:
+		return time.Unix(0, int64(val*float64(unit))), nil
+	case string:
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			return time.Unix(0, int64(f*float64(unit))), nil
+		}
+		if t, err := time.Parse(time.RFC3339Nano, val); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp: %v", v)
+}
+
+func httpFloat(v interface{}) (float64, error) {
+	switch val := v.(type) {
+	case float64:
+		return val, nil
+	case bool:
+		if val {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid value: %v", val)
+		}
+		return f, nil
+	}
+	return 0, fmt.Errorf("invalid value: %v", v)
+}
@@ -0,0 +1,172 @@
+package tsfetcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONPath(t *testing.T) {
+	var data interface{}
+	json.Unmarshal([]byte(`{"data": [{"t": 1, "v": 2, "tags": {"host": "a"}}, {"t": 3, "v": 4}], "name": "x"}`), &data)
+
+	cases := []struct {
+		path string
+		expt []interface{}
+	}{
+		{"$.name", []interface{}{"x"}},
+		{"name", []interface{}{"x"}},
+		{"$.data[*].t", []interface{}{1.0, 3.0}},
+		{"$['data'][-1].v", []interface{}{4.0}},
+		{`$.data[0]["tags"].host`, []interface{}{"a"}},
+		{"$.data[*].tags.host", []interface{}{"a"}},
+		{"$.data[5]", nil},
+		{"$.missing.t", nil},
+	}
+	for _, c := range cases {
+		steps, err := parseJSONPath(c.path)
+		if err != nil {
+			t.Fatalf("%v: %v", c.path, err)
+		}
+		if got := evalJSONPath(data, steps); !reflect.DeepEqual(got, c.expt) {
+			t.Fatalf("%v: %v, expect %v", c.path, got, c.expt)
+		}
+	}
+
+	for _, path := range []string{"$..t", "$.data[", "$.data[x]"} {
+		if _, err := parseJSONPath(path); err == nil {
+			t.Fatalf("expect error for %v", path)
+		}
+	}
+}
+
+// newHTTPJSONServer returns a point each minute for host a and b in /rows,
+//  and the points of a single series as parallel arrays in /arrays;
+//  /moved redirects to /arrays, and /escape redirects to another host
+func newHTTPJSONServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		q := r.URL.Query()
+		from, _ := strconv.ParseInt(q.Get("from"), 10, 64)
+		to, _ := strconv.ParseInt(q.Get("to"), 10, 64)
+		var rows, stamps, values []string
+		for s := from - from%60 + 60; s <= to; s += 60 {
+			rows = append(rows,
+				fmt.Sprintf(`{"time":%v,"count":"%v","host":"a"}`, s*1000, s),
+				fmt.Sprintf(`{"time":%v,"count":%v,"host":"b"}`, s*1000, -s))
+			stamps = append(stamps, strconv.Quote(time.Unix(s, 0).UTC().Format(time.RFC3339)))
+			values = append(values, strconv.FormatInt(s, 10))
+		}
+		switch r.URL.Path {
+		case "/rows":
+			fmt.Fprintf(w, `{"data":[%v]}`, strings.Join(rows, ","))
+		case "/arrays":
+			fmt.Fprintf(w, `{"timestamps":[%v],"values":[%v]}`, strings.Join(stamps, ","), strings.Join(values, ","))
+		case "/moved":
+			http.Redirect(w, r, "/arrays?"+r.URL.RawQuery, http.StatusFound)
+		case "/escape":
+			http.Redirect(w, r, "http://other.host/arrays", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestHTTPFetcher(t *testing.T) {
+	server := newHTTPJSONServer(t)
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+
+	hf, err := NewHTTPFetcher([]string{u.Host}, time.Minute, 1, time.Second*5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	begin := time.Unix(1500000000, 0).Truncate(time.Minute)
+	end := begin.Add(time.Minute * 30)
+	rowsSrc := Source{
+		Type:  SourceHTTP,
+		Key:   server.URL + "/rows?from={begin}&to={end}",
+		Extra: `{"points":"$.data[*]","stamp":"@.time","value":"@.count","labels":{"host":"@.host"},"stamp_unit":"ms","headers":{"X-Token":"secret"}}`,
+	}
+
+	// two series, derive it first
+	if _, err := hf.Fetch(context.Background(), rowsSrc, begin, end); err == nil {
+		t.Fatal("expect error for more than one series")
+	}
+	srcs, err := hf.Derive(context.Background(), rowsSrc)
+	if err != nil || len(srcs) != 2 {
+		t.Fatalf("derived %v, err: %v", srcs, err)
+	}
+	spec, _ := ParseHTTPSourceSpec(srcs[0].Extra)
+	if !reflect.DeepEqual(spec.Series, map[string]string{"host": "a"}) {
+		t.Fatalf("series %v, expect host a", spec.Series)
+	}
+
+	data, err := hf.Fetch(context.Background(), srcs[0], begin, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.N() != 30 {
+		t.Fatalf("%v points, expect 30", data.N())
+	}
+	for _, p := range data.Points() {
+		if p.Value() != float64(p.Stamp().Unix()) {
+			t.Fatalf("value %v at %v", p.Value(), p.Stamp())
+		}
+	}
+
+	arraysSrc := Source{
+		Type:  SourceHTTP,
+		Key:   server.URL + "/arrays?from={begin}&to={end}",
+		Extra: `{"stamp":"$.timestamps[*]","value":"$.values[*]","headers":{"X-Token":"secret"}}`,
+	}
+	data, err = hf.Fetch(context.Background(), arraysSrc, begin, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.N() != 30 || data.Points()[0].Value() != float64(data.Points()[0].Stamp().Unix()) {
+		t.Fatalf("%v points: %v", data.N(), data.Points())
+	}
+
+	// the redirects are followed only if the target host is allowed
+	arraysSrc.Key = server.URL + "/moved?from={begin}&to={end}"
+	if data, err = hf.Fetch(context.Background(), arraysSrc, begin, end); err != nil || data.N() != 30 {
+		t.Fatalf("fetch the redirected url err: %v", err)
+	}
+	arraysSrc.Key = server.URL + "/escape?from={begin}&to={end}"
+	if _, err := hf.Fetch(context.Background(), arraysSrc, begin, end); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Fatalf("expect not allowed, got %v", err)
+	}
+
+	// too large response
+	maxRespBody = 100
+	arraysSrc.Key = server.URL + "/arrays?from={begin}&to={end}"
+	_, err = hf.Fetch(context.Background(), arraysSrc, begin, end)
+	maxRespBody = 64 << 20
+	if err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Fatalf("expect too large, got %v", err)
+	}
+
+	// no token
+	arraysSrc.Extra = `{"stamp":"$.timestamps[*]","value":"$.values[*]"}`
+	if _, err := hf.Fetch(context.Background(), arraysSrc, begin, end); err == nil {
+		t.Fatal("expect error without the token")
+	}
+	// host not allowed
+	arraysSrc.Key = "http://other.host/arrays"
+	if _, err := hf.Fetch(context.Background(), arraysSrc, begin, end); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Fatalf("expect not allowed, got %v", err)
+	}
+}
@@ -0,0 +1,441 @@
+package tsfetcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.byted.org/gopkg/logs"
+	"code.byted.org/microservice/tsad/worker/ts"
+)
+
+const (
+	// InfluxQLTimeFilter the placeholder of the time range in InfluxQL, such as
+	//  SELECT mean("usage") FROM "cpu" WHERE $timeFilter GROUP BY time($interval), *
+	InfluxQLTimeFilter = "$timeFilter"
+	// FluxRange the placeholder of the time range in Flux, such as
+	//  from(bucket: "telegraf") |> $range |> filter(fn: (r) => r._measurement == "cpu") |> aggregateWindow(every: $interval, fn: mean)
+	FluxRange = "$range"
+	// InfluxInterval the placeholder of the step, such as 30s
+	InfluxInterval = "$interval"
+)
+
+// InfluxDBOptions .
+type InfluxDBOptions struct {
+	API      string // such as http://my_host:8086
+	Database string // for InfluxQL
+	Org      string // for Flux
+	Token    string // optional
+
+	Step    time.Duration
+	Retry   int
+	Timeout time.Duration
+}
+
+type influxSeries struct {
+	Name    string            `json:"name"`
+	Tags    map[string]string `json:"tags"`
+	Columns []string          `json:"columns"`
+	Values  [][]interface{}   `json:"values"`
+}
+
+type influxQLResp struct {
+	Results []struct {
+		Series []*influxSeries `json:"series"`
+		Error  string          `json:"error"`
+	} `json:"results"`
+	Error string `json:"error"`
+}
+
+/*
+InfluxDBFetcher 通过influxdb的HTTP API获取数据, 支持InfluxQL和Flux;
+	source的Key为查询语句, 包含InfluxQLTimeFilter的为InfluxQL, 包含FluxRange的为Flux,
+	查询时用InfluxInterval替换成Step;
+	Extra为tag集合(见formatTags), 查询结果中只取tags和Extra完全相同的那条ts,
+	Extra为空时, 查询结果必须只有一条ts;
+	InfluxQL中series的measurement不作为tag; Flux中除了_time和_value之外的group key都是tag;
+*/
+type InfluxDBFetcher struct {
+	client  *http.Client
+	op      InfluxDBOptions
+	limiter *ConcLimiter
+}
+
+/*
+init 注册InfluxDB, Options:
+	database: InfluxQL查询的数据库;
+	org: Flux查询的organization;
+	token: 可选;
+*/
+func init() {
+	Register(SourceInfluxDB, func(conf BackendConfig) (TSFetcher, error) {
+		inf, err := NewInfluxDBFetcher(InfluxDBOptions{
+			API:      conf.API,
+			Database: conf.Options["database"],
+			Org:      conf.Options["org"],
+			Token:    conf.Options["token"],
+			Step:     stepOrDefault(conf.Step, TSDBTSAttr.Frequency),
+			Retry:    conf.Retry,
+			Timeout:  conf.Timeout,
+		})
+		if err != nil {
+			return nil, err
+		}
+		inf.limiter = newBackendLimiter(conf)
+		return inf, nil
+	})
+}
+
+// NewInfluxDBFetcher .
+func NewInfluxDBFetcher(op InfluxDBOptions) (*InfluxDBFetcher, error) {
+	if _, err := url.Parse(op.API); err != nil || op.API == "" {
+		return nil, fmt.Errorf("invalid influxdb api: %v", op.API)
+	}
+	if op.Step <= 0 {
+		return nil, fmt.Errorf("invalid step: %v", op.Step)
+	}
+	op.API = strings.TrimRight(op.API, "/")
+
+	return &InfluxDBFetcher{
+		client:  &http.Client{},
+		op:      op,
+		limiter: NewConcLimiter(DefaultConcurrency),
+	}, nil
+}
+
+// influxSeriesPoints a series and its points
+type influxSeriesPoints struct {
+	tags   map[string]string
+	points ts.Points
+}
+
+// Fetch .
+func (inf *InfluxDBFetcher) Fetch(ctx context.Context, src Source, begin, end time.Time) (ts.TS, error) {
+	if src.Type != SourceInfluxDB {
+		return nil, fmt.Errorf("not a influxdb source type: %v", src.Type)
+	}
+	tags, err := parseTags(src.Extra)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source Extra: %v, err: %v", src.Extra, err)
+	}
+
+	points, err := fetchByDay(begin, end, func(begin, end time.Time) (ts.Points, error) {
+		series, err := inf.query(ctx, src.Key, begin, end)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(tags) == 0 {
+			if len(series) > 1 {
+				return nil, fmt.Errorf("%v series in query: %v, please derive it", len(series), src.Key)
+			}
+			if len(series) == 1 {
+				return series[0].points, nil
+			}
+			return nil, nil
+		}
+		for _, s := range series {
+			if tagsEqual(s.tags, tags) {
+				return s.points, nil
+			}
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	points = complete(points, inf.op.Step)
+	return ts.NewTS(StepTSAttrs(inf.op.Step), points), nil
+}
+
+// Derive 展开GROUP BY的每个tag集合
+func (inf *InfluxDBFetcher) Derive(ctx context.Context, src Source) ([]Source, error) {
+	return deriveSeries(ctx, src, inf.Series)
+}
+
+// Series 返回query最近10分钟结果中每条ts的tag集合, 可以作为source的Extra;
+func (inf *InfluxDBFetcher) Series(ctx context.Context, query string) ([]string, error) {
+	end := time.Now()
+	series, err := inf.query(ctx, query, end.Add(-time.Minute*10), end)
+	if err != nil {
+		return nil, err
+	}
+
+	extras := make([]string, 0, len(series))
+	for _, s := range series {
+		extras = append(extras, formatTags(s.tags))
+	}
+	sort.Strings(extras)
+	return extras, nil
+}
+
+func (inf *InfluxDBFetcher) query(ctx context.Context, query string, begin, end time.Time) (series []*influxSeriesPoints, rerr error) {
+	timeout := inf.op.Timeout
+	retry := inf.op.Retry
+	if t, ok := GetTimeout(ctx); ok {
+		timeout = t
+	}
+	if r, ok := GetRetry(ctx); ok {
+		retry = r
+	}
+
+	var do func() ([]*influxSeriesPoints, error)
+	interval := fmt.Sprintf("%vs", int64(inf.op.Step/time.Second))
+	switch {
+	case strings.Contains(query, InfluxQLTimeFilter):
+		filter := fmt.Sprintf("time >= %vs AND time < %vs", begin.Unix(), end.Unix())
+		query = strings.Replace(query, InfluxQLTimeFilter, filter, -1)
+		query = strings.Replace(query, InfluxInterval, interval, -1)
+		do = func() ([]*influxSeriesPoints, error) { return inf.doInfluxQL(ctx, query, timeout) }
+	case strings.Contains(query, FluxRange):
+		rng := fmt.Sprintf("range(start: %v, stop: %v)", begin.UTC().Format(time.RFC3339), end.UTC().Format(time.RFC3339))
+		query = strings.Replace(query, FluxRange, rng, -1)
+		query = strings.Replace(query, InfluxInterval, interval, -1)
+		do = func() ([]*influxSeriesPoints, error) { return inf.doFlux(ctx, query, timeout) }
+	default:
+		return nil, fmt.Errorf("query should contain %v or %v: %v", InfluxQLTimeFilter, FluxRange, query)
+	}
+
+	defer func(begin time.Time) {
+		cost := time.Now().Sub(begin)
+		if rerr == nil {
+			logs.Infof("[InfluxDBFetcher] query %v successfully, cost=%v", query, cost)
+		} else {
+			logs.Errorf("[InfluxDBFetcher] query %v error, cost=%v, err=%v", query, cost, rerr)
+		}
+	}(time.Now())
+
+	if v := ctx.Value("noblock"); v == nil {
+		inf.limiter.Wait()
+		defer inf.limiter.Release()
+	}
+
+	err := retryQuery(ctx, retry, func() (err error) {
+		series, err = do()
+		return
+	})
+	return series, err
+}
+
+func (inf *InfluxDBFetcher) newRequest(method, path string, params url.Values, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, inf.op.API+path+"?"+params.Encode(), body)
+	if err != nil {
+		return nil, err
+	}
+	if inf.op.Token != "" {
+		req.Header.Set("Authorization", "Token "+inf.op.Token)
+	}
+	return req, nil
+}
+
+// doInfluxQL /query of the 1.x API
+func (inf *InfluxDBFetcher) doInfluxQL(ctx context.Context, query string, timeout time.Duration) ([]*influxSeriesPoints, error) {
+	params := url.Values{}
+	params.Set("db", inf.op.Database)
+	params.Set("q", query)
+	params.Set("epoch", "ms")
+	req, err := inf.newRequest("GET", "/query", params, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	status, buf, err := doHTTP(ctx, inf.client, req, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("request influxdb err: %v", err)
+	}
+	var resp influxQLResp
+	if err := json.Unmarshal(buf, &resp); err != nil {
+		return nil, fmt.Errorf("invalid influxdb resp, status: %v, err: %v", status, err)
+	}
+	if resp.Error != "" || status != http.StatusOK {
+		err := fmt.Errorf("query influxdb err: %v, status: %v", resp.Error, status)
+		if status == http.StatusBadRequest {
+			return nil, &queryError{err}
+		}
+		return nil, err
+	}
+
+	var results []*influxSeriesPoints
+	for _, r := range resp.Results {
+		if r.Error != "" {
+			return nil, &queryError{fmt.Errorf("query influxdb err: %v", r.Error)}
+		}
+		for _, s := range r.Series {
+			points, err := influxValues2Points(s)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, &influxSeriesPoints{s.Tags, points})
+		}
+	}
+	return results, nil
+}
+
+// influxValues2Points 取time列和第一个值列
+func influxValues2Points(s *influxSeries) (ts.Points, error) {
+	if len(s.Columns) < 2 || s.Columns[0] != "time" {
+		return nil, fmt.Errorf("invalid columns of series %v: %v", s.Name, s.Columns)
+	}
+
+	points := make(ts.Points, 0, len(s.Values))
+	for _, v := range s.Values {
+		if len(v) < 2 || v[1] == nil {
+			continue
+		}
+		stamp, ok := v[0].(float64)
+		if !ok {
+			return nil, fmt.Errorf("invalid timestamp: %v", v[0])
+		}
+		val, ok := v[1].(float64)
+		if !ok {
+			return nil, fmt.Errorf("invalid value: %v", v[1])
+		}
+		points = append(points, ts.NewPoint(time.Unix(0, int64(stamp)*int64(time.Millisecond)), val))
+	}
+	return points, nil
+}
+
+// doFlux /api/v2/query of the 2.x API
+func (inf *InfluxDBFetcher) doFlux(ctx context.Context, query string, timeout time.Duration) ([]*influxSeriesPoints, error) {
+	body, err := json.Marshal(map[string]string{
+		"query": query,
+		"type":  "flux",
+	})
+	if err != nil {
+		return nil, err
+	}
+	params := url.Values{}
+	params.Set("org", inf.op.Org)
+	req, err := inf.newRequest("POST", "/api/v2/query", params, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/csv")
+
+	status, buf, err := doHTTP(ctx, inf.client, req, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("request influxdb err: %v", err)
+	}
+	if status != http.StatusOK {
+		var resp struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(buf, &resp)
+		err := fmt.Errorf("query influxdb err: %v: %v, status: %v", resp.Code, resp.Message, status)
+		if status == http.StatusBadRequest {
+			return nil, &queryError{err}
+		}
+		return nil, err
+	}
+
+	return fluxCSV2Series(buf)
+}
+
+// fluxNotTags the columns of flux result which are not tags
+var fluxNotTags = map[string]bool{
+	"":       true,
+	"result": true,
+	"table":  true,
+	"_start": true,
+	"_stop":  true,
+	"_time":  true,
+	"_value": true,
+}
+
+/*
+fluxCSV2Series 解析Flux返回的CSV;
+	每个table以header开始, 不同的table可能各有一个header, 也可能共用一个header;
+	同一个table中的行属于同一条ts, annotation行被忽略;
+*/
+func fluxCSV2Series(buf []byte) ([]*influxSeriesPoints, error) {
+	reader := csv.NewReader(bytes.NewReader(buf))
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+
+	var header []string
+	timeCol, valueCol, tableCol := -1, -1, -1
+	tables := make(map[string]*influxSeriesPoints)
+	var series []*influxSeriesPoints
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid flux csv: %v", err)
+		}
+		if header == nil || isFluxHeader(record) {
+			header = record
+			timeCol, valueCol, tableCol = -1, -1, -1
+			for i, col := range header {
+				switch col {
+				case "_time":
+					timeCol = i
+				case "_value":
+					valueCol = i
+				case "table":
+					tableCol = i
+				}
+			}
+			if timeCol < 0 || valueCol < 0 {
+				return nil, fmt.Errorf("no _time or _value in flux csv header: %v", header)
+			}
+			continue
+		}
+		if len(record) != len(header) {
+			return nil, fmt.Errorf("invalid flux csv record: %v", record)
+		}
+		if record[valueCol] == "" {
+			continue
+		}
+
+		tags := make(map[string]string)
+		for i, col := range header {
+			if !fluxNotTags[col] {
+				tags[col] = record[i]
+			}
+		}
+		key := formatTags(tags)
+		if tableCol >= 0 {
+			key = record[tableCol] + key
+		}
+		s, ok := tables[key]
+		if !ok {
+			s = &influxSeriesPoints{tags: tags}
+			tables[key] = s
+			series = append(series, s)
+		}
+
+		stamp, err := time.Parse(time.RFC3339Nano, record[timeCol])
+		if err != nil {
+			return nil, fmt.Errorf("invalid _time: %v", record[timeCol])
+		}
+		val, err := strconv.ParseFloat(record[valueCol], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid _value: %v", record[valueCol])
+		}
+		s.points = append(s.points, ts.NewPoint(stamp, val))
+	}
+	return series, nil
+}
+
+func isFluxHeader(record []string) bool {
+	hasTime, hasValue := false, false
+	for _, col := range record {
+		hasTime = hasTime || col == "_time"
+		hasValue = hasValue || col == "_value"
+	}
+	return hasTime && hasValue
+}
@@ -0,0 +1,138 @@
+package tsfetcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newInfluxServer a stand-in of influxdb, the queries are grouped by host,
+//  and the value of each point is its timestamp in seconds
+func newInfluxServer(t *testing.T) *httptest.Server {
+	timeFilter := regexp.MustCompile(`time >= (\d+)s AND time < (\d+)s`)
+	fluxRange := regexp.MustCompile(`range\(start: (\S+), stop: (\S+)\)`)
+	hosts := []string{"a", "b"}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Token secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"code":"unauthorized","message":"unauthorized access"}`)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/query":
+			q := r.URL.Query().Get("q")
+			m := timeFilter.FindStringSubmatch(q)
+			if r.URL.Query().Get("db") != "telegraf" || m == nil || !strings.Contains(q, "time(30s)") {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error":"error parsing query"}`)
+				return
+			}
+			start, _ := strconv.ParseInt(m[1], 10, 64)
+			end, _ := strconv.ParseInt(m[2], 10, 64)
+			var series []string
+			for _, h := range hosts {
+				var vals []string
+				for s := start; s < end; s += 30 {
+					if s%3600 == 0 {
+						vals = append(vals, fmt.Sprintf(`[%v,null]`, s*1000))
+						continue
+					}
+					vals = append(vals, fmt.Sprintf(`[%v,%v]`, s*1000, s))
+				}
+				series = append(series, fmt.Sprintf(`{"name":"cpu","tags":{"host":"%v"},"columns":["time","mean"],"values":[%v]}`,
+					h, strings.Join(vals, ",")))
+			}
+			fmt.Fprintf(w, `{"results":[{"statement_id":0,"series":[%v]}]}`, strings.Join(series, ","))
+		case "/api/v2/query":
+			buf, _ := ioutil.ReadAll(r.Body)
+			var req map[string]string
+			json.Unmarshal(buf, &req)
+			m := fluxRange.FindStringSubmatch(req["query"])
+			if r.URL.Query().Get("org") != "my-org" || m == nil {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"code":"invalid","message":"compilation failed"}`)
+				return
+			}
+			start, _ := time.Parse(time.RFC3339, m[1])
+			end, _ := time.Parse(time.RFC3339, m[2])
+			fmt.Fprintln(w, "#datatype,string,long,dateTime:RFC3339,double,string,string")
+			for i, h := range hosts {
+				fmt.Fprintln(w, ",result,table,_time,_value,_field,host")
+				for s := start; s.Before(end); s = s.Add(time.Second * 30) {
+					fmt.Fprintf(w, ",_result,%v,%v,%v,usage,%v\n", i, s.Format(time.RFC3339), s.Unix(), h)
+				}
+				fmt.Fprintln(w)
+			}
+		default:
+			t.Errorf("unexpected path: %v", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestInfluxDBFetcher(t *testing.T) {
+	server := newInfluxServer(t)
+	defer server.Close()
+
+	inf, err := NewInfluxDBFetcher(InfluxDBOptions{
+		API:      server.URL,
+		Database: "telegraf",
+		Org:      "my-org",
+		Token:    "secret",
+		Step:     time.Second * 30,
+		Retry:    1,
+		Timeout:  time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queries := map[string]string{
+		"influxql": `SELECT mean("usage") FROM "cpu" WHERE $timeFilter GROUP BY time($interval), *`,
+		"flux":     `from(bucket: "telegraf") |> $range |> aggregateWindow(every: $interval, fn: mean)`,
+	}
+	for lang, query := range queries {
+		extras, err := inf.Series(context.Background(), query)
+		if err != nil {
+			t.Fatalf("%v: %v", lang, err)
+		}
+		if len(extras) != 2 || !strings.Contains(extras[1], `host="b"`) {
+			t.Fatalf("%v: unexpected series: %v", lang, extras)
+		}
+
+		begin := time.Unix(1500000000, 0)
+		end := begin.Add(time.Hour * 36)
+		src := Source{Type: SourceInfluxDB, Key: query, Extra: extras[1]}
+		data, err := inf.Fetch(context.Background(), src, begin, end)
+		if err != nil {
+			t.Fatalf("%v: %v", lang, err)
+		}
+		// the null points are completed
+		if n := int(end.Sub(begin) / (time.Second * 30)); data.N() != n {
+			t.Fatalf("%v: %v points, expect %v", lang, data.N(), n)
+		}
+		for _, p := range data.Points() {
+			if float64(p.Stamp().Unix()) != p.Value() {
+				t.Fatalf("%v: point %v: %v", lang, p.Stamp(), p.Value())
+			}
+		}
+
+		// the query has two series, so it should be derived
+		if _, err := inf.Fetch(context.Background(), Source{Type: SourceInfluxDB, Key: query}, begin, end); err == nil {
+			t.Fatalf("%v: expect err", lang)
+		}
+	}
+
+	if _, err := inf.Series(context.Background(), `SELECT * FROM "cpu"`); err == nil {
+		t.Fatal("expect err for the query without time range")
+	}
+}
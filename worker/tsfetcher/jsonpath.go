@@ -0,0 +1,108 @@
+package tsfetcher
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPathStep a step of a JSONPath, name is "*" for all the children
+type jsonPathStep struct {
+	name    string
+	index   int
+	isIndex bool
+}
+
+/*
+parseJSONPath 解析JSONPath, 支持的语法:
+	$ 或 @: 根节点, 可以省略;
+	.name, ['name'], ["name"]: 子节点;
+	[n]: 数组的第n个元素, n为负数时从末尾开始;
+	.*, [*]: 所有子节点;
+*/
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	str := strings.TrimSpace(path)
+	if strings.HasPrefix(str, "$") || strings.HasPrefix(str, "@") {
+		str = str[1:]
+	} else if str != "" && str[0] != '.' && str[0] != '[' {
+		str = "." + str
+	}
+
+	var steps []jsonPathStep
+	for str != "" {
+		switch str[0] {
+		case '.':
+			str = str[1:]
+			end := strings.IndexAny(str, ".[")
+			if end < 0 {
+				end = len(str)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("invalid JSONPath: %v", path)
+			}
+			steps = append(steps, jsonPathStep{name: str[:end]})
+			str = str[end:]
+		case '[':
+			end := strings.IndexByte(str, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid JSONPath: %v, ] is missing", path)
+			}
+			sub := strings.TrimSpace(str[1:end])
+			str = str[end+1:]
+			switch {
+			case sub == "*":
+				steps = append(steps, jsonPathStep{name: "*"})
+			case len(sub) >= 2 && (sub[0] == '\'' || sub[0] == '"') && sub[len(sub)-1] == sub[0]:
+				steps = append(steps, jsonPathStep{name: sub[1 : len(sub)-1]})
+			default:
+				i, err := strconv.Atoi(sub)
+				if err != nil {
+					return nil, fmt.Errorf("invalid JSONPath: %v, unsupported [%v]", path, sub)
+				}
+				steps = append(steps, jsonPathStep{index: i, isIndex: true})
+			}
+		default:
+			return nil, fmt.Errorf("invalid JSONPath: %v", path)
+		}
+	}
+	return steps, nil
+}
+
+// evalJSONPath 返回data中匹配steps的所有值, data为json.Unmarshal到interface{}的结果
+func evalJSONPath(data interface{}, steps []jsonPathStep) []interface{} {
+	nodes := []interface{}{data}
+	for _, step := range steps {
+		var next []interface{}
+		for _, node := range nodes {
+			switch val := node.(type) {
+			case map[string]interface{}:
+				if step.isIndex {
+					continue
+				}
+				if step.name != "*" {
+					if child, ok := val[step.name]; ok {
+						next = append(next, child)
+					}
+					continue
+				}
+				for _, child := range val {
+					next = append(next, child)
+				}
+			case []interface{}:
+				if step.isIndex {
+					i := step.index
+					if i < 0 {
+						i += len(val)
+					}
+					if i >= 0 && i < len(val) {
+						next = append(next, val[i])
+					}
+				} else if step.name == "*" {
+					next = append(next, val...)
+				}
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
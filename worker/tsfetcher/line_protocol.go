@@ -0,0 +1,156 @@
+package tsfetcher
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.byted.org/microservice/tsad/worker/ts"
+)
+
+// PushedSeries the points pushed to a series
+type PushedSeries struct {
+	Src    Source
+	Points ts.Points
+}
+
+/*
+ParseLineProtocol 解析influxdb的line protocol:
+	measurement[,tag=value...] field=value[,field=value...] [timestamp]
+	每个数值类型的field是一条push类型的ts, Key为measurement.field, field为value时Key为measurement,
+	Extra为tag集合(见formatTags); 字符串类型的field被忽略, 布尔类型的field取0或1;
+	precision为timestamp的单位, 没有timestamp的点取now;
+*/
+func ParseLineProtocol(data []byte, precision time.Duration, now time.Time) ([]*PushedSeries, error) {
+	if precision <= 0 {
+		return nil, fmt.Errorf("invalid precision: %v", precision)
+	}
+
+	series := make(map[Source]*PushedSeries)
+	var results []*PushedSeries
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := splitUnescaped(line, ' ', true)
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("line %v: invalid line", lineNo)
+		}
+
+		stamp := now
+		if len(parts) == 3 {
+			i, err := strconv.ParseInt(parts[2], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %v: invalid timestamp: %v", lineNo, parts[2])
+			}
+			stamp = time.Unix(0, i*int64(precision))
+		}
+
+		// measurement and tags
+		mtags := splitUnescaped(parts[0], ',', false)
+		measurement := unescapeLine(mtags[0])
+		if measurement == "" {
+			return nil, fmt.Errorf("line %v: no measurement", lineNo)
+		}
+		tags := make(map[string]string)
+		for _, kv := range mtags[1:] {
+			pair := splitUnescaped(kv, '=', false)
+			if len(pair) != 2 || pair[0] == "" {
+				return nil, fmt.Errorf("line %v: invalid tag: %v", lineNo, kv)
+			}
+			tags[unescapeLine(pair[0])] = unescapeLine(pair[1])
+		}
+		extra := ""
+		if len(tags) > 0 {
+			extra = formatTags(tags)
+		}
+
+		for _, kv := range splitUnescaped(parts[1], ',', true) {
+			pair := splitUnescaped(kv, '=', true)
+			if len(pair) != 2 || pair[0] == "" {
+				return nil, fmt.Errorf("line %v: invalid field: %v", lineNo, kv)
+			}
+			val, ok, err := parseLineField(pair[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %v: invalid value of field %v: %v", lineNo, pair[0], err)
+			}
+			if !ok {
+				continue
+			}
+
+			key := measurement
+			if field := unescapeLine(pair[0]); field != "value" {
+				key += "." + field
+			}
+			src := Source{Type: SourcePush, Key: key, Extra: extra}
+			s, exist := series[src]
+			if !exist {
+				s = &PushedSeries{Src: src}
+				series[src] = s
+				results = append(results, s)
+			}
+			s.Points = append(s.Points, ts.NewPoint(stamp, val))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// parseLineField ok为false表示不是数值类型
+func parseLineField(str string) (val float64, ok bool, err error) {
+	switch {
+	case strings.HasPrefix(str, `"`):
+		return 0, false, nil
+	case str == "t" || str == "T" || str == "true" || str == "True" || str == "TRUE":
+		return 1, true, nil
+	case str == "f" || str == "F" || str == "false" || str == "False" || str == "FALSE":
+		return 0, true, nil
+	case strings.HasSuffix(str, "i") || strings.HasSuffix(str, "u"):
+		str = str[:len(str)-1]
+	}
+	val, err = strconv.ParseFloat(str, 64)
+	return val, err == nil, err
+}
+
+// splitUnescaped 按未被转义的sep切分str, quoted为true时双引号中的sep不切分
+func splitUnescaped(str string, sep byte, quoted bool) []string {
+	var parts []string
+	inQuote := false
+	begin := 0
+	for i := 0; i < len(str); i++ {
+		switch {
+		case str[i] == '\\':
+			i++
+		case str[i] == '"' && quoted:
+			inQuote = !inQuote
+		case str[i] == sep && !inQuote:
+			if sep != ' ' || i > begin {
+				parts = append(parts, str[begin:i])
+			}
+			begin = i + 1
+		}
+	}
+	return append(parts, str[begin:])
+}
+
+func unescapeLine(str string) string {
+	if !strings.Contains(str, `\`) {
+		return str
+	}
+	var buf bytes.Buffer
+	for i := 0; i < len(str); i++ {
+		if str[i] == '\\' && i+1 < len(str) {
+			i++
+		}
+		buf.WriteByte(str[i])
+	}
+	return buf.String()
+}
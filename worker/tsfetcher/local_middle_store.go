@@ -0,0 +1,412 @@
+package tsfetcher
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"code.byted.org/gopkg/logs"
+	"code.byted.org/microservice/tsad/worker/ts"
+)
+
+const localSeriesExt = ".tsc"
+
+// localBlock the meta of a block in the file of a series
+type localBlock struct {
+	n     int
+	first int64 // unix nano of the first point
+	last  int64 // unix nano of the last point
+}
+
+// localSeries the meta of the file of a series
+type localSeries struct {
+	path    string
+	loaded  bool
+	evicted bool
+	blocks  []localBlock
+	size    int64 // the size of the valid blocks
+	lock    sync.Mutex
+}
+
+func (s *localSeries) points() int {
+	n := 0
+	for _, b := range s.blocks {
+		n += b.n
+	}
+	return n
+}
+
+/*
+LocalMiddleStore 将每条ts的点缓存在本地磁盘上;
+	每条ts一个文件, 只追加写入, 每次写入的新点编码成一个或多个block(见encodePoints), 每个block最多chunkSize个点;
+	block的格式为: uvarint(长度) | 编码后的点 | crc32, 进程退出时未写完的block在下次读取时被截掉;
+	早于ttl的点被丢弃, 过期的block或者block过多时, 文件被重写; 超过ttl没有写入的文件被删除;
+*/
+type LocalMiddleStore struct {
+	dir       string
+	ttl       time.Duration
+	chunkSize int
+
+	series map[string]*localSeries
+	lock   sync.Mutex
+	stop   chan struct{}
+}
+
+// NewLocalMiddleStore .
+func NewLocalMiddleStore(dir string, ttl time.Duration, chunkSize int) (*LocalMiddleStore, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("invalid ttl: %v", ttl)
+	}
+	if chunkSize <= 0 {
+		return nil, fmt.Errorf("invalid chunk size: %v", chunkSize)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create dir %v err: %v", dir, err)
+	}
+
+	ls := &LocalMiddleStore{
+		dir:       dir,
+		ttl:       ttl,
+		chunkSize: chunkSize,
+		series:    make(map[string]*localSeries),
+		stop:      make(chan struct{}),
+	}
+	go ls.evictLoop()
+	return ls, nil
+}
+
+// Close 停止删除过期文件
+func (ls *LocalMiddleStore) Close() {
+	close(ls.stop)
+}
+
+// lockSeries 返回src对应的series, 已加锁
+func (ls *LocalMiddleStore) lockSeries(src Source) *localSeries {
+	name := fmt.Sprintf("%x", md5.Sum([]byte(fmt.Sprintf("%v", src))))
+	for {
+		ls.lock.Lock()
+		s, ok := ls.series[name]
+		if !ok {
+			s = &localSeries{path: filepath.Join(ls.dir, name+localSeriesExt)}
+			ls.series[name] = s
+		}
+		ls.lock.Unlock()
+
+		s.lock.Lock()
+		if !s.evicted {
+			return s
+		}
+		s.lock.Unlock()
+	}
+}
+
+// Fetch 返回缓存的没有过期的点, 没有缓存时返回空
+func (ls *LocalMiddleStore) Fetch(src Source) (ts.Points, error) {
+	s := ls.lockSeries(src)
+	defer s.lock.Unlock()
+	if err := ls.load(s); err != nil {
+		return nil, err
+	}
+	if len(s.blocks) == 0 {
+		return nil, nil
+	}
+
+	points, err := ls.readPoints(s)
+	if err != nil {
+		return nil, err
+	}
+	return ls.trimExpired(points), nil
+}
+
+/*
+Store 缓存points, points需要按时间排序;
+	points中比缓存的最新的点更新的点被追加写入;
+	points开始的时间比缓存的更早时, 用points重写缓存;
+*/
+func (ls *LocalMiddleStore) Store(src Source, points ts.Points) error {
+	points = ls.trimExpired(points)
+	if len(points) == 0 {
+		return nil
+	}
+
+	s := ls.lockSeries(src)
+	defer s.lock.Unlock()
+	if err := ls.load(s); err != nil {
+		return err
+	}
+
+	if len(s.blocks) == 0 || points[0].Stamp().UnixNano() < s.blocks[0].first {
+		return ls.rewrite(s, points)
+	}
+
+	last := s.blocks[len(s.blocks)-1].last
+	from := len(points)
+	for i, p := range points {
+		if p.Stamp().UnixNano() > last {
+			from = i
+			break
+		}
+	}
+	if from == len(points) {
+		return nil
+	}
+	if err := ls.append(s, points[from:]); err != nil {
+		return err
+	}
+
+	// rewrite the file if the oldest block has expired, or there are too many small blocks
+	expired := s.blocks[0].last < time.Now().Add(-ls.ttl).UnixNano()
+	if expired || len(s.blocks) > 2*(s.points()/ls.chunkSize+1)+8 {
+		all, err := ls.readPoints(s)
+		if err != nil {
+			return err
+		}
+		return ls.rewrite(s, ls.trimExpired(all))
+	}
+	return nil
+}
+
+func (ls *LocalMiddleStore) trimExpired(points ts.Points) ts.Points {
+	deadline := time.Now().Add(-ls.ttl)
+	for len(points) > 0 && points[0].Stamp().Before(deadline) {
+		points = points[1:]
+	}
+	return points
+}
+
+// load 读取文件中每个block的meta, 截掉文件末尾不完整的block
+func (ls *LocalMiddleStore) load(s *localSeries) error {
+	if s.loaded {
+		return nil
+	}
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		s.loaded = true
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("open %v err: %v", s.path, err)
+	}
+	defer f.Close()
+
+	var blocks []localBlock
+	var size int64
+	r := bufio.NewReader(f)
+	for {
+		payload, n, err := readLocalBlock(r)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			logs.Warnf("[LocalMiddleStore] truncate %v at %v: %v", s.path, size, err)
+			if err := os.Truncate(s.path, size); err != nil {
+				return fmt.Errorf("truncate %v err: %v", s.path, err)
+			}
+			break
+		}
+		b, err := localBlockMeta(payload)
+		if err != nil {
+			return fmt.Errorf("invalid block in %v: %v", s.path, err)
+		}
+		blocks = append(blocks, b)
+		size += n
+	}
+
+	s.blocks, s.size, s.loaded = blocks, size, true
+	return nil
+}
+
+func (ls *LocalMiddleStore) readPoints(s *localSeries) (ts.Points, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("open %v err: %v", s.path, err)
+	}
+	defer f.Close()
+
+	points := make(ts.Points, 0, s.points())
+	r := bufio.NewReader(io.LimitReader(f, s.size))
+	for range s.blocks {
+		payload, _, err := readLocalBlock(r)
+		if err != nil {
+			return nil, fmt.Errorf("read %v err: %v", s.path, err)
+		}
+		ps, err := decodePoints(payload)
+		if err != nil {
+			return nil, fmt.Errorf("decode block in %v err: %v", s.path, err)
+		}
+		points = append(points, ps...)
+	}
+	return points, nil
+}
+
+func (ls *LocalMiddleStore) append(s *localSeries, points ts.Points) error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("open %v err: %v", s.path, err)
+	}
+	defer f.Close()
+	if _, err := f.Seek(s.size, io.SeekStart); err != nil {
+		return fmt.Errorf("seek %v err: %v", s.path, err)
+	}
+
+	buf, blocks := ls.encodeBlocks(points)
+	if _, err := f.Write(buf); err != nil {
+		s.loaded = false // reload to drop the partial block
+		return fmt.Errorf("write %v err: %v", s.path, err)
+	}
+	s.blocks = append(s.blocks, blocks...)
+	s.size += int64(len(buf))
+	return nil
+}
+
+// rewrite 用points替换文件, 先写入临时文件再重命名
+func (ls *LocalMiddleStore) rewrite(s *localSeries, points ts.Points) error {
+	if len(points) == 0 {
+		s.blocks, s.size = nil, 0
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove %v err: %v", s.path, err)
+		}
+		return nil
+	}
+
+	buf, blocks := ls.encodeBlocks(points)
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0644); err != nil {
+		return fmt.Errorf("write %v err: %v", tmp, err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("rename %v err: %v", tmp, err)
+	}
+	s.blocks, s.size = blocks, int64(len(buf))
+	return nil
+}
+
+// encodeBlocks 将points按chunkSize切分成block并编码
+func (ls *LocalMiddleStore) encodeBlocks(points ts.Points) ([]byte, []localBlock) {
+	var buf []byte
+	var blocks []localBlock
+	tmp := make([]byte, binary.MaxVarintLen64)
+	for begin := 0; begin < len(points); begin += ls.chunkSize {
+		end := begin + ls.chunkSize
+		if end > len(points) {
+			end = len(points)
+		}
+		chunk := points[begin:end]
+		payload := encodePoints(chunk)
+
+		buf = append(buf, tmp[:binary.PutUvarint(tmp, uint64(len(payload)))]...)
+		buf = append(buf, payload...)
+		binary.BigEndian.PutUint32(tmp, crc32.ChecksumIEEE(payload))
+		buf = append(buf, tmp[:4]...)
+		blocks = append(blocks, localBlock{
+			n:     len(chunk),
+			first: chunk[0].Stamp().UnixNano(),
+			last:  chunk[len(chunk)-1].Stamp().UnixNano(),
+		})
+	}
+	return buf, blocks
+}
+
+// readLocalBlock 返回block中编码后的点和block的长度
+func readLocalBlock(r *bufio.Reader) ([]byte, int64, error) {
+	size, err := binary.ReadUvarint(r)
+	if err == io.EOF {
+		return nil, 0, io.EOF
+	} else if err != nil {
+		return nil, 0, fmt.Errorf("read block size err: %v", err)
+	}
+	if size > 64<<20 {
+		return nil, 0, fmt.Errorf("invalid block size: %v", size)
+	}
+
+	buf := make([]byte, size+4)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, 0, fmt.Errorf("read block err: %v", err)
+	}
+	payload := buf[:size]
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(buf[size:]) {
+		return nil, 0, fmt.Errorf("checksum mismatch")
+	}
+
+	tmp := make([]byte, binary.MaxVarintLen64)
+	return payload, int64(binary.PutUvarint(tmp, size)) + int64(len(buf)), nil
+}
+
+// localBlockMeta 从编码后的点中读取block的meta, 不解码所有的点
+func localBlockMeta(payload []byte) (localBlock, error) {
+	n, k := binary.Uvarint(payload)
+	if k <= 0 || n == 0 {
+		return localBlock{}, fmt.Errorf("invalid number of points")
+	}
+	payload = payload[k:]
+	first, k := binary.Varint(payload)
+	if k <= 0 {
+		return localBlock{}, fmt.Errorf("invalid first timestamp")
+	}
+	last, k := binary.Varint(payload[k:])
+	if k <= 0 {
+		return localBlock{}, fmt.Errorf("invalid last timestamp")
+	}
+	return localBlock{n: int(n), first: first, last: last}, nil
+}
+
+func (ls *LocalMiddleStore) evictLoop() {
+	interval := ls.ttl / 10
+	if interval > time.Hour {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ls.stop:
+			return
+		case <-ticker.C:
+			ls.evict()
+		}
+	}
+}
+
+// evict 删除超过ttl没有写入的文件
+func (ls *LocalMiddleStore) evict() {
+	files, err := ioutil.ReadDir(ls.dir)
+	if err != nil {
+		logs.Errorf("[LocalMiddleStore] read dir %v err: %v", ls.dir, err)
+		return
+	}
+
+	deadline := time.Now().Add(-ls.ttl)
+	for _, info := range files {
+		if !strings.HasSuffix(info.Name(), localSeriesExt) || !info.ModTime().Before(deadline) {
+			continue
+		}
+		name := strings.TrimSuffix(info.Name(), localSeriesExt)
+
+		ls.lock.Lock()
+		s, ok := ls.series[name]
+		if ok {
+			s.lock.Lock()
+		}
+		path := filepath.Join(ls.dir, info.Name())
+		// check again, it may be written just now
+		if stat, err := os.Stat(path); err == nil && stat.ModTime().Before(deadline) {
+			if err := os.Remove(path); err != nil {
+				logs.Errorf("[LocalMiddleStore] remove %v err: %v", path, err)
+			} else if ok {
+				s.evicted = true
+				delete(ls.series, name)
+			}
+		}
+		if ok {
+			s.lock.Unlock()
+		}
+		ls.lock.Unlock()
+	}
+}
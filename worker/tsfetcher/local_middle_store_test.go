@@ -0,0 +1,168 @@
+package tsfetcher
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"code.byted.org/microservice/tsad/worker/ts"
+)
+
+func checkPoints(t *testing.T, got, expt ts.Points) {
+	if len(got) != len(expt) {
+		t.Fatalf("%v points, expect %v", len(got), len(expt))
+	}
+	for i := range got {
+		same := got[i].Value() == expt[i].Value() || (math.IsNaN(got[i].Value()) && math.IsNaN(expt[i].Value()))
+		if !got[i].Stamp().Equal(expt[i].Stamp()) || !same {
+			t.Fatalf("point %v: %v %v, expect %v %v", i, got[i].Stamp(), got[i].Value(), expt[i].Stamp(), expt[i].Value())
+		}
+	}
+}
+
+func TestPointCodec(t *testing.T) {
+	begin := time.Unix(1500000000, 0)
+	var points ts.Points
+	vals := []float64{1, 1, 1.5, -3, 0, math.NaN(), math.Inf(1), 1e300, 1e-300, 42, 42, 43}
+	for i, v := range vals {
+		stamp := begin.Add(time.Second * 30 * time.Duration(i))
+		if i == 5 {
+			stamp = stamp.Add(time.Millisecond * 7) // irregular interval
+		}
+		points = append(points, ts.NewPoint(stamp, v))
+	}
+
+	buf := encodePoints(points)
+	decoded, err := decodePoints(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPoints(t, decoded, points)
+
+	// regular points are compressed to less than a quarter of the raw 16 bytes
+	points = points[:0]
+	for i := 0; i < 1000; i++ {
+		points = append(points, ts.NewPoint(begin.Add(time.Second*30*time.Duration(i)), float64(i%10)))
+	}
+	buf = encodePoints(points)
+	if len(buf) > 1000*16/4 {
+		t.Fatalf("%v bytes for 1000 points", len(buf))
+	}
+	decoded, err = decodePoints(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPoints(t, decoded, points)
+
+	if _, err := decodePoints(buf[:len(buf)/2]); err == nil {
+		t.Fatal("expect error for truncated points")
+	}
+}
+
+func TestLocalMiddleStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsad_middle_store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ttl := time.Hour * 24
+	ms, err := NewLocalMiddleStore(dir, ttl, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ms.Close()
+
+	freq := time.Second * 30
+	now := time.Now().Truncate(freq)
+	var all ts.Points
+	for i := 0; i < 3000; i++ {
+		all = append(all, ts.NewPoint(now.Add(-freq*time.Duration(3000-i)), float64(i)))
+	}
+
+	src := Source{Type: SourceTSDB, Key: "cpu", Extra: "{host=a}"}
+	if points, err := ms.Fetch(src); err != nil || len(points) != 0 {
+		t.Fatalf("%v points, err: %v", len(points), err)
+	}
+
+	// the store is append only
+	if err := ms.Store(src, all[1000:2000]); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.Store(src, all[1500:2500]); err != nil {
+		t.Fatal(err)
+	}
+	for i := 2500; i < 2600; i++ {
+		if err := ms.Store(src, all[i:i+1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	points, err := ms.Fetch(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPoints(t, points, all[1000:2600])
+
+	// too many small blocks are compacted
+	s := ms.lockSeries(src)
+	blocks := len(s.blocks)
+	s.lock.Unlock()
+	if blocks > 2*(1600/100+1)+8 {
+		t.Fatalf("%v blocks", blocks)
+	}
+
+	// earlier points replace the cache
+	if err := ms.Store(src, all[500:1200]); err != nil {
+		t.Fatal(err)
+	}
+	points, _ = ms.Fetch(src)
+	checkPoints(t, points, all[500:1200])
+
+	// reopen, and the partial block at the end is dropped
+	ms.Store(src, all[1200:1300])
+	path := filepath.Join(dir, fileNameOf(t, dir)+localSeriesExt)
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	f.Write([]byte{200, 1, 2, 3})
+	f.Close()
+
+	ms2, err := NewLocalMiddleStore(dir, ttl, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ms2.Close()
+	points, err = ms2.Fetch(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPoints(t, points, all[500:1300])
+	if err := ms2.Store(src, all[1300:1400]); err != nil {
+		t.Fatal(err)
+	}
+	points, _ = ms2.Fetch(src)
+	checkPoints(t, points, all[500:1400])
+
+	// expired points are dropped
+	ms3, _ := NewLocalMiddleStore(dir, freq*1000, 100)
+	defer ms3.Close()
+	points, _ = ms3.Fetch(src)
+	checkPoints(t, points, nil)
+	old := time.Now().Add(-ttl * 2)
+	os.Chtimes(path, old, old)
+	ms3.evict()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expect %v to be evicted, err: %v", path, err)
+	}
+}
+
+// fileNameOf the only series in dir
+func fileNameOf(t *testing.T, dir string) string {
+	files, _ := filepath.Glob(filepath.Join(dir, "*"+localSeriesExt))
+	if len(files) != 1 {
+		t.Fatalf("series files: %v", files)
+	}
+	name := filepath.Base(files[0])
+	return name[:len(name)-len(localSeriesExt)]
+}
@@ -18,7 +18,7 @@ type MiddleStorer interface {
 }
 
 type mysqlTS struct {
-	Key    string `gorm:"not null;column:src_key"` // hash of src
+	Key    string `gorm:"primary_key;not null;column:src_key"` // hash of src
 	Points string `gorm:"not null;column:points"`  // TS's Points, json format
 }
 
@@ -87,7 +87,7 @@ func (m *MysqlMiddleStore) Fetch(src Source) (ts.Points, error) {
 	}
 
 	var mts mysqlTS
-	if err := m.db.Where("key=?", key).First(&mts).Error; err != nil {
+	if err := m.db.Where("src_key=?", key).First(&mts).Error; err != nil {
 		return nil, fmt.Errorf("read db err: %v, key: %v", err, key)
 	}
 
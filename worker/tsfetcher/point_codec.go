@@ -0,0 +1,217 @@
+package tsfetcher
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"time"
+
+	"code.byted.org/microservice/tsad/worker/ts"
+)
+
+// bitWriter .
+type bitWriter struct {
+	buf  []byte
+	free uint // free bits in the last byte
+}
+
+func (w *bitWriter) writeBit(bit bool) {
+	if w.free == 0 {
+		w.buf = append(w.buf, 0)
+		w.free = 8
+	}
+	w.free--
+	if bit {
+		w.buf[len(w.buf)-1] |= 1 << w.free
+	}
+}
+
+// writeBits 写入v的低n位, 高位在前
+func (w *bitWriter) writeBits(v uint64, n uint) {
+	for n > 0 {
+		n--
+		w.writeBit(v>>n&1 == 1)
+	}
+}
+
+// bitReader .
+type bitReader struct {
+	buf []byte
+	pos uint // position in bits
+}
+
+func (r *bitReader) readBit() (bool, error) {
+	if r.pos >= uint(len(r.buf))*8 {
+		return false, fmt.Errorf("unexpected end of the bits")
+	}
+	bit := r.buf[r.pos/8]>>(7-r.pos%8)&1 == 1
+	r.pos++
+	return bit, nil
+}
+
+func (r *bitReader) readBits(n uint) (uint64, error) {
+	var v uint64
+	for ; n > 0; n-- {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		v <<= 1
+		if bit {
+			v |= 1
+		}
+	}
+	return v, nil
+}
+
+/*
+encodePoints 编码一组按时间排序的点:
+	uvarint(n) | varint(第一个点的时间) | varint(最后一个点的时间) | 第一个点的值(8字节) |
+	之后每个点的时间的delta-of-delta(varint) | 之后每个点的值和前一个值XOR后的Gorilla编码;
+	时间的单位为纳秒, 等间隔的点每个时间只占1字节;
+*/
+func encodePoints(points ts.Points) []byte {
+	buf := make([]byte, 0, 32+len(points)*3)
+	tmp := make([]byte, binary.MaxVarintLen64)
+	putUvarint := func(v uint64) {
+		buf = append(buf, tmp[:binary.PutUvarint(tmp, v)]...)
+	}
+	putVarint := func(v int64) {
+		buf = append(buf, tmp[:binary.PutVarint(tmp, v)]...)
+	}
+
+	putUvarint(uint64(len(points)))
+	if len(points) == 0 {
+		return buf
+	}
+	putVarint(points[0].Stamp().UnixNano())
+	putVarint(points[len(points)-1].Stamp().UnixNano())
+	binary.BigEndian.PutUint64(tmp, math.Float64bits(points[0].Value()))
+	buf = append(buf, tmp[:8]...)
+
+	var delta int64
+	for i := 1; i < len(points); i++ {
+		d := points[i].Stamp().UnixNano() - points[i-1].Stamp().UnixNano()
+		putVarint(d - delta)
+		delta = d
+	}
+
+	w := &bitWriter{buf: buf}
+	prev := math.Float64bits(points[0].Value())
+	prevLead, prevTrail := uint(65), uint(0)
+	for i := 1; i < len(points); i++ {
+		cur := math.Float64bits(points[i].Value())
+		xor := cur ^ prev
+		prev = cur
+		if xor == 0 {
+			w.writeBit(false)
+			continue
+		}
+		w.writeBit(true)
+
+		lead, trail := uint(bits.LeadingZeros64(xor)), uint(bits.TrailingZeros64(xor))
+		if lead > 31 {
+			lead = 31
+		}
+		if prevLead <= 64 && lead >= prevLead && trail >= prevTrail {
+			// the meaningful bits are in the previous window
+			w.writeBit(false)
+			w.writeBits(xor>>prevTrail, 64-prevLead-prevTrail)
+			continue
+		}
+		sig := 64 - lead - trail
+		w.writeBit(true)
+		w.writeBits(uint64(lead), 5)
+		w.writeBits(uint64(sig-1), 6)
+		w.writeBits(xor>>trail, sig)
+		prevLead, prevTrail = lead, trail
+	}
+	return w.buf
+}
+
+// decodePoints 解码encodePoints的结果
+func decodePoints(buf []byte) (ts.Points, error) {
+	n, k := binary.Uvarint(buf)
+	if k <= 0 {
+		return nil, fmt.Errorf("invalid number of points")
+	}
+	buf = buf[k:]
+	if n == 0 {
+		return nil, nil
+	}
+	if n > uint64(len(buf))*8 {
+		return nil, fmt.Errorf("invalid number of points: %v", n)
+	}
+
+	readVarint := func() (int64, error) {
+		v, k := binary.Varint(buf)
+		if k <= 0 {
+			return 0, fmt.Errorf("invalid timestamp")
+		}
+		buf = buf[k:]
+		return v, nil
+	}
+	stamp, err := readVarint()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := readVarint(); err != nil { // the last stamp
+		return nil, err
+	}
+	if len(buf) < 8 {
+		return nil, fmt.Errorf("invalid first value")
+	}
+	prev := binary.BigEndian.Uint64(buf)
+	buf = buf[8:]
+
+	stamps := make([]int64, n)
+	stamps[0] = stamp
+	var delta int64
+	for i := uint64(1); i < n; i++ {
+		dod, err := readVarint()
+		if err != nil {
+			return nil, err
+		}
+		delta += dod
+		stamps[i] = stamps[i-1] + delta
+	}
+
+	points := make(ts.Points, 0, n)
+	points = append(points, ts.NewPoint(time.Unix(0, stamps[0]), math.Float64frombits(prev)))
+	r := &bitReader{buf: buf}
+	var lead, trail uint
+	for i := uint64(1); i < n; i++ {
+		changed, err := r.readBit()
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			newWindow, err := r.readBit()
+			if err != nil {
+				return nil, err
+			}
+			if newWindow {
+				l, err := r.readBits(5)
+				if err != nil {
+					return nil, err
+				}
+				sig, err := r.readBits(6)
+				if err != nil {
+					return nil, err
+				}
+				lead, trail = uint(l), 64-uint(l)-uint(sig+1)
+			}
+			if lead+trail >= 64 {
+				return nil, fmt.Errorf("invalid XOR window")
+			}
+			xor, err := r.readBits(64 - lead - trail)
+			if err != nil {
+				return nil, err
+			}
+			prev ^= xor << trail
+		}
+		points = append(points, ts.NewPoint(time.Unix(0, stamps[i]), math.Float64frombits(prev)))
+	}
+	return points, nil
+}
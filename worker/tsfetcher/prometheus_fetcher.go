@@ -0,0 +1,264 @@
+package tsfetcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.byted.org/gopkg/logs"
+	"code.byted.org/microservice/tsad/worker/ts"
+)
+
+// StepTSAttrs attr for the time-series queried with a step, such as prometheus, the frequency is the step
+func StepTSAttrs(step time.Duration) ts.Attributes {
+	return ts.Attributes{
+		Frequency: step,
+		Period:    time.Hour * 24, // fix period as 1 day
+		Periods:   []time.Duration{time.Hour * 24 * 7},
+	}
+}
+
+type promSeries struct {
+	Metric map[string]string `json:"metric"`
+	Values [][2]interface{}  `json:"values"` // for range query
+	Value  [2]interface{}    `json:"value"`  // for instant query
+}
+
+type promResp struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string        `json:"resultType"`
+		Result     []*promSeries `json:"result"`
+	} `json:"data"`
+}
+
+/*
+PrometheusFetcher 通过prometheus的HTTP API获取数据;
+	source的Key为PromQL表达式, Extra为label集合(见formatTags), 如{instance="10.1.10.1:80",job="api"};
+	Key的结果中只取labels和Extra完全相同的那条ts, Extra为空时, Key的结果必须只有一条ts;
+*/
+type PrometheusFetcher struct {
+	client *http.Client
+
+	promAPI string // such as http://my_host:9090
+	step    time.Duration
+	timeout time.Duration
+	retry   int
+	limiter *ConcLimiter
+}
+
+func init() {
+	Register(SourcePrometheus, func(conf BackendConfig) (TSFetcher, error) {
+		pf, err := NewPrometheusFetcher(conf.API, stepOrDefault(conf.Step, TSDBTSAttr.Frequency), conf.Retry, conf.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		pf.limiter = newBackendLimiter(conf)
+		return pf, nil
+	})
+}
+
+// NewPrometheusFetcher .
+func NewPrometheusFetcher(promAPI string, step time.Duration, defaultRetry int, defaultTimeout time.Duration) (*PrometheusFetcher, error) {
+	if _, err := url.Parse(promAPI); err != nil || promAPI == "" {
+		return nil, fmt.Errorf("invalid prometheus api: %v", promAPI)
+	}
+	if step <= 0 {
+		return nil, fmt.Errorf("invalid step: %v", step)
+	}
+
+	return &PrometheusFetcher{
+		client:  &http.Client{},
+		promAPI: strings.TrimRight(promAPI, "/"),
+		step:    step,
+		timeout: defaultTimeout,
+		retry:   defaultRetry,
+		limiter: NewConcLimiter(DefaultConcurrency),
+	}, nil
+}
+
+// Fetch .
+func (pf *PrometheusFetcher) Fetch(ctx context.Context, src Source, begin, end time.Time) (ts.TS, error) {
+	if src.Type != SourcePrometheus {
+		return nil, fmt.Errorf("not a prometheus source type: %v", src.Type)
+	}
+	if src.Key == "" {
+		return nil, fmt.Errorf("source Key can not be null")
+	}
+	labels, err := parseTags(src.Extra)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source Extra: %v, err: %v", src.Extra, err)
+	}
+
+	// query by day to avoid exceeding the max points of a prometheus query
+	points, err := fetchByDay(begin, end, func(begin, end time.Time) (ts.Points, error) {
+		return pf.fetch(ctx, src.Key, labels, begin, end)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	points = complete(points, pf.step)
+	return ts.NewTS(StepTSAttrs(pf.step), points), nil
+}
+
+func (pf *PrometheusFetcher) fetch(ctx context.Context, query string, labels map[string]string, begin, end time.Time) (ts.Points, error) {
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("start", promTime(begin))
+	params.Set("end", promTime(end))
+	params.Set("step", strconv.FormatFloat(pf.step.Seconds(), 'f', -1, 64))
+
+	resp, err := pf.query(ctx, "/api/v1/query_range", params)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Data.ResultType != "matrix" {
+		return nil, fmt.Errorf("unexpected result type: %v", resp.Data.ResultType)
+	}
+
+	var series *promSeries
+	if len(labels) == 0 {
+		if len(resp.Data.Result) > 1 {
+			return nil, fmt.Errorf("%v series in query: %v, please derive it", len(resp.Data.Result), query)
+		}
+		if len(resp.Data.Result) == 1 {
+			series = resp.Data.Result[0]
+		}
+	} else {
+		for _, s := range resp.Data.Result {
+			if tagsEqual(s.Metric, labels) {
+				series = s
+				break
+			}
+		}
+	}
+	if series == nil {
+		return nil, nil
+	}
+
+	points := make(ts.Points, 0, len(series.Values))
+	for _, v := range series.Values {
+		p, err := promValue2Point(v)
+		if err != nil {
+			return nil, err
+		}
+		if math.IsNaN(p.Value()) || math.IsInf(p.Value(), 0) {
+			continue
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+// Derive 展开PromQL的每个label集合
+func (pf *PrometheusFetcher) Derive(ctx context.Context, src Source) ([]Source, error) {
+	return deriveSeries(ctx, src, pf.Series)
+}
+
+// Series 返回query当前结果中每条ts的label集合, 可以作为source的Extra;
+func (pf *PrometheusFetcher) Series(ctx context.Context, query string) ([]string, error) {
+	params := url.Values{}
+	params.Set("query", query)
+	resp, err := pf.query(ctx, "/api/v1/query", params)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Data.ResultType != "vector" {
+		return nil, fmt.Errorf("unexpected result type: %v", resp.Data.ResultType)
+	}
+
+	extras := make([]string, 0, len(resp.Data.Result))
+	for _, s := range resp.Data.Result {
+		extras = append(extras, formatTags(s.Metric))
+	}
+	sort.Strings(extras)
+	return extras, nil
+}
+
+func (pf *PrometheusFetcher) query(ctx context.Context, path string, params url.Values) (resp *promResp, rerr error) {
+	timeout := pf.timeout
+	retry := pf.retry
+	if t, ok := GetTimeout(ctx); ok {
+		timeout = t
+	}
+	if r, ok := GetRetry(ctx); ok {
+		retry = r
+	}
+
+	promURL := pf.promAPI + path + "?" + params.Encode()
+	defer func(begin time.Time) {
+		cost := time.Now().Sub(begin)
+		if rerr == nil {
+			logs.Infof("[PrometheusFetcher] query url=%v successfully, cost=%v", promURL, cost)
+		} else {
+			logs.Errorf("[PrometheusFetcher] query url=%v error, cost=%v, err=%v", promURL, cost, rerr)
+		}
+	}(time.Now())
+
+	if v := ctx.Value("noblock"); v == nil {
+		pf.limiter.Wait()
+		defer pf.limiter.Release()
+	}
+
+	err := retryQuery(ctx, retry, func() (err error) {
+		resp, err = pf.do(ctx, promURL, timeout)
+		return
+	})
+	return resp, err
+}
+
+func (pf *PrometheusFetcher) do(ctx context.Context, promURL string, timeout time.Duration) (*promResp, error) {
+	req, err := http.NewRequest("GET", promURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	status, buf, err := doHTTP(ctx, pf.client, req, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("request prometheus err: %v", err)
+	}
+
+	var resp promResp
+	if err := json.Unmarshal(buf, &resp); err != nil {
+		return nil, fmt.Errorf("invalid prometheus resp, status: %v, err: %v", status, err)
+	}
+	if resp.Status != "success" {
+		err := fmt.Errorf("query prometheus err: %v: %v, status: %v", resp.ErrorType, resp.Error, status)
+		if status == http.StatusBadRequest || status == http.StatusUnprocessableEntity {
+			return nil, &queryError{err}
+		}
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func promTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', 3, 64)
+}
+
+// promValue2Point [<unix_time>, "<value>"]
+func promValue2Point(v [2]interface{}) (ts.Point, error) {
+	stamp, ok := v[0].(float64)
+	if !ok {
+		return nil, fmt.Errorf("invalid timestamp: %v", v[0])
+	}
+	str, ok := v[1].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid value: %v", v[1])
+	}
+	val, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value: %v, err: %v", str, err)
+	}
+	sec, frac := math.Modf(stamp)
+	return ts.NewPoint(time.Unix(int64(sec), int64(frac*1e9)).Round(time.Millisecond), val), nil
+}
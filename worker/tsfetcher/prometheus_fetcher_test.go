@@ -0,0 +1,104 @@
+package tsfetcher
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newPromServer a stand-in of prometheus, the query `up` has two series,
+//  and the value of each point is its timestamp
+func newPromServer(t *testing.T) *httptest.Server {
+	series := []string{
+		`{"__name__":"up","instance":"10.1.10.1:80","job":"api"}`,
+		`{"__name__":"up","instance":"10.1.10.2:80","job":"api"}`,
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("query") != "up" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"status":"error","errorType":"bad_data","error":"parse error"}`)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/api/v1/query":
+			fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":%v,"value":[1500000000,"1"]},{"metric":%v,"value":[1500000000,"1"]}]}}`,
+				series[1], series[0])
+		case "/api/v1/query_range":
+			start, _ := strconv.ParseFloat(q.Get("start"), 64)
+			end, _ := strconv.ParseFloat(q.Get("end"), 64)
+			step, _ := strconv.ParseFloat(q.Get("step"), 64)
+			var vals []string
+			for s := start; s <= end; s += step {
+				v := fmt.Sprintf("%v", s)
+				if int64(s)%3600 == 0 {
+					v = "NaN"
+				}
+				vals = append(vals, fmt.Sprintf(`[%v,"%v"]`, s, v))
+			}
+			var results []string
+			for _, s := range series {
+				results = append(results, fmt.Sprintf(`{"metric":%v,"values":[%v]}`, s, strings.Join(vals, ",")))
+			}
+			fmt.Fprintf(w, `{"status":"success","data":{"resultType":"matrix","result":[%v]}}`, strings.Join(results, ","))
+		default:
+			t.Errorf("unexpected path: %v", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestPrometheusFetcher(t *testing.T) {
+	server := newPromServer(t)
+	defer server.Close()
+
+	pf, err := NewPrometheusFetcher(server.URL, time.Second*30, 1, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	extras, err := pf.Series(context.Background(), "up")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(extras) != 2 || extras[0] != `{__name__="up",instance="10.1.10.1:80",job="api"}` {
+		t.Fatalf("unexpected series: %v", extras)
+	}
+
+	begin := time.Unix(1500000000, 0)
+	end := begin.Add(time.Hour * 36)
+	src := Source{Type: SourcePrometheus, Key: "up", Extra: extras[1]}
+	data, err := pf.Fetch(context.Background(), src, begin, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Frequency() != time.Second*30 {
+		t.Fatalf("frequency %v", data.Frequency())
+	}
+	// the NaN points are completed
+	if n := int(end.Sub(begin)/(time.Second*30)) + 1; data.N() != n {
+		t.Fatalf("%v points, expect %v", data.N(), n)
+	}
+	for i, p := range data.Points() {
+		if i > 0 && !p.Stamp().After(data.Points()[i-1].Stamp()) {
+			t.Fatalf("points are not sorted at %v", i)
+		}
+		if float64(p.Stamp().Unix()) != p.Value() {
+			t.Fatalf("point %v: %v", p.Stamp(), p.Value())
+		}
+	}
+
+	// the query has two series, so it should be derived
+	if _, err := pf.Fetch(context.Background(), Source{Type: SourcePrometheus, Key: "up"}, begin, end); err == nil {
+		t.Fatal("expect err")
+	}
+	if _, err := pf.Fetch(context.Background(), Source{Type: SourcePrometheus, Key: "down"}, begin, end); err == nil {
+		t.Fatal("expect err")
+	}
+}
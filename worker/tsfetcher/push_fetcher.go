@@ -0,0 +1,241 @@
+package tsfetcher
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"code.byted.org/microservice/tsad/worker/ts"
+)
+
+// pushRing a ring buffer of the points of a series, the points are sorted
+type pushRing struct {
+	points  ts.Points
+	head    int // index of the oldest point
+	lastCnt int // number of the points merged into the latest point
+
+	arrival chan struct{}
+	lock    sync.RWMutex
+}
+
+func (r *pushRing) len() int {
+	return len(r.points)
+}
+
+func (r *pushRing) at(i int) ts.Point {
+	return r.points[(r.head+i)%len(r.points)]
+}
+
+/*
+PushFetcher 从内存中读取推送过来的数据;
+	每条ts(Key和Extra相同的source)一个环形缓冲区, 最多保存capacity个点, 超过后丢弃最旧的点;
+	推送的点按frequency对齐, 同一个时间段中的多个点取平均值, 比最新的点更旧的点被丢弃;
+*/
+type PushFetcher struct {
+	freq      time.Duration
+	capacity  int
+	maxSeries int
+
+	rings map[Source]*pushRing
+	lock  sync.RWMutex
+}
+
+/*
+init 注册Push, Options:
+	capacity: 每条ts最多保存的点数, 默认为7天;
+	max_series: 最多的ts数, 默认为10000;
+*/
+func init() {
+	Register(SourcePush, func(conf BackendConfig) (TSFetcher, error) {
+		freq := stepOrDefault(conf.Step, TSDBTSAttr.Frequency)
+		capacity, maxSeries := int(time.Hour*24*7/freq), 10000
+		if v, ok := conf.Options["capacity"]; ok {
+			if _, err := fmt.Sscan(v, &capacity); err != nil {
+				return nil, fmt.Errorf("invalid capacity: %v", v)
+			}
+		}
+		if v, ok := conf.Options["max_series"]; ok {
+			if _, err := fmt.Sscan(v, &maxSeries); err != nil {
+				return nil, fmt.Errorf("invalid max_series: %v", v)
+			}
+		}
+		return NewPushFetcher(freq, capacity, maxSeries)
+	})
+}
+
+// NewPushFetcher .
+func NewPushFetcher(freq time.Duration, capacity, maxSeries int) (*PushFetcher, error) {
+	if freq <= 0 {
+		return nil, fmt.Errorf("invalid frequency: %v", freq)
+	}
+	if capacity <= 0 || maxSeries <= 0 {
+		return nil, fmt.Errorf("invalid capacity %v or max series %v", capacity, maxSeries)
+	}
+	return &PushFetcher{
+		freq:      freq,
+		capacity:  capacity,
+		maxSeries: maxSeries,
+		rings:     make(map[Source]*pushRing),
+	}, nil
+}
+
+// pushKey Extra的tag顺序不影响所属的ts
+func pushKey(src Source) Source {
+	if tags, err := parseTags(src.Extra); err == nil && tags != nil {
+		src.Extra = formatTags(tags)
+	}
+	return src
+}
+
+func (pf *PushFetcher) ring(src Source, create bool) (*pushRing, error) {
+	key := pushKey(src)
+	pf.lock.RLock()
+	r, ok := pf.rings[key]
+	pf.lock.RUnlock()
+	if ok || !create {
+		return r, nil
+	}
+
+	pf.lock.Lock()
+	defer pf.lock.Unlock()
+	if r, ok := pf.rings[key]; ok {
+		return r, nil
+	}
+	if len(pf.rings) >= pf.maxSeries {
+		return nil, fmt.Errorf("too many series, max: %v", pf.maxSeries)
+	}
+	r = &pushRing{
+		points:  make(ts.Points, 0, 64),
+		arrival: make(chan struct{}, 1),
+	}
+	pf.rings[key] = r
+	return r, nil
+}
+
+// Push 追加src的点, 返回被接受的点数; 之后通知Arrival返回的chan;
+func (pf *PushFetcher) Push(src Source, points ts.Points) (int, error) {
+	if src.Type != SourcePush {
+		return 0, fmt.Errorf("not a push source type: %v", src.Type)
+	}
+	if src.Key == "" {
+		return 0, fmt.Errorf("source Key can not be null")
+	}
+	r, err := pf.ring(src, true)
+	if err != nil {
+		return 0, err
+	}
+
+	sorted := make(ts.Points, len(points))
+	copy(sorted, points)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Stamp().Before(sorted[j].Stamp())
+	})
+
+	accepted := 0
+	r.lock.Lock()
+	for _, p := range sorted {
+		if pf.push(r, p) {
+			accepted++
+		}
+	}
+	r.lock.Unlock()
+
+	if accepted > 0 {
+		select {
+		case r.arrival <- struct{}{}:
+		default:
+		}
+	}
+	return accepted, nil
+}
+
+func (pf *PushFetcher) push(r *pushRing, p ts.Point) bool {
+	stamp := p.Stamp().Truncate(pf.freq)
+	n := r.len()
+	if n > 0 {
+		last := r.at(n - 1)
+		if stamp.Before(last.Stamp()) {
+			return false
+		}
+		if stamp.Equal(last.Stamp()) {
+			// average the points in the same interval
+			val := (last.Value()*float64(r.lastCnt) + p.Value()) / float64(r.lastCnt+1)
+			r.points[(r.head+n-1)%n] = ts.NewPoint(stamp, val)
+			r.lastCnt++
+			return true
+		}
+	}
+
+	r.lastCnt = 1
+	if n < pf.capacity {
+		r.points = append(r.points, ts.NewPoint(stamp, p.Value()))
+		return true
+	}
+	r.points[r.head] = ts.NewPoint(stamp, p.Value())
+	r.head = (r.head + 1) % n
+	return true
+}
+
+// Fetch 返回[begin, end]中的点
+func (pf *PushFetcher) Fetch(ctx context.Context, src Source, begin, end time.Time) (ts.TS, error) {
+	if src.Type != SourcePush {
+		return nil, fmt.Errorf("not a push source type: %v", src.Type)
+	}
+	r, _ := pf.ring(src, false)
+	if r == nil {
+		return nil, fmt.Errorf("no points have been pushed to %v", src)
+	}
+
+	r.lock.RLock()
+	n := r.len()
+	from := sort.Search(n, func(i int) bool {
+		return !r.at(i).Stamp().Before(begin)
+	})
+	points := make(ts.Points, 0, n-from)
+	for i := from; i < n && !r.at(i).Stamp().After(end); i++ {
+		points = append(points, r.at(i))
+	}
+	r.lock.RUnlock()
+
+	points = complete(points, pf.freq)
+	return ts.NewTS(StepTSAttrs(pf.freq), points), nil
+}
+
+// Derive 展开已推送过的每个tag集合, 还没有推送过时返回src本身
+func (pf *PushFetcher) Derive(ctx context.Context, src Source) ([]Source, error) {
+	srcs, err := deriveSeries(ctx, src, pf.Series)
+	if err == nil && len(srcs) == 0 {
+		// nothing has been pushed yet, wait for the points of src itself
+		return []Source{src}, nil
+	}
+	return srcs, err
+}
+
+// Series 返回已推送过的, Key为key的ts的Extra, 已排序;
+func (pf *PushFetcher) Series(ctx context.Context, key string) ([]string, error) {
+	pf.lock.RLock()
+	defer pf.lock.RUnlock()
+
+	var extras []string
+	for src, r := range pf.rings {
+		r.lock.RLock()
+		pushed := r.len() > 0
+		r.lock.RUnlock()
+		if src.Key == key && pushed {
+			extras = append(extras, src.Extra)
+		}
+	}
+	sort.Strings(extras)
+	return extras, nil
+}
+
+// Arrival 返回一个chan, src有新的点被推送时会收到通知, 多次推送的通知可能被合并;
+func (pf *PushFetcher) Arrival(src Source) (<-chan struct{}, error) {
+	r, err := pf.ring(src, true)
+	if err != nil {
+		return nil, err
+	}
+	return r.arrival, nil
+}
@@ -0,0 +1,124 @@
+package tsfetcher
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"code.byted.org/microservice/tsad/worker/ts"
+)
+
+func TestPushFetcher(t *testing.T) {
+	freq := time.Second * 30
+	pf, err := NewPushFetcher(freq, 100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := Source{Type: SourcePush, Key: "qps", Extra: `{host="a",dc="x"}`}
+	arrival, err := pf.Arrival(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	begin := time.Unix(1500000000, 0)
+	var ps ts.Points
+	for i := 0; i < 150; i++ {
+		stamp := begin.Add(freq * time.Duration(i))
+		ps = append(ps, ts.NewPoint(stamp, float64(i)), ts.NewPoint(stamp.Add(time.Second), float64(i)+1))
+	}
+	// the order of the tags doesn't matter
+	n, err := pf.Push(Source{Type: SourcePush, Key: "qps", Extra: `{dc="x",host="a"}`}, ps)
+	if err != nil || n != len(ps) {
+		t.Fatalf("accepted %v, err: %v", n, err)
+	}
+	select {
+	case <-arrival:
+	default:
+		t.Fatal("no arrival")
+	}
+
+	// too old
+	if n, _ := pf.Push(src, ts.Points{ts.NewPoint(begin, 1)}); n != 0 {
+		t.Fatalf("accepted %v old points", n)
+	}
+
+	data, err := pf.Fetch(context.Background(), src, begin, begin.Add(time.Hour*2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only the latest 100 points are kept, and the points in the same interval are averaged
+	if data.N() != 100 || data.Frequency() != freq {
+		t.Fatalf("%v points, frequency %v", data.N(), data.Frequency())
+	}
+	for i, p := range data.Points() {
+		expt := float64(i+50) + 0.5
+		if p.Value() != expt || !p.Stamp().Equal(begin.Add(freq*time.Duration(i+50))) {
+			t.Fatalf("point %v: %v %v, expect %v", i, p.Stamp(), p.Value(), expt)
+		}
+	}
+
+	data, err = pf.Fetch(context.Background(), src, begin.Add(freq*140), begin.Add(freq*142))
+	if err != nil || data.N() != 3 {
+		t.Fatalf("fetch the range err: %v", err)
+	}
+
+	extras, _ := pf.Series(context.Background(), "qps")
+	if len(extras) != 1 || extras[0] != `{dc="x",host="a"}` {
+		t.Fatalf("unexpected series: %v", extras)
+	}
+
+	// max series is 2
+	if _, err := pf.Push(Source{Type: SourcePush, Key: "qps"}, ps[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pf.Push(Source{Type: SourcePush, Key: "rt"}, ps[:1]); err == nil {
+		t.Fatal("expect too many series")
+	}
+	if _, err := pf.Fetch(context.Background(), Source{Type: SourcePush, Key: "rt"}, begin, begin.Add(time.Hour)); err == nil {
+		t.Fatal("expect err for the series without points")
+	}
+}
+
+func TestParseLineProtocol(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	data := []byte(`
+# comment
+cpu,host=a,region=us\ west value=0.5,idle=12i 1500000000000
+cpu,host=a,region=us\ west value=0.7,msg="a b,c=d",up=t 1500000030000
+mem free=1.5e3
+`)
+	series, err := ParseLineProtocol(data, time.Millisecond, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expts := map[string]int{
+		`cpu{host="a",region="us west"}`:      2,
+		`cpu.idle{host="a",region="us west"}`: 1,
+		`cpu.up{host="a",region="us west"}`:   1,
+		`mem.free`:                            1,
+	}
+	if len(series) != len(expts) {
+		t.Fatalf("%v series, expect %v", len(series), len(expts))
+	}
+	for _, s := range series {
+		name := s.Src.Key + s.Src.Extra
+		if s.Src.Type != SourcePush || len(s.Points) != expts[name] {
+			t.Fatalf("unexpected series %v: %v", name, s.Points)
+		}
+		if name == `cpu{host="a",region="us west"}` &&
+			(s.Points[1].Value() != 0.7 || !s.Points[1].Stamp().Equal(now.Add(time.Second*30))) {
+			t.Fatalf("unexpected point: %v %v", s.Points[1].Stamp(), s.Points[1].Value())
+		}
+		if name == "mem.free" && (s.Points[0].Value() != 1500 || !s.Points[0].Stamp().Equal(now)) {
+			t.Fatalf("unexpected point: %v %v", s.Points[0].Stamp(), s.Points[0].Value())
+		}
+	}
+
+	for _, line := range []string{"cpu", "cpu value=abc", "cpu value=1 abc", ",host=a value=1"} {
+		if _, err := ParseLineProtocol([]byte(line), time.Millisecond, now); err == nil {
+			t.Fatalf("expect err for %v", line)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package tsfetcher
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+BackendConfig 一个数据源后端的配置;
+	Name为后端的名字, 多个后端可以是同一个Type, 如两个TSDB集群;
+	API为后端的地址, 对于SQL是DSN, 对于File是根目录;
+	Step为点的间隔, 为0时使用该类型的默认值;
+	Options为各类型特有的配置, 见各类型注册的Factory;
+	Concurrency为同时发往该后端的查询数上限, 为0时为DefaultConcurrency, 每个后端独立计数, 由所有task共享,
+		noblock的查询(如debug API)不受限制; Graphite, Prometheus, InfluxDB和HTTP限制的是HTTP请求,
+		TSDB限制的是每次Fetch, SQL限制的是同时执行的查询, Push, File和Expr不受限制;
+	MiddleStorer和Operand由调用者设置, 分别用于TSDB和Expr;
+*/
+type BackendConfig struct {
+	Name    string
+	Type    SourceType
+	API     string
+	Step    time.Duration
+	Retry   int
+	Timeout time.Duration
+	Options map[string]string
+
+	Concurrency int
+
+	MiddleStorer MiddleStorer
+	Operand      OperandFetcher
+}
+
+// DefaultConcurrency the default BackendConfig.Concurrency
+const DefaultConcurrency = 5
+
+// Factory 按配置创建一个后端的TSFetcher
+type Factory func(conf BackendConfig) (TSFetcher, error)
+
+// Deriver 可选, 将一个source展开成每条ts的source, 如展开通配符, 查询的每个label集合
+type Deriver interface {
+	Derive(ctx context.Context, src Source) ([]Source, error)
+}
+
+// ArrivalNotifier 可选, 有新的点时通知
+type ArrivalNotifier interface {
+	Arrival(src Source) (<-chan struct{}, error)
+}
+
+var (
+	factories     = make(map[SourceType]Factory)
+	factoriesLock sync.RWMutex
+)
+
+// Register 注册一种数据源类型, 类型名不区分大小写, 重复注册会panic
+func Register(typ SourceType, factory Factory) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+	if factory == nil {
+		panic("tsfetcher: Register factory is nil")
+	}
+	if _, ok := lookupFactory(typ); ok {
+		panic(fmt.Sprintf("tsfetcher: Register called twice for type %v", typ))
+	}
+	factories[typ] = factory
+}
+
+// Types 返回已注册的类型, 已排序
+func Types() []SourceType {
+	factoriesLock.RLock()
+	defer factoriesLock.RUnlock()
+	types := make([]SourceType, 0, len(factories))
+	for typ := range factories {
+		types = append(types, typ)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i] < types[j]
+	})
+	return types
+}
+
+// lookupFactory 返回typ对应的注册类型
+func lookupFactory(typ SourceType) (SourceType, bool) {
+	for t := range factories {
+		if strings.EqualFold(string(t), string(typ)) {
+			return t, true
+		}
+	}
+	return "", false
+}
+
+// NewFetcher 按conf.Type创建后端, 返回TSFetcher和注册时的类型名
+func NewFetcher(conf BackendConfig) (TSFetcher, SourceType, error) {
+	factoriesLock.RLock()
+	typ, ok := lookupFactory(conf.Type)
+	factory := factories[typ]
+	factoriesLock.RUnlock()
+	if !ok {
+		return nil, "", fmt.Errorf("unknown source type: %v", conf.Type)
+	}
+
+	conf.Type = typ
+	fetcher, err := factory(conf)
+	if err != nil {
+		return nil, "", fmt.Errorf("create %v backend %v err: %v", typ, conf.Name, err)
+	}
+	return fetcher, typ, nil
+}
+
+// Derive 通过fetcher展开src, fetcher没有实现Deriver时返回src本身
+func Derive(ctx context.Context, fetcher TSFetcher, src Source) ([]Source, error) {
+	if d, ok := fetcher.(Deriver); ok {
+		return d.Derive(ctx, src)
+	}
+	return []Source{src}, nil
+}
+
+// deriveSeries 如果src没有指定label(tag)集合, 将查询的每条结果展开成一个src,
+//  如PromQL的每个label集合, InfluxQL中GROUP BY *的每个tag集合
+func deriveSeries(ctx context.Context, src Source, series func(ctx context.Context, query string) ([]string, error)) ([]Source, error) {
+	if src.Extra != "" {
+		return []Source{src}, nil
+	}
+
+	extras, err := series(ctx, src.Key)
+	if err != nil {
+		return nil, fmt.Errorf("query %v series err: %v", src.Type, err)
+	}
+
+	srcs := make([]Source, 0, len(extras))
+	for _, extra := range extras {
+		srcs = append(srcs, Source{Type: src.Type, Key: src.Key, Extra: extra})
+	}
+	return srcs, nil
+}
+
+// deriveExpanded 展开Key中的通配符, 如graphite的metric路径, 文件的glob; Extra保持不变
+func deriveExpanded(ctx context.Context, src Source, expand func(ctx context.Context, pattern string) ([]string, error)) ([]Source, error) {
+	paths, err := expand(ctx, src.Key)
+	if err != nil {
+		return nil, fmt.Errorf("expand %v key err: %v", src.Type, err)
+	}
+
+	srcs := make([]Source, 0, len(paths))
+	for _, path := range paths {
+		srcs = append(srcs, Source{Type: src.Type, Key: path, Extra: src.Extra})
+	}
+	return srcs, nil
+}
+
+// newBackendLimiter .
+func newBackendLimiter(conf BackendConfig) *ConcLimiter {
+	if conf.Concurrency > 0 {
+		return NewConcLimiter(int64(conf.Concurrency))
+	}
+	return NewConcLimiter(DefaultConcurrency)
+}
+
+// stepOrDefault .
+func stepOrDefault(step, def time.Duration) time.Duration {
+	if step > 0 {
+		return step
+	}
+	return def
+}
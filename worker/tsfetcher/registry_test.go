@@ -0,0 +1,88 @@
+package tsfetcher
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"code.byted.org/microservice/tsad/worker/ts"
+)
+
+type fakeFetcher struct {
+	conf BackendConfig
+}
+
+func (f *fakeFetcher) Fetch(ctx context.Context, src Source, begin, end time.Time) (ts.TS, error) {
+	return ts.NewTS(StepTSAttrs(f.conf.Step), nil), nil
+}
+
+func TestRegistry(t *testing.T) {
+	for _, typ := range []SourceType{SourceTSDB, SourcePrometheus, SourceInfluxDB, SourceGraphite,
+		SourcePush, SourceFile, SourceSQL, SourceExpr, SourceHTTP} {
+		if _, ok := lookupFactory(typ); !ok {
+			t.Fatalf("%v is not registered", typ)
+		}
+	}
+
+	fake := SourceType("Fake")
+	Register(fake, func(conf BackendConfig) (TSFetcher, error) {
+		return &fakeFetcher{conf}, nil
+	})
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expect panic when registering twice")
+			}
+		}()
+		Register("fake", func(conf BackendConfig) (TSFetcher, error) { return nil, nil })
+	}()
+
+	// the type is case insensitive
+	fetcher, typ, err := NewFetcher(BackendConfig{Name: "fake-a", Type: "fake", Step: time.Minute})
+	if err != nil || typ != fake {
+		t.Fatalf("type %v, err: %v", typ, err)
+	}
+	if conf := fetcher.(*fakeFetcher).conf; conf.Name != "fake-a" || conf.Type != fake {
+		t.Fatalf("unexpected config: %+v", conf)
+	}
+	if _, _, err := NewFetcher(BackendConfig{Name: "x", Type: "unknown"}); err == nil {
+		t.Fatal("expect error for an unknown type")
+	}
+
+	// without Deriver
+	src := Source{Type: fake, Key: "k"}
+	if srcs, err := Derive(context.Background(), fetcher, src); err != nil || !reflect.DeepEqual(srcs, []Source{src}) {
+		t.Fatalf("derived %v, err: %v", srcs, err)
+	}
+
+	// options of the builtin types
+	push, _, err := NewFetcher(BackendConfig{Name: "push", Type: "push", Options: map[string]string{"capacity": "x"}})
+	if err == nil {
+		t.Fatalf("expect error for invalid capacity, got %v", push)
+	}
+	if _, _, err := NewFetcher(BackendConfig{Name: "file", Type: "file"}); err == nil {
+		t.Fatal("expect error for the file backend without root")
+	}
+}
+
+func TestDeriveSeries(t *testing.T) {
+	series := func(ctx context.Context, query string) ([]string, error) {
+		return []string{`{host="a"}`, `{host="b"}`}, nil
+	}
+	src := Source{Type: SourcePrometheus, Key: "up"}
+	srcs, err := deriveSeries(context.Background(), src, series)
+	expt := []Source{
+		{Type: SourcePrometheus, Key: "up", Extra: `{host="a"}`},
+		{Type: SourcePrometheus, Key: "up", Extra: `{host="b"}`},
+	}
+	if err != nil || !reflect.DeepEqual(srcs, expt) {
+		t.Fatalf("derived %v, err: %v", srcs, err)
+	}
+
+	// Extra has been specified
+	src.Extra = `{host="c"}`
+	if srcs, _ := deriveSeries(context.Background(), src, series); !reflect.DeepEqual(srcs, []Source{src}) {
+		t.Fatalf("derived %v", srcs)
+	}
+}
@@ -0,0 +1,357 @@
+package tsfetcher
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.byted.org/gopkg/logs"
+	"code.byted.org/microservice/tsad/worker/ts"
+)
+
+// the placeholders in the query of a sql source
+const (
+	SQLBegin     = "$begin"      // bound to the begin time
+	SQLEnd       = "$end"        // bound to the end time
+	SQLBeginUnix = "$begin_unix" // bound to the unix seconds of the begin time
+	SQLEndUnix   = "$end_unix"   // bound to the unix seconds of the end time
+)
+
+// sqlPlaceholders longer ones first, so $begin_unix is not matched as $begin
+var sqlPlaceholders = []string{SQLBeginUnix, SQLEndUnix, SQLBegin, SQLEnd}
+
+// sqlTimeLayouts the layouts of the timestamp column in string
+var sqlTimeLayouts = []string{"2006-01-02 15:04:05", time.RFC3339Nano}
+
+// sqlRow .
+type sqlRow struct {
+	stamp time.Time
+	value float64
+	dims  map[string]string
+}
+
+/*
+SQLFetcher 通过database/sql查询数据;
+	source的Key为单条SELECT语句, 在只读事务中执行, 返回(timestamp, value[, dimension...])的行, 如:
+		SELECT created_at, COUNT(*), city FROM orders WHERE created_at >= $begin AND created_at < $end GROUP BY 1, 3
+	查询中的SQLBegin, SQLEnd, SQLBeginUnix, SQLEndUnix会被替换成参数;
+	timestamp列可以是时间, unix秒数, 或者字符串格式的时间;
+	dimension列的列名和值组成tag集合, Extra为tag集合(见formatTags), 只取tags和Extra完全相同的行,
+	Extra为空时, 查询结果必须只有一组dimension;
+	点按freq对齐, 同一个间隔中的多行按aggregate聚合, 默认求和, 如上面按秒分组的订单数;
+*/
+type SQLFetcher struct {
+	db        *sql.DB
+	freq      time.Duration
+	timeout   time.Duration
+	aggregate string
+	limiter   *ConcLimiter
+}
+
+/*
+init 注册SQL, API为DSN, Options:
+	driver: database/sql的驱动名, 默认为mysql;
+	aggregate: 同一个间隔中多行的聚合方式, sum或avg, 默认为sum;
+*/
+func init() {
+	Register(SourceSQL, func(conf BackendConfig) (TSFetcher, error) {
+		driver := conf.Options["driver"]
+		if driver == "" {
+			driver = "mysql"
+		}
+		sf, err := NewSQLFetcher(driver, conf.API, stepOrDefault(conf.Step, TSDBTSAttr.Frequency), conf.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		switch agg := conf.Options["aggregate"]; agg {
+		case "":
+		case aggregateSum, aggregateAvg:
+			sf.aggregate = agg
+		default:
+			return nil, fmt.Errorf("invalid aggregate: %v, expect sum or avg", agg)
+		}
+		sf.limiter = newBackendLimiter(conf)
+		return sf, nil
+	})
+}
+
+// NewSQLFetcher .
+func NewSQLFetcher(driver, dsn string, freq, defaultTimeout time.Duration) (*SQLFetcher, error) {
+	if freq <= 0 {
+		return nil, fmt.Errorf("invalid frequency: %v", freq)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open %v err: %v", driver, err)
+	}
+	return &SQLFetcher{
+		db:        db,
+		freq:      freq,
+		timeout:   defaultTimeout,
+		aggregate: aggregateSum,
+		limiter:   NewConcLimiter(DefaultConcurrency),
+	}, nil
+}
+
+// Fetch .
+func (sf *SQLFetcher) Fetch(ctx context.Context, src Source, begin, end time.Time) (ts.TS, error) {
+	if src.Type != SourceSQL {
+		return nil, fmt.Errorf("not a sql source type: %v", src.Type)
+	}
+	tags, err := parseTags(src.Extra)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source Extra: %v, err: %v", src.Extra, err)
+	}
+
+	points, err := fetchByDay(begin, end, func(begin, end time.Time) (ts.Points, error) {
+		rows, err := sf.query(ctx, src.Key, begin, end)
+		if err != nil {
+			return nil, err
+		}
+
+		var points ts.Points
+		dims := ""
+		for _, r := range rows {
+			if len(tags) > 0 {
+				if !tagsEqual(r.dims, tags) {
+					continue
+				}
+			} else if d := formatTags(r.dims); dims == "" {
+				dims = d
+			} else if d != dims {
+				return nil, fmt.Errorf("more than one dimensions in query: %v, please derive it", src.Key)
+			}
+			points = append(points, ts.NewPoint(r.stamp, r.value))
+		}
+		sortPoints(points)
+		return points, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	points = complete(bucketPoints(points, sf.freq, sf.aggregate), sf.freq)
+	return ts.NewTS(StepTSAttrs(sf.freq), points), nil
+}
+
+// Derive 展开查询结果中的每组dimension
+func (sf *SQLFetcher) Derive(ctx context.Context, src Source) ([]Source, error) {
+	return deriveSeries(ctx, src, sf.Series)
+}
+
+// Series 返回query最近一天结果中的每组dimension, 可以作为source的Extra;
+func (sf *SQLFetcher) Series(ctx context.Context, query string) ([]string, error) {
+	end := time.Now()
+	rows, err := sf.query(ctx, query, end.Add(-time.Hour*24), end)
+	if err != nil {
+		return nil, err
+	}
+
+	dims := make(map[string]bool)
+	var extras []string
+	for _, r := range rows {
+		d := ""
+		if len(r.dims) > 0 {
+			d = formatTags(r.dims)
+		}
+		if !dims[d] {
+			dims[d] = true
+			extras = append(extras, d)
+		}
+	}
+	sort.Strings(extras)
+	return extras, nil
+}
+
+// bindSQL 将query中的占位符替换成?, 返回替换后的query和对应的参数
+func bindSQL(query string, begin, end time.Time) (string, []interface{}) {
+	values := map[string]interface{}{
+		SQLBegin:     begin,
+		SQLEnd:       end,
+		SQLBeginUnix: begin.Unix(),
+		SQLEndUnix:   end.Unix(),
+	}
+
+	var buf bytes.Buffer
+	var args []interface{}
+	for i := 0; i < len(query); {
+		matched := false
+		if query[i] == '$' {
+			for _, p := range sqlPlaceholders {
+				if strings.HasPrefix(query[i:], p) {
+					buf.WriteString("?")
+					args = append(args, values[p])
+					i += len(p)
+					matched = true
+					break
+				}
+			}
+		}
+		if !matched {
+			buf.WriteByte(query[i])
+			i++
+		}
+	}
+	return buf.String(), args
+}
+
+func (sf *SQLFetcher) query(ctx context.Context, query string, begin, end time.Time) (results []*sqlRow, rerr error) {
+	if query == "" {
+		return nil, fmt.Errorf("source Key can not be null")
+	}
+	if err := checkSelect(query); err != nil {
+		return nil, err
+	}
+	timeout := sf.timeout
+	if t, ok := GetTimeout(ctx); ok {
+		timeout = t
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	bound, args := bindSQL(query, begin, end)
+	defer func(start time.Time) {
+		cost := time.Now().Sub(start)
+		if rerr == nil {
+			logs.Infof("[SQLFetcher] query %v from %v to %v successfully, cost=%v", query, begin, end, cost)
+		} else {
+			logs.Errorf("[SQLFetcher] query %v from %v to %v error, cost=%v, err=%v", query, begin, end, cost, rerr)
+		}
+	}(time.Now())
+
+	if v := ctx.Value("noblock"); v == nil {
+		sf.limiter.Wait()
+		defer sf.limiter.Release()
+	}
+
+	// the query runs in a read-only transaction, so it can not modify the data with the privileges of the DSN
+	tx, err := sf.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("begin read-only tx err: %v", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, bound, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query err: %v", err)
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("read columns err: %v", err)
+	}
+	if len(cols) < 2 {
+		return nil, fmt.Errorf("the query should return (timestamp, value[, dimension...]), got %v", cols)
+	}
+
+	vals := make([]interface{}, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, fmt.Errorf("scan row err: %v", err)
+		}
+		if vals[0] == nil || vals[1] == nil {
+			continue
+		}
+
+		r := &sqlRow{dims: make(map[string]string, len(cols)-2)}
+		if r.stamp, err = sqlStamp(vals[0]); err != nil {
+			return nil, err
+		}
+		if r.value, err = sqlFloat(vals[1]); err != nil {
+			return nil, fmt.Errorf("invalid value: %v", err)
+		}
+		if math.IsNaN(r.value) || math.IsInf(r.value, 0) {
+			continue
+		}
+		for i := 2; i < len(cols); i++ {
+			r.dims[cols[i]] = sqlString(vals[i])
+		}
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read rows err: %v", err)
+	}
+	return results, nil
+}
+
+// checkSelect 只允许单条SELECT(或WITH ... SELECT)语句
+func checkSelect(query string) error {
+	q := strings.TrimSuffix(strings.TrimSpace(query), ";")
+	end := strings.IndexFunc(q, func(r rune) bool {
+		return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z')
+	})
+	if end < 0 {
+		end = len(q)
+	}
+	if verb := strings.ToUpper(q[:end]); verb != "SELECT" && verb != "WITH" {
+		return fmt.Errorf("only the SELECT statement is allowed, got %v", query)
+	}
+	if strings.Contains(q, ";") {
+		return fmt.Errorf("only one statement is allowed, got %v", query)
+	}
+	return nil
+}
+
+func sqlStamp(v interface{}) (time.Time, error) {
+	switch val := v.(type) {
+	case time.Time:
+		return val, nil
+	case []byte, string:
+		str := sqlString(val)
+		for _, layout := range sqlTimeLayouts {
+			if t, err := time.Parse(layout, str); err == nil {
+				return t, nil
+			}
+		}
+	}
+	if sec, err := sqlFloat(v); err == nil {
+		i, frac := math.Modf(sec)
+		return time.Unix(int64(i), int64(frac*1e9)), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp: %v", sqlString(v))
+}
+
+func sqlFloat(v interface{}) (float64, error) {
+	switch val := v.(type) {
+	case int64:
+		return float64(val), nil
+	case float64:
+		return val, nil
+	case bool:
+		if val {
+			return 1, nil
+		}
+		return 0, nil
+	case []byte:
+		return strconv.ParseFloat(string(val), 64)
+	case string:
+		return strconv.ParseFloat(val, 64)
+	}
+	return 0, fmt.Errorf("unsupported type %T", v)
+}
+
+func sqlString(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(val)
+	case time.Time:
+		return val.Format(time.RFC3339)
+	}
+	return fmt.Sprintf("%v", v)
+}
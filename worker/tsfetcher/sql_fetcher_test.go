@@ -0,0 +1,168 @@
+package tsfetcher
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSQLDriver returns the orders of two cities every 30s in [begin, end),
+//  the value of each row is its timestamp
+type fakeSQLDriver struct{}
+
+type fakeSQLConn struct{}
+
+type fakeSQLTx struct{}
+
+type fakeSQLStmt struct {
+	query string
+}
+
+type fakeSQLRows struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+func (fakeSQLDriver) Open(name string) (driver.Conn, error) { return fakeSQLConn{}, nil }
+
+func (fakeSQLConn) Prepare(query string) (driver.Stmt, error) { return &fakeSQLStmt{query}, nil }
+func (fakeSQLConn) Close() error                              { return nil }
+func (fakeSQLConn) Begin() (driver.Tx, error)                 { return nil, fmt.Errorf("not supported") }
+func (fakeSQLConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if !opts.ReadOnly {
+		return nil, fmt.Errorf("expect a read-only tx")
+	}
+	return fakeSQLTx{}, nil
+}
+
+func (fakeSQLTx) Commit() error   { return nil }
+func (fakeSQLTx) Rollback() error { return nil }
+
+func (s *fakeSQLStmt) Close() error  { return nil }
+func (s *fakeSQLStmt) NumInput() int { return -1 }
+func (s *fakeSQLStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, fmt.Errorf("not supported")
+}
+func (s *fakeSQLStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if s.query != "SELECT ts, cnt, city FROM orders WHERE ts >= ? AND ts < ? AND created_at >= ?" || len(args) != 3 {
+		return nil, fmt.Errorf("unexpected query: %v, args: %v", s.query, args)
+	}
+	begin, end := args[0].(int64), args[1].(int64)
+	if _, ok := args[2].(time.Time); !ok {
+		return nil, fmt.Errorf("unexpected arg: %v", args[2])
+	}
+
+	rows := &fakeSQLRows{cols: []string{"ts", "cnt", "city"}}
+	for stamp := begin - begin%30; stamp < end; stamp += 30 {
+		if stamp < begin {
+			continue
+		}
+		for _, city := range []string{"beijing", "shanghai"} {
+			rows.rows = append(rows.rows, []driver.Value{stamp, float64(stamp), []byte(city)})
+		}
+	}
+	return rows, nil
+}
+
+func (r *fakeSQLRows) Columns() []string { return r.cols }
+func (r *fakeSQLRows) Close() error      { return nil }
+func (r *fakeSQLRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func init() {
+	sql.Register("tsad_fake_sql", fakeSQLDriver{})
+}
+
+func TestSQLFetcher(t *testing.T) {
+	sf, err := NewSQLFetcher("tsad_fake_sql", "", time.Second*30, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := "SELECT ts, cnt, city FROM orders WHERE ts >= $begin_unix AND ts < $end_unix AND created_at >= $begin"
+	extras, err := sf.Series(context.Background(), query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(extras) != 2 || extras[0] != `{city="beijing"}` {
+		t.Fatalf("unexpected series: %v", extras)
+	}
+
+	begin := time.Unix(1500000000, 0)
+	end := begin.Add(time.Hour * 36)
+	data, err := sf.Fetch(context.Background(), Source{Type: SourceSQL, Key: query, Extra: extras[1]}, begin, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := int(end.Sub(begin) / (time.Second * 30)); data.N() != n {
+		t.Fatalf("%v points, expect %v", data.N(), n)
+	}
+	for _, p := range data.Points() {
+		if float64(p.Stamp().Unix()) != p.Value() {
+			t.Fatalf("point %v: %v", p.Stamp(), p.Value())
+		}
+	}
+
+	// the rows in the same interval are summed
+	sf.freq = time.Minute
+	data, err = sf.Fetch(context.Background(), Source{Type: SourceSQL, Key: query, Extra: extras[1]}, begin, begin.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.N() != 60 {
+		t.Fatalf("%v points, expect 60", data.N())
+	}
+	for _, p := range data.Points() {
+		if float64(p.Stamp().Unix()*2+30) != p.Value() {
+			t.Fatalf("point %v: %v", p.Stamp(), p.Value())
+		}
+	}
+
+	// two cities, so it should be derived
+	if _, err := sf.Fetch(context.Background(), Source{Type: SourceSQL, Key: query}, begin, end); err == nil || !strings.Contains(err.Error(), "derive") {
+		t.Fatalf("expect err for deriving, got %v", err)
+	}
+}
+
+func TestCheckSelect(t *testing.T) {
+	cases := []struct {
+		query string
+		ok    bool
+	}{
+		{"SELECT ts, cnt FROM orders", true},
+		{"  select(ts), cnt from orders;", true},
+		{"WITH o AS (SELECT ts, cnt FROM orders) SELECT * FROM o", true},
+		{"DELETE FROM orders", false},
+		{"UPDATE orders SET cnt = 0", false},
+		{"SELECT ts, cnt FROM orders; DROP TABLE orders", false},
+		{"", false},
+	}
+	for _, c := range cases {
+		if err := checkSelect(c.query); (err == nil) != c.ok {
+			t.Fatalf("query %q: err %v, expect ok %v", c.query, err, c.ok)
+		}
+	}
+}
+
+func TestBindSQL(t *testing.T) {
+	begin := time.Unix(1500000000, 0)
+	end := begin.Add(time.Hour)
+	query, args := bindSQL("SELECT a, b FROM t WHERE x >= $begin_unix AND y < $end AND z = '$other'", begin, end)
+	if query != "SELECT a, b FROM t WHERE x >= ? AND y < ? AND z = '$other'" {
+		t.Fatalf("unexpected query: %v", query)
+	}
+	if len(args) != 2 || args[0] != begin.Unix() || args[1] != end {
+		t.Fatalf("unexpected args: %v", args)
+	}
+}
@@ -35,6 +35,7 @@ type tsdbResp struct {
 var TSDBTSAttr = ts.Attributes{
 	Frequency: time.Second * 30,
 	Period:    time.Hour * 24, // fix period as 1 day
+	Periods:   []time.Duration{time.Hour * 24 * 7},
 }
 
 // TSDBFetcher .
@@ -50,6 +51,17 @@ type TSDBFetcher struct {
 	middleStorer MiddleStorer
 }
 
+func init() {
+	Register(SourceTSDB, func(conf BackendConfig) (TSFetcher, error) {
+		tf, err := NewTSDBFetcher(conf.API, conf.Retry, conf.Timeout, conf.MiddleStorer)
+		if err != nil {
+			return nil, err
+		}
+		tf.limiter = newBackendLimiter(conf)
+		return tf, nil
+	})
+}
+
 // NewTSDBFetcher .
 func NewTSDBFetcher(tsdbAPI string, defaultRetry int, defaultTimeout time.Duration, ms MiddleStorer) (*TSDBFetcher, error) {
 	op := &tsdb.Options{
@@ -62,7 +74,7 @@ func NewTSDBFetcher(tsdbAPI string, defaultRetry int, defaultTimeout time.Durati
 		return nil, fmt.Errorf("error when create tsdb.Client: %v", err)
 	}
 
-	limiter := NewConcLimiter(5)
+	limiter := NewConcLimiter(DefaultConcurrency)
 	metric := metrics.NewDefaultMetricsClientV2("toutiao.microservice.tsad", true)
 	return &TSDBFetcher{client, tsdbAPI, defaultTimeout, defaultRetry, limiter, metric, ms}, nil
 }
@@ -99,13 +111,22 @@ func (tf *TSDBFetcher) Fetch(ctx context.Context, src Source, begin, end time.Ti
 	for (len(oldPoints) > 0) && oldPoints[0].Stamp().Before(begin) {
 		oldPoints = oldPoints[1:]
 	}
+	for (len(oldPoints) > 0) && oldPoints[len(oldPoints)-1].Stamp().After(end) {
+		oldPoints = oldPoints[:len(oldPoints)-1]
+	}
 
-	if len(oldPoints) == 0 {
+	// the cached points don't cover the beginning, fetch all of them
+	if len(oldPoints) == 0 || oldPoints[0].Stamp().After(begin.Add(TSDBTSAttr.Frequency)) {
 		points, rerr = tf.fetchByDay(ctx, src, begin, end)
 		return
 	}
 
+	// only fetch the points after the cached ones
 	newBegin := oldPoints[len(oldPoints)-1].Stamp().Add(TSDBTSAttr.Frequency)
+	if newBegin.After(end) {
+		points = oldPoints
+		return
+	}
 	points, rerr = tf.fetchByDay(ctx, src, newBegin, end)
 	if rerr != nil {
 		return
@@ -115,6 +136,35 @@ func (tf *TSDBFetcher) Fetch(ctx context.Context, src Source, begin, end time.Ti
 	return
 }
 
+// Derive 展开Extra中含有*的tag, 返回最近10分钟中的每个tag集合
+func (tf *TSDBFetcher) Derive(ctx context.Context, src Source) ([]Source, error) {
+	if !strings.Contains(src.Extra, "*") {
+		return []Source{src}, nil
+	}
+
+	pattern := "%v?start=10m-ago&m=%v%v"
+	tsdbURL := fmt.Sprintf(pattern, tf.tsdbAPI, src.Key, src.Extra)
+	var resp []*tsdb.RespModel
+	if err := tf.client.Do(ctx, tsdbURL, &resp); err != nil {
+		return nil, fmt.Errorf("query tsdb err: %v", err)
+	}
+
+	var srcs []Source
+	for _, r := range resp {
+		var kvs []string
+		for k, v := range r.Tags {
+			kvs = append(kvs, fmt.Sprintf("%v=%v", k, v))
+		}
+		extra := "{" + strings.Join(kvs, ",") + "}"
+		srcs = append(srcs, Source{
+			Type:  src.Type,
+			Key:   src.Key,
+			Extra: extra,
+		})
+	}
+	return srcs, nil
+}
+
 func (tf *TSDBFetcher) fetchByDay(ctx context.Context, source Source, begin, end time.Time) (ts.Points, error) {
 	if source.Type != SourceTSDB {
 		return nil, fmt.Errorf("not a tsdb source type: %v", SourceTSDB)
@@ -13,6 +13,22 @@ type SourceType string
 const (
 	// SourceTSDB .
 	SourceTSDB SourceType = "TSDB"
+	// SourcePrometheus .
+	SourcePrometheus SourceType = "Prometheus"
+	// SourceInfluxDB .
+	SourceInfluxDB SourceType = "InfluxDB"
+	// SourceGraphite .
+	SourceGraphite SourceType = "Graphite"
+	// SourcePush the points are pushed to TSAD
+	SourcePush SourceType = "Push"
+	// SourceFile the points are read from the local files
+	SourceFile SourceType = "File"
+	// SourceSQL the points are queried from a database
+	SourceSQL SourceType = "SQL"
+	// SourceExpr the points are calculated from other sources
+	SourceExpr SourceType = "Expr"
+	// SourceHTTP the points are extracted from the JSON returned by a HTTP API
+	SourceHTTP SourceType = "HTTP"
 )
 
 // Source .
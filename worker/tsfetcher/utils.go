@@ -1,6 +1,14 @@
 package tsfetcher
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"code.byted.org/microservice/tsad/worker/ts"
@@ -8,6 +16,8 @@ import (
 
 var (
 	maxGap = time.Minute * 15
+
+	maxRespBody int64 = 64 << 20 // the responses larger than it are rejected by doHTTP
 )
 
 func complete(points ts.Points, freq time.Duration) ts.Points {
@@ -39,3 +49,205 @@ func complete(points ts.Points, freq time.Duration) ts.Points {
 
 	return results
 }
+
+// the aggregations of the points in the same interval, see bucketPoints
+const (
+	aggregateAvg = "avg"
+	aggregateSum = "sum"
+)
+
+// bucketPoints 将点按freq截断到所在的间隔, 同一个间隔中的点按aggregate聚合成一个点, 返回的点已排序
+func bucketPoints(points ts.Points, freq time.Duration, aggregate string) ts.Points {
+	sums := make(map[int64]float64, len(points))
+	cnts := make(map[int64]int, len(points))
+	for _, p := range points {
+		stamp := p.Stamp().Truncate(freq).UnixNano()
+		sums[stamp] += p.Value()
+		cnts[stamp]++
+	}
+
+	stamps := make([]int64, 0, len(sums))
+	for stamp := range sums {
+		stamps = append(stamps, stamp)
+	}
+	sort.Slice(stamps, func(i, j int) bool {
+		return stamps[i] < stamps[j]
+	})
+
+	results := make(ts.Points, 0, len(stamps))
+	for _, stamp := range stamps {
+		val := sums[stamp]
+		if aggregate == aggregateAvg {
+			val /= float64(cnts[stamp])
+		}
+		results = append(results, ts.NewPoint(time.Unix(0, stamp), val))
+	}
+	return results
+}
+
+// fetchByDay 按天切分[begin, end)分别调用fetch, 合并结果并去掉相邻两天重复的时间点
+func fetchByDay(begin, end time.Time, fetch func(begin, end time.Time) (ts.Points, error)) (ts.Points, error) {
+	points := make(ts.Points, 0, 2880)
+	dayDur := time.Hour * 24
+	for begin.Before(end) {
+		pos := begin.Add(dayDur)
+		if pos.After(end) {
+			pos = end
+		}
+		dayPoints, err := fetch(begin, pos)
+		if err != nil {
+			return nil, fmt.Errorf("fetch start %v to %v error: %v", begin, pos, err)
+		}
+
+		// the bounds of some queries are inclusive, the points of the same stamp in a day are kept
+		//  for bucketPoints
+		last := len(points) - 1
+		for _, p := range dayPoints {
+			if last < 0 || p.Stamp().After(points[last].Stamp()) {
+				points = append(points, p)
+			}
+		}
+		begin = pos
+	}
+	return points, nil
+}
+
+// queryError the query is invalid, retry can not fix it
+type queryError struct {
+	err error
+}
+
+func (e *queryError) Error() string {
+	return e.err.Error()
+}
+
+// the backoff before the first retry, it doubles after each retry up to maxRetryBackoff
+var (
+	retryBackoff    = 200 * time.Millisecond
+	maxRetryBackoff = 5 * time.Second
+)
+
+// retryQuery 调用query直到成功, 最多重试retry次, 重试间隔指数退避; queryError不重试, ctx取消时返回ctx.Err()
+func retryQuery(ctx context.Context, retry int, query func() error) error {
+	var err error
+	backoff := retryBackoff
+	for i := 0; i <= retry; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > maxRetryBackoff {
+				backoff = maxRetryBackoff
+			}
+		}
+		if err = query(); err == nil {
+			return nil
+		}
+		if _, ok := err.(*queryError); ok {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+// doHTTP 发送req并读取resp的body, timeout为0时不超时
+func doHTTP(ctx context.Context, client *http.Client, req *http.Request, timeout time.Duration) (status int, body []byte, err error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err = ioutil.ReadAll(io.LimitReader(resp.Body, maxRespBody+1))
+	if err != nil {
+		return 0, nil, fmt.Errorf("read resp err: %v", err)
+	}
+	if int64(len(body)) > maxRespBody {
+		return 0, nil, fmt.Errorf("the resp is larger than %v bytes", maxRespBody)
+	}
+	return resp.StatusCode, body, nil
+}
+
+// formatTags 返回tags的PromQL形式, 按tag名排序, 如{instance="10.1.10.1:80",job="api"}
+func formatTags(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	kvs := make([]string, 0, len(names))
+	for _, name := range names {
+		kvs = append(kvs, fmt.Sprintf("%v=%v", name, strconv.Quote(labels[name])))
+	}
+	return "{" + strings.Join(kvs, ",") + "}"
+}
+
+// parseTags 解析formatTags的结果, 空字符串返回nil
+func parseTags(str string) (map[string]string, error) {
+	str = strings.TrimSpace(str)
+	if str == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(str, "{") || !strings.HasSuffix(str, "}") {
+		return nil, fmt.Errorf("tags should be in {}")
+	}
+	str = strings.TrimSpace(str[1 : len(str)-1])
+
+	labels := make(map[string]string)
+	for str != "" {
+		eq := strings.Index(str, "=")
+		if eq <= 0 {
+			return nil, fmt.Errorf("no tag name")
+		}
+		name := strings.TrimSpace(str[:eq])
+		str = strings.TrimSpace(str[eq+1:])
+		if !strings.HasPrefix(str, `"`) {
+			return nil, fmt.Errorf("value of tag %v should be quoted", name)
+		}
+
+		// find the closing quote
+		end := 1
+		for end < len(str) && str[end] != '"' {
+			if str[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(str) {
+			return nil, fmt.Errorf("value of tag %v is not closed", name)
+		}
+		val, err := strconv.Unquote(str[:end+1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of tag %v: %v", name, err)
+		}
+		labels[name] = val
+
+		str = strings.TrimSpace(str[end+1:])
+		str = strings.TrimSpace(strings.TrimPrefix(str, ","))
+	}
+	return labels, nil
+}
+
+func tagsEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
@@ -1,6 +1,8 @@
 package tsfetcher
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -31,3 +33,113 @@ func TestComplete1(t *testing.T) {
 		fmt.Println(p.Stamp(), p.Value())
 	}
 }
+
+func TestTags(t *testing.T) {
+	labels := map[string]string{"job": "api", "path": `/a"b\c`, "empty": ""}
+	str := formatTags(labels)
+	parsed, err := parseTags(str)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tagsEqual(labels, parsed) {
+		t.Fatalf("%v parsed as %v", str, parsed)
+	}
+
+	parsed, err = parseTags(`{ job = "api" , instance="a:80", }`)
+	if err != nil || parsed["job"] != "api" || parsed["instance"] != "a:80" {
+		t.Fatalf("parsed %v, err: %v", parsed, err)
+	}
+
+	for _, str := range []string{`job="api"`, `{job=api}`, `{job="api}`, `{="api"}`} {
+		if _, err := parseTags(str); err == nil {
+			t.Fatalf("expect err for %v", str)
+		}
+	}
+}
+
+func TestBucketPoints(t *testing.T) {
+	begin := time.Unix(1500000000, 0)
+	points := ts.Points{
+		ts.NewPoint(begin.Add(time.Second*70), 4),
+		ts.NewPoint(begin.Add(time.Second*10), 1),
+		ts.NewPoint(begin.Add(time.Second*10), 2),
+		ts.NewPoint(begin.Add(time.Second*50), 3),
+	}
+
+	for _, c := range []struct {
+		aggregate string
+		expt      []float64
+	}{
+		{aggregateAvg, []float64{2, 4}},
+		{aggregateSum, []float64{6, 4}},
+	} {
+		results := bucketPoints(points, time.Minute, c.aggregate)
+		if len(results) != len(c.expt) {
+			t.Fatalf("%v: got %v points, expect %v", c.aggregate, len(results), len(c.expt))
+		}
+		for i, p := range results {
+			if !p.Stamp().Equal(begin.Add(time.Minute*time.Duration(i))) || p.Value() != c.expt[i] {
+				t.Fatalf("%v: point %v is %v: %v, expect %v", c.aggregate, i, p.Stamp(), p.Value(), c.expt[i])
+			}
+		}
+	}
+}
+
+func TestFetchByDay(t *testing.T) {
+	begin := time.Unix(1500000000, 0)
+	end := begin.Add(time.Hour * 36)
+	points, err := fetchByDay(begin, end, func(b, e time.Time) (ts.Points, error) {
+		// the bounds are inclusive, and there are two rows at the beginning of each day
+		return ts.Points{ts.NewPoint(b, 1), ts.NewPoint(b, 1), ts.NewPoint(e, 1)}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the end of the first day is the beginning of the second day
+	if len(points) != 4 {
+		t.Fatalf("got %v points, expect 4", len(points))
+	}
+}
+
+func TestRetryQuery(t *testing.T) {
+	retryBackoff, maxRetryBackoff = time.Millisecond, 2*time.Millisecond
+	defer func() { retryBackoff, maxRetryBackoff = 200*time.Millisecond, 5*time.Second }()
+
+	fail := errors.New("unavailable")
+	cases := []struct {
+		errs  []error // the results of the calls, nil after them
+		retry int
+		calls int
+		err   error
+	}{
+		{nil, 3, 1, nil},
+		{[]error{fail, fail}, 3, 3, nil},
+		{[]error{fail, fail, fail}, 1, 2, fail},
+		{[]error{&queryError{fail}}, 3, 1, fail},
+	}
+	for i, c := range cases {
+		calls := 0
+		err := retryQuery(context.Background(), c.retry, func() error {
+			calls++
+			if calls <= len(c.errs) {
+				return c.errs[calls-1]
+			}
+			return nil
+		})
+		if calls != c.calls || fmt.Sprint(err) != fmt.Sprint(c.err) {
+			t.Fatalf("case %v: %v calls and err %v, expect %v calls and err %v", i, calls, err, c.calls, c.err)
+		}
+	}
+
+	// the retries stop when the ctx is canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := retryQuery(ctx, 10, func() error {
+		calls++
+		cancel()
+		return fail
+	})
+	if calls != 1 || err != context.Canceled {
+		t.Fatalf("%v calls and err %v after cancel", calls, err)
+	}
+}
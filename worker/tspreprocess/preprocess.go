@@ -28,6 +28,32 @@ func BasicTSCheck(data ts.TS) error {
 	return nil
 }
 
+// MinPeriodConfidence 检测到的周期的最小置信度, 低于该值则认为该TS没有周期
+var MinPeriodConfidence = 0.3
+
+// DetectPeriod 利用ts.DetectPeriod重新设置TS的周期;
+//  原有的周期中, 只保留比检测到的周期更长, 且是其整数倍的周期;
+//  如果没有检测到显著的周期, 则将周期设置为UnknownOrInvalid, 交由无周期的模型处理;
+func DetectPeriod(data ts.TS) ts.TS {
+	attr := data.Attributes()
+	period, confidence := ts.DetectPeriod(data)
+	if period == ts.UnknownOrInvalid || confidence < MinPeriodConfidence {
+		attr.Period = ts.UnknownOrInvalid
+		attr.Periods = nil
+		return ts.NewTS(attr, data.Points())
+	}
+
+	longer := make([]time.Duration, 0, len(attr.Periods))
+	for _, p := range attr.AllPeriods() {
+		if p > period && p%period == 0 {
+			longer = append(longer, p)
+		}
+	}
+	attr.Period = period
+	attr.Periods = longer
+	return ts.NewTS(attr, data.Points())
+}
+
 // Preprocess .
 func Preprocess(data ts.TS) (ts.TS, error) {
 	if err := BasicTSCheck(data); err != nil {
@@ -44,5 +70,5 @@ func Preprocess(data ts.TS) (ts.TS, error) {
 		return nil, err
 	}
 
-	return data, nil
+	return DetectPeriod(data), nil
 }
@@ -3,13 +3,78 @@ package tstrain
 import (
 	"fmt"
 	"math"
+	"sort"
+	"sync"
+	"time"
 
+	"code.byted.org/gopkg/logs"
 	"code.byted.org/microservice/tsad/worker/detector"
 	"code.byted.org/microservice/tsad/worker/ts"
 )
 
-// TSModelPicker .
-type TSModelPicker func([]detector.TSModel) (best detector.TSModel, err error)
+// ModelCreator .
+type ModelCreator func() detector.TSModel
+
+/*
+TSModelPicker 训练候选模型, 并从中选出最好的一个;
+	scores为各候选模型的得分, 越小越好;
+	无法训练或者评估的模型, 其得分中带有Err;
+*/
+type TSModelPicker func(data ts.TS, cs []ModelCreator, adapter detector.ModelAdapter) (
+	best detector.TSModel, scores []detector.ModelScore, err error)
+
+// DefaultPicker .
+const DefaultPicker = "yahoo_egads"
+
+var (
+	pickers    = make(map[string]TSModelPicker)
+	pickerLock sync.RWMutex
+)
+
+func init() {
+	RegisterPicker(DefaultPicker, YahooEgadsPicker)
+	RegisterPicker("holdout", HoldoutPicker)
+}
+
+// RegisterPicker 注册名为name的TSModelPicker, 可以通过task config中的model_picker选择;
+func RegisterPicker(name string, picker TSModelPicker) {
+	pickerLock.Lock()
+	defer pickerLock.Unlock()
+	pickers[name] = picker
+}
+
+// Picker 返回名为name的TSModelPicker, name为空时返回DefaultPicker;
+func Picker(name string) (TSModelPicker, error) {
+	if name == "" {
+		name = DefaultPicker
+	}
+
+	pickerLock.RLock()
+	defer pickerLock.RUnlock()
+	picker, ok := pickers[name]
+	if !ok {
+		return nil, fmt.Errorf("no model picker: %v", name)
+	}
+	return picker, nil
+}
+
+// trainAll 用data训练所有的候选模型, 返回训练成功的模型;
+func trainAll(data ts.TS, cs []ModelCreator, adapter detector.ModelAdapter) ([]detector.TSModel, []detector.ModelScore) {
+	ms := make([]detector.TSModel, 0, len(cs))
+	scores := make([]detector.ModelScore, 0, len(cs))
+	for _, c := range cs {
+		m := c()
+		begin := time.Now()
+		if err := m.Train(data, adapter); err != nil {
+			logs.Errorf("[TSModelPicker] train %v err: %v", m.Name(), err)
+			scores = append(scores, detector.ModelScore{Model: m.Name(), Err: err.Error()})
+			continue
+		}
+		logs.Debugf("[TSModelPicker] train %v cost %v", m.Name(), time.Since(begin))
+		ms = append(ms, m)
+	}
+	return ms, scores
+}
 
 type yahooEgadsMetric struct {
 	bias float64
@@ -79,15 +144,22 @@ func yahooEgadsBetterThan(m1, m2 *yahooEgadsMetric) bool {
 
 }
 
-// YahooEgadsPicker .
-func YahooEgadsPicker(src ts.TS, ms []detector.TSModel) (detector.TSModel, error) {
+/*
+YahooEgadsPicker .
+	用全部数据训练候选模型, 并在同样的数据上计算bias, mad, mape, mse, sae,
+	两两比较, 选出最好的模型;
+	模型的得分为比它好的模型的个数;
+*/
+func YahooEgadsPicker(data ts.TS, cs []ModelCreator, adapter detector.ModelAdapter) (
+	detector.TSModel, []detector.ModelScore, error) {
+	ms, scores := trainAll(data, cs, adapter)
 	if len(ms) == 0 {
-		return nil, fmt.Errorf("empty model list")
+		return nil, scores, fmt.Errorf("no model can be trained for these data")
 	}
 
 	metrics := make([]*yahooEgadsMetric, 0, len(ms))
 	for _, m := range ms {
-		metrics = append(metrics, yahooEgadsCalMetric(src, m))
+		metrics = append(metrics, yahooEgadsCalMetric(data, m))
 	}
 
 	bestID := 0
@@ -97,5 +169,103 @@ func YahooEgadsPicker(src ts.TS, ms []detector.TSModel) (detector.TSModel, error
 		}
 	}
 
-	return ms[bestID], nil
+	for i, m := range ms {
+		better := 0
+		for j := range ms {
+			if i != j && yahooEgadsBetterThan(metrics[j], metrics[i]) {
+				better++
+			}
+		}
+		scores = append(scores, detector.ModelScore{Model: m.Name(), Score: float64(better)})
+	}
+
+	return ms[bestID], scores, nil
+}
+
+var (
+	// HoldoutFolds rolling-origin交叉验证的折数
+	HoldoutFolds = 3
+	// HoldoutHorizon 每折验证数据的时长, 不超过数据时长的 1/(2*HoldoutFolds)
+	HoldoutHorizon = time.Hour * 12
+)
+
+/*
+HoldoutPicker .
+	按时间做rolling-origin交叉验证, 避免选出在训练数据上过拟合的模型:
+		第k折(k = HoldoutFolds..1)以 origin = End - k*horizon 为界,
+		用origin之前的数据训练, 对 (origin, origin+horizon] 的数据计算平均绝对误差;
+	模型的得分为各折平均绝对误差的均值, 任意一折无法训练的模型不参与选择;
+	选出得分最小的模型后, 再用全部数据训练;
+	如果所有模型都无法验证, 退化为YahooEgadsPicker;
+*/
+func HoldoutPicker(data ts.TS, cs []ModelCreator, adapter detector.ModelAdapter) (
+	detector.TSModel, []detector.ModelScore, error) {
+	horizon := HoldoutHorizon
+	if max := data.End().Sub(data.Begin()) / time.Duration(2*HoldoutFolds); horizon > max {
+		horizon = max
+	}
+
+	scores := make([]detector.ModelScore, 0, len(cs))
+	valid := make([]int, 0, len(cs))
+	for i, c := range cs {
+		score := detector.ModelScore{Model: c().Name()}
+		var sum float64
+		for k := HoldoutFolds; k >= 1; k-- {
+			origin := data.End().Add(-horizon * time.Duration(k))
+			train, test := splitTS(data, origin, origin.Add(horizon))
+			if train.N() == 0 || test.N() == 0 {
+				score.Err = fmt.Sprintf("fold %v has no data", k)
+				break
+			}
+
+			m := c()
+			if err := m.Train(train, adapter); err != nil {
+				score.Err = fmt.Sprintf("fold %v train err: %v", k, err)
+				break
+			}
+			mae := yahooEgadsCalMetric(test, m).mad
+			if math.IsNaN(mae) || math.IsInf(mae, 0) {
+				score.Err = fmt.Sprintf("fold %v forecast err: %v", k, mae)
+				break
+			}
+			sum += mae
+		}
+
+		if score.Err == "" {
+			score.Score = sum / float64(HoldoutFolds)
+			valid = append(valid, i)
+		}
+		scores = append(scores, score)
+	}
+
+	if len(valid) == 0 {
+		return YahooEgadsPicker(data, cs, adapter)
+	}
+
+	sort.SliceStable(valid, func(i, j int) bool {
+		return scores[valid[i]].Score < scores[valid[j]].Score
+	})
+	for _, i := range valid {
+		m := cs[i]()
+		err := m.Train(data, adapter)
+		if err == nil {
+			return m, scores, nil
+		}
+		scores[i].Err = fmt.Sprintf("train err: %v", err)
+	}
+
+	return nil, scores, fmt.Errorf("no model can be trained for these data")
+}
+
+// splitTS 将data分为 [Begin, origin] 和 (origin, end] 两部分
+func splitTS(data ts.TS, origin, end time.Time) (ts.TS, ts.TS) {
+	var train, test ts.Points
+	for _, p := range data.Points() {
+		if !p.Stamp().After(origin) {
+			train = append(train, p)
+		} else if !p.Stamp().After(end) {
+			test = append(test, p)
+		}
+	}
+	return ts.NewTS(data.Attributes(), train), ts.NewTS(data.Attributes(), test)
 }
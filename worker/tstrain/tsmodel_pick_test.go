@@ -0,0 +1,174 @@
+package tstrain
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"code.byted.org/microservice/tsad/worker/detector"
+	"code.byted.org/microservice/tsad/worker/ts"
+)
+
+// memoryModel remembers the training data, so it is perfect on the training data but useless for the future
+type memoryModel struct {
+	data ts.TS
+}
+
+func (m *memoryModel) Name() string { return "memoryModel" }
+func (m *memoryModel) Train(data ts.TS, adapter detector.ModelAdapter) error {
+	m.data = data
+	return nil
+}
+func (m *memoryModel) Forecast(timestamp time.Time) float64 {
+	if p, ok := m.data.GetPoint(timestamp); ok {
+		return p.Value()
+	}
+	return 0
+}
+func (m *memoryModel) ForecastInterval(timestamp time.Time) (float64, float64) {
+	v := m.Forecast(timestamp)
+	return v, v
+}
+func (m *memoryModel) ModelData() ([]byte, error) { return nil, nil }
+func (m *memoryModel) Recover(data []byte) error  { return nil }
+
+// avgModel forecasts the average of the training data
+type avgModel struct {
+	avg float64
+}
+
+func (m *avgModel) Name() string { return "avgModel" }
+func (m *avgModel) Train(data ts.TS, adapter detector.ModelAdapter) error {
+	m.avg = ts.AVG(data.Values())
+	return nil
+}
+func (m *avgModel) Forecast(timestamp time.Time) float64 { return m.avg }
+func (m *avgModel) ForecastInterval(timestamp time.Time) (float64, float64) {
+	return m.avg - 10, m.avg + 10
+}
+func (m *avgModel) ModelData() ([]byte, error) { return nil, nil }
+func (m *avgModel) Recover(data []byte) error  { return nil }
+
+// brokenModel can't be trained
+type brokenModel struct {
+	avgModel
+}
+
+func (m *brokenModel) Name() string { return "brokenModel" }
+func (m *brokenModel) Train(data ts.TS, adapter detector.ModelAdapter) error {
+	return fmt.Errorf("broken")
+}
+
+func genNoiseTS() ts.TS {
+	r := rand.New(rand.NewSource(1))
+	begin := time.Unix(1500000000, 0)
+	ps := make(ts.Points, 0, 3*24*60)
+	for i := 0; i < 3*24*60; i++ {
+		ps = append(ps, ts.NewPoint(begin.Add(time.Minute*time.Duration(i)), 100+r.NormFloat64()))
+	}
+	return ts.NewTS(ts.Attributes{Frequency: time.Minute}, ps)
+}
+
+func TestPickers(t *testing.T) {
+	data := genNoiseTS()
+	cs := []ModelCreator{
+		func() detector.TSModel { return &memoryModel{} },
+		func() detector.TSModel { return &avgModel{} },
+		func() detector.TSModel { return &brokenModel{} },
+	}
+
+	cases := map[string]string{
+		"":            "memoryModel", // the default picker evaluates on the training data
+		"yahoo_egads": "memoryModel",
+		"holdout":     "avgModel",
+	}
+	for name, expt := range cases {
+		picker, err := Picker(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		best, scores, err := picker(data, cs, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if best.Name() != expt {
+			t.Fatalf("picker %v picks %v, expect %v", name, best.Name(), expt)
+		}
+		if len(scores) != len(cs) {
+			t.Fatalf("picker %v gives %v scores, expect %v", name, len(scores), len(cs))
+		}
+		for _, s := range scores {
+			if (s.Model == "brokenModel") != (s.Err != "") {
+				t.Fatalf("picker %v gives unexpected score: %+v", name, s)
+			}
+		}
+	}
+
+	if _, err := Picker("no_such_picker"); err == nil {
+		t.Fatal("expect err for unknown picker")
+	}
+}
+
+func TestCandidates(t *testing.T) {
+	cases := []struct {
+		op    *detector.TrainOption
+		names []string // nil if it is invalid
+	}{
+		// the other models are opt-in
+		{&detector.TrainOption{}, []string{"DcmpLineModel"}},
+		{&detector.TrainOption{Models: []string{"HoltWinters", "EWMAModel"}}, []string{"EWMAModel", "HoltWintersModel"}},
+		{&detector.TrainOption{
+			Models: []string{"HoltWinters"},
+			Params: map[string]map[string]float64{"HoltWinters": {"alpha": 0.3, "sigma": 4}},
+		}, []string{"HoltWintersModel"}},
+		// the params of the models which are not candidates are checked too
+		{&detector.TrainOption{Params: map[string]map[string]float64{"EWMA": {"alpha": 0.3}}}, []string{"DcmpLineModel"}},
+		{&detector.TrainOption{Models: []string{"NoSuchModel"}}, nil},
+		{&detector.TrainOption{Params: map[string]map[string]float64{"NoSuchModel": {"sigma": 3}}}, nil},
+		{&detector.TrainOption{Params: map[string]map[string]float64{"HoltWinters": {"no_such_param": 3}}}, nil},
+		{&detector.TrainOption{Params: map[string]map[string]float64{"HoltWinters": {"alpha": 2}}}, nil},
+		{&detector.TrainOption{Params: map[string]map[string]float64{"LineModel": {"max_bad_per": 1}}}, nil},
+	}
+	for i, c := range cases {
+		cs, err := candidates(c.op)
+		if c.names == nil {
+			if err == nil {
+				t.Fatalf("case %v: expect err for %+v", i, c.op)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("case %v: %v", i, err)
+		}
+		if len(cs) != len(c.names) {
+			t.Fatalf("case %v: %v candidates, expect %v", i, len(cs), c.names)
+		}
+		for j, create := range cs {
+			if name := create().Name(); name != c.names[j] {
+				t.Fatalf("case %v: candidate %v is %v, expect %v", i, j, name, c.names[j])
+			}
+		}
+	}
+}
+
+func TestResolveModel(t *testing.T) {
+	cases := []struct {
+		name string
+		full string // empty if it is unknown
+	}{
+		{"HoltWintersModel", "HoltWintersModel"},
+		{"HoltWinters", "HoltWintersModel"},
+		{"DcmpLine", "DcmpLineModel"},
+		{"STLDcmpLineModel", "STLDcmpLineModel"},
+		{"Model", ""},
+		{"holtwinters", ""},
+		{"", ""},
+	}
+	for _, c := range cases {
+		full, ok := ResolveModel(c.name)
+		if full != c.full || ok != (c.full != "") {
+			t.Fatalf("resolve %q: %v, %v, expect %q", c.name, full, ok, c.full)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package tsmodels
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"code.byted.org/microservice/tsad/worker/detector"
+	"code.byted.org/microservice/tsad/worker/ts"
+)
+
+/*
+adaptInterval .
+	利用adapter对预测区间的系数lower, upper做二分搜索;
+	先倍增找到一个adapter可以接受的系数, 然后依次二分:
+		1) lower, upper共同的最小系数;
+		2) lower的最小系数;
+		3) upper的最小系数;
+*/
+func adaptInterval(src ts.TS, adapter detector.ModelAdapter,
+	forecastInterval func(timestamp time.Time) (lower, upper float64),
+	lower, upper *float64) error {
+	*lower = 3
+	*upper = 3
+	for i := 0; i < 30; i++ {
+		if adapter(src, forecastInterval) {
+			break
+		}
+		*lower *= 2
+		*upper *= 2
+	}
+	if !adapter(src, forecastInterval) {
+		return fmt.Errorf("can't find a max adapter")
+	}
+
+	var left, right float64 = 0, *lower
+	cnt := 0
+	for {
+		*lower = (left + right) / 2
+		*upper = (left + right) / 2
+		if adapter(src, forecastInterval) {
+			if cnt > 40 || right-left < 0.0001 {
+				break
+			}
+			right = *upper
+		} else {
+			left = *upper
+		}
+		cnt++
+	}
+
+	// adapt the lowerAdapter
+	left, right = 0, *lower
+	cnt = 0
+	for {
+		*lower = (left + right) / 2
+		if adapter(src, forecastInterval) {
+			if cnt > 40 || right-left < 0.0001 {
+				break
+			}
+			right = *lower
+		} else {
+			left = *lower
+		}
+		cnt++
+	}
+
+	// adapt the upperAdapter
+	left, right = 0, *upper
+	cnt = 0
+	for {
+		*upper = (left + right) / 2
+		if adapter(src, forecastInterval) {
+			if cnt > 40 || right-left < 0.0001 {
+				break
+			}
+			right = *upper
+		} else {
+			left = *upper
+		}
+		cnt++
+	}
+
+	return nil
+}
+
+/*
+checkParams 检查由task config传入的模型参数;
+	所有模型都支持sigma: 预测区间的系数, 设置后不再用adapter搜索;
+	keys为模型支持的其他参数, ratios为其中取值需要在[0, 1]内的参数;
+*/
+func checkParams(params map[string]float64, keys []string, ratios []string) error {
+	for key, val := range params {
+		if math.IsNaN(val) || val < 0 {
+			return fmt.Errorf("invalid param %v: %v", key, val)
+		}
+		if key == "sigma" {
+			continue
+		}
+
+		supported := false
+		for _, k := range keys {
+			supported = supported || k == key
+		}
+		if !supported {
+			return fmt.Errorf("unsupported param: %v", key)
+		}
+		for _, k := range ratios {
+			if k == key && val > 1 {
+				return fmt.Errorf("param %v should be in [0, 1], got %v", key, val)
+			}
+		}
+	}
+	return nil
+}
+
+// paramOr 返回params中的key, 不存在时返回defaultVal
+func paramOr(params map[string]float64, key string, defaultVal float64) float64 {
+	if val, ok := params[key]; ok {
+		return val
+	}
+	return defaultVal
+}
+
+// paramOrGrid 如果params中有key, 只搜索该值, 否则搜索grid
+func paramOrGrid(params map[string]float64, key string, grid []float64) []float64 {
+	if val, ok := params[key]; ok {
+		return []float64{val}
+	}
+	return grid
+}
+
+// adaptOrFixInterval 如果params中有sigma, lower和upper直接使用该值, 否则使用adaptInterval;
+func adaptOrFixInterval(params map[string]float64, src ts.TS, adapter detector.ModelAdapter,
+	forecastInterval func(timestamp time.Time) (lower, upper float64),
+	lower, upper *float64) error {
+	if sigma, ok := params["sigma"]; ok {
+		*lower = sigma
+		*upper = sigma
+		return nil
+	}
+	return adaptInterval(src, adapter, forecastInterval, lower, upper)
+}
+
+// beyoundZero 如果时序的绝大多数值都大于等于0, 则预测值也需要大于等于0;
+func beyoundZero(data ts.TS) bool {
+	beyound := 0
+	for _, p := range data.Points() {
+		if p.Value() >= 0 {
+			beyound++
+		}
+	}
+	return (float64(beyound) / float64(data.N())) >= 0.999
+}
+
+// robustValues 剔除 |v| > 6*median(|v|) 的离群值, 与STLDecompose中鲁棒权重为0的点一致;
+func robustValues(vals []float64) []float64 {
+	abs := make([]float64, 0, len(vals))
+	for _, v := range vals {
+		abs = append(abs, math.Abs(v))
+	}
+	threshold := 6 * ts.PercentThreshold(abs, 0.5)
+
+	results := make([]float64, 0, len(vals))
+	for _, v := range vals {
+		if math.Abs(v) <= threshold {
+			results = append(results, v)
+		}
+	}
+	if len(results) == 0 {
+		return vals
+	}
+	return results
+}
+
+// maxLineFitPoints robustLineFit时最多使用的点数, 超过时等间隔采样;
+var maxLineFitPoints = 1000
+
+// robustLineFit 对points做PerTrichotomyFit, 返回 y = a*x + b 和拟合最好的 (1 - MaxBadPer)% 的点的sd;
+//  拟合前将X, Y归一化, 避免斜率过大或过小时三分角度的精度不足, op中的BErr为归一化后的误差;
+//  点数超过maxLineFitPoints时, 用等间隔采样的点拟合, 但sd仍然根据所有点计算;
+func robustLineFit(points ts.XYPoints, op *ts.PerTrichotomyFitOp) (a, b, sd float64) {
+	if len(points) == 0 {
+		return 0, 0, 0
+	}
+
+	xMin, xMax := math.Inf(1), math.Inf(-1)
+	ys := make([]float64, 0, len(points))
+	for _, p := range points {
+		xMin = math.Min(xMin, p.X)
+		xMax = math.Max(xMax, p.X)
+		ys = append(ys, p.Y)
+	}
+	yAVG := ts.AVG(ys)
+	ySD := ts.SD(ys)
+	if ySD == 0 || len(points) < 3 {
+		return 0, yAVG, ySD
+	}
+	xRange := xMax - xMin
+	if xRange == 0 {
+		xRange = 1
+	}
+
+	step := (len(points) + maxLineFitPoints - 1) / maxLineFitPoints
+	sampled := make(ts.XYPoints, 0, len(points)/step+1)
+	for i := 0; i < len(points); i += step {
+		sampled = append(sampled, ts.XYPoint{
+			X: (points[i].X - xMin) / xRange,
+			Y: (points[i].Y - yAVG) / ySD,
+		})
+	}
+	na, nb, _ := ts.PerTrichotomyFit(sampled, op)
+
+	a = ySD * na / xRange
+	b = ySD*(nb-na*xMin/xRange) + yAVG
+
+	diffs := make([]float64, 0, len(points))
+	for _, p := range points {
+		diff := p.Y - (a*p.X + b)
+		diffs = append(diffs, diff*diff)
+	}
+	sort.Float64s(diffs)
+	lim := int(float64(len(diffs)) * (1 - op.MaxBadPer))
+	if lim < 1 {
+		lim = 1
+	}
+	return a, b, math.Sqrt(ts.AVG(diffs[:lim]))
+}
+
+var (
+	// feedWeight FeedLatest时, 周期同位置的值(如季节项)中新的点的权重;
+	//  每个周期只会更新一次, 所以权重较大
+	feedWeight = 0.1
+	// feedSDWeight FeedLatest时, 标准差等全局的值中新的点的权重
+	feedSDWeight = 0.01
+)
+
+// feedSD 用新的残差r以指数加权的方式更新标准差sd
+func feedSD(sd, r, weight float64) float64 {
+	return math.Sqrt((1-weight)*sd*sd + weight*r*r)
+}
+
+// copyFloats 用于Clone, 复制FeedLatest会修改的slice
+func copyFloats(vals []float64) []float64 {
+	if vals == nil {
+		return nil
+	}
+	return append([]float64(nil), vals...)
+}
+
+// copyShifts 用于Clone, 复制FeedLatest会修改的map
+func copyShifts(m map[time.Duration]float64) map[time.Duration]float64 {
+	if m == nil {
+		return nil
+	}
+	c := make(map[time.Duration]float64, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
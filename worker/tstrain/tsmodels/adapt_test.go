@@ -0,0 +1,62 @@
+package tsmodels
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"code.byted.org/microservice/tsad/worker/detector"
+	"code.byted.org/microservice/tsad/worker/ts"
+)
+
+// TestClone feeding the clone doesn't change the original model
+func TestClone(t *testing.T) {
+	begin := time.Unix(1500000000, 0)
+	freq, period := time.Minute, time.Hour
+	data := genSeasonTS(begin, freq, period, 4, 0)
+	end := data.End()
+
+	models := []detector.OnlineTSModel{
+		NewDcmpLineModel(),
+		NewSTLDcmpLineModel(),
+		NewEWMAModel(),
+		NewHoltWintersModel(),
+		NewARIMAModel(),
+		NewLineModel(),
+		NewPeriod3SigmaModel(),
+	}
+	for _, m := range models {
+		if err := m.Train(data, testAdapter); err != nil {
+			t.Fatalf("train %v err: %v", m.Name(), err)
+		}
+		before, err := m.ModelData()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := m.Clone()
+		if c.Name() != m.Name() {
+			t.Fatalf("clone %v of %v", c.Name(), m.Name())
+		}
+		var latest ts.Points
+		for i := 1; i <= 10; i++ {
+			latest = append(latest, ts.NewPoint(end.Add(freq*time.Duration(i)), 200))
+		}
+		c.FeedLatest(latest)
+
+		after, err := m.ModelData()
+		if err != nil {
+			t.Fatal(err)
+		}
+		fed, err := c.ModelData()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(before, after) {
+			t.Fatalf("%v is changed by feeding its clone", m.Name())
+		}
+		if bytes.Equal(before, fed) {
+			t.Fatalf("the clone of %v is not fed", m.Name())
+		}
+	}
+}
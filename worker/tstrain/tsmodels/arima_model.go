@@ -0,0 +1,617 @@
+package tsmodels
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"code.byted.org/microservice/tsad/worker/detector"
+	"code.byted.org/microservice/tsad/worker/ts"
+)
+
+const (
+	// arimaZ 正态分布双侧99.9%的分位数, 与ModelAdapter允许的0.1%错误率一致
+	arimaZ = 3.29
+)
+
+var (
+	arimaMaxP      = 3              // 非季节AR的最大阶数
+	arimaMaxQ      = 2              // 非季节MA的最大阶数
+	arimaLongAR    = 10             // Hannan-Rissanen第一步长AR的阶数
+	arimaHorizon   = time.Hour * 48 // 训练后预先计算预测值和预测方差的时长
+	arimaMaxPoints = 20000          // arimaHorizon对应的最大点数
+)
+
+/*
+ARIMAModel .
+	SARIMA(p, d, q)(P, D, Q)s, s为一个周期的点数, 周期未知时退化为ARIMA(p, d, q);
+	对差分后的序列w:
+		w(t) = c + sum(ar(i)*w(t-i)) + e(t) + sum(ma(j)*e(t-j))
+	季节项使用lag为s的AR, MA系数, 与非季节项相加而不是相乘;
+
+	训练:
+		1) 周期已知且至少有四个周期时, 做一次季节差分(D=1);
+		2) 如果lag为1的自相关大于0.9, 再做一次差分(d=1);
+		3) 用Hannan-Rissanen两步回归估计各阶数的系数:
+			先拟合长AR得到残差的估计, 再以滞后的w和残差为自变量做最小二乘;
+		4) 在 p <= arimaMaxP, q <= arimaMaxQ, P, Q <= 1 中选取AIC最小的阶数;
+
+	预测:
+		将差分展开为原序列上的AR多项式, 递推得到预测值;
+		h步预测误差的方差为 sigma2 * (psi(0)^2 + ... + psi(h-1)^2), psi为MA(∞)的系数;
+		upper/lower: expt +/- Z*sqrt(方差), Z默认为arimaZ;
+	训练数据范围内的点使用一步预测值, 其方差为sigma2;
+	区间由误差方差得到, 不使用ModelAdapter;
+	参数: sigma 即Z;
+*/
+type ARIMAModel struct {
+	params map[string]float64
+	fitted []float64 // one-step forecasts of the training data, used to evaluate this model
+
+	// expanded on the original series, see prepare
+	yLags     []int
+	yCoefs    []float64
+	forecasts []float64 // forecasts[h-1] is the h-step forecast
+	variances []float64 // variances[h-1] is the variance of the h-step forecast error
+
+	P, D, Q                         int
+	SeasonalP, SeasonalD, SeasonalQ int
+	Slots                           int // points of a period, 0 if no season
+
+	Intercept float64
+	ARLags    []int
+	ARCoefs   []float64
+	MALags    []int
+	MACoefs   []float64
+	Sigma2    float64 // variance of the one-step forecast error
+	AIC       float64
+	Z         float64 // upper/lower: expt +/- Z*sqrt(variance)
+
+	Frequency time.Duration
+	Begin     time.Time
+	End       time.Time
+
+	Tail      []float64 // latest values of the training data
+	ResidTail []float64 // latest residuals of the training data
+
+	BeyoundZero bool
+}
+
+// NewARIMAModel .
+func NewARIMAModel() *ARIMAModel {
+	return &ARIMAModel{}
+}
+
+// Name .
+func (m *ARIMAModel) Name() string {
+	return "ARIMAModel"
+}
+
+// ModelData .
+func (m *ARIMAModel) ModelData() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+// Recover .
+func (m *ARIMAModel) Recover(data []byte) error {
+	var model ARIMAModel
+	if err := json.Unmarshal(data, &model); err != nil {
+		return err
+	}
+	if model.Frequency == ts.UnknownOrInvalid || len(model.ARLags) != len(model.ARCoefs) ||
+		len(model.MALags) != len(model.MACoefs) {
+		return fmt.Errorf("invalid model data")
+	}
+	if model.Z == 0 {
+		model.Z = arimaZ
+	}
+	if err := model.prepare(); err != nil {
+		return err
+	}
+	*m = model
+	return nil
+}
+
+type arimaCandidate struct {
+	p, q, sp, sq int
+	arLags       []int
+	maLags       []int
+	c            float64
+	ar           []float64
+	ma           []float64
+	resid        []float64
+	sigma2       float64
+	aic          float64
+}
+
+// SetParams .
+func (m *ARIMAModel) SetParams(params map[string]float64) error {
+	if err := checkParams(params, nil, nil); err != nil {
+		return err
+	}
+	m.params = params
+	return nil
+}
+
+// Train .
+func (m *ARIMAModel) Train(data ts.TS, adapter detector.ModelAdapter) error {
+	if data.Frequency() == ts.UnknownOrInvalid {
+		return fmt.Errorf("no frequency")
+	}
+	if !data.Completed() {
+		data = ts.LastValueComplete(data)
+	}
+
+	y := data.Values()
+	slots := 0
+	if data.Period() != ts.UnknownOrInvalid {
+		slots = int(data.Period() / data.Frequency())
+		if slots < 2 || len(y) < 4*slots {
+			slots = 0
+		}
+	}
+
+	w := y
+	d, sd := 0, 0
+	if slots > 0 {
+		w = difference(w, slots)
+		sd = 1
+	}
+	if lag1AutoCorrelation(w) > 0.9 {
+		w = difference(w, 1)
+		d = 1
+	}
+
+	seasonal := 0
+	if slots > 0 {
+		seasonal = 1
+	}
+	longLags := makeLags(arimaLongAR, seasonal, slots)
+	maxLag := arimaMaxP
+	if arimaMaxQ > maxLag {
+		maxLag = arimaMaxQ
+	}
+	if slots > maxLag {
+		maxLag = slots
+	}
+	start := maxInts(longLags) + maxLag
+	if len(w)-start < 50 {
+		return fmt.Errorf("too few points: %v", len(y))
+	}
+
+	// Hannan-Rissanen step 1: long AR
+	longC, longAR, err := olsLagFit(w, nil, longLags, nil, maxInts(longLags))
+	if err != nil {
+		return fmt.Errorf("fit long AR err: %v", err)
+	}
+	longResid := armaResiduals(w, longC, longLags, longAR, nil, nil)
+
+	// Hannan-Rissanen step 2 and AIC selection
+	var best *arimaCandidate
+	for p := 0; p <= arimaMaxP; p++ {
+		for q := 0; q <= arimaMaxQ; q++ {
+			for sp := 0; sp <= seasonal; sp++ {
+				for sq := 0; sq <= seasonal; sq++ {
+					c := &arimaCandidate{
+						p: p, q: q, sp: sp, sq: sq,
+						arLags: makeLags(p, sp, slots),
+						maLags: makeLags(q, sq, slots),
+					}
+					c.c, c.ar, err = olsLagFit(w, longResid, c.arLags, c.maLags, start)
+					if err != nil {
+						continue
+					}
+					c.ma = c.ar[len(c.arLags):]
+					c.ar = c.ar[:len(c.arLags)]
+					c.resid = armaResiduals(w, c.c, c.arLags, c.ar, c.maLags, c.ma)
+					if c.resid == nil {
+						continue // not invertible
+					}
+
+					var sse float64
+					for _, e := range c.resid[start:] {
+						sse += e * e
+					}
+					n := float64(len(w) - start)
+					c.sigma2 = math.Max(sse/n, 1e-12)
+					c.aic = n*math.Log(c.sigma2) + 2*float64(len(c.ar)+len(c.ma)+2)
+					if best == nil || c.aic < best.aic {
+						best = c
+					}
+				}
+			}
+		}
+	}
+	if best == nil {
+		return fmt.Errorf("no ARIMA order can be fitted")
+	}
+
+	m.P, m.D, m.Q = best.p, d, best.q
+	m.SeasonalP, m.SeasonalD, m.SeasonalQ = best.sp, sd, best.sq
+	m.Slots = slots
+	m.Intercept = best.c
+	m.ARLags, m.ARCoefs = best.arLags, best.ar
+	m.MALags, m.MACoefs = best.maLags, best.ma
+	m.Sigma2 = best.sigma2
+	m.Z = paramOr(m.params, "sigma", arimaZ)
+	m.AIC = best.aic
+	m.Frequency = data.Frequency()
+	m.Begin = data.Begin()
+	m.End = data.End()
+	m.BeyoundZero = beyoundZero(data)
+
+	// align the residuals with y
+	offset := len(y) - len(w)
+	resid := make([]float64, len(y))
+	copy(resid[offset:], best.resid)
+	m.fitted = make([]float64, len(y))
+	for i := range y {
+		m.fitted[i] = y[i] - resid[i]
+	}
+
+	maxYLag := maxInts(m.ARLags) + m.D + m.SeasonalD*m.Slots
+	m.Tail = lastValues(y, maxYLag)
+	m.ResidTail = lastValues(resid, maxInts(m.MALags))
+
+	return m.prepare()
+}
+
+// prepare 将差分展开为原序列上的AR多项式, 并计算arimaHorizon内的预测值和预测方差;
+func (m *ARIMAModel) prepare() error {
+	// phi(B) * (1-B)^d * (1-B^s)^D
+	poly := make([]float64, maxInts(m.ARLags)+1)
+	poly[0] = 1
+	for i, lag := range m.ARLags {
+		poly[lag] -= m.ARCoefs[i]
+	}
+	for i := 0; i < m.SeasonalD; i++ {
+		poly = polyDiff(poly, m.Slots)
+	}
+	for i := 0; i < m.D; i++ {
+		poly = polyDiff(poly, 1)
+	}
+
+	m.yLags = m.yLags[:0]
+	m.yCoefs = m.yCoefs[:0]
+	for lag := 1; lag < len(poly); lag++ {
+		if poly[lag] != 0 {
+			m.yLags = append(m.yLags, lag)
+			m.yCoefs = append(m.yCoefs, -poly[lag])
+		}
+	}
+	if len(m.Tail) < maxInts(m.yLags) || len(m.ResidTail) < maxInts(m.MALags) {
+		return fmt.Errorf("tail of the training data is too short")
+	}
+
+	steps := int(arimaHorizon / m.Frequency)
+	if steps > arimaMaxPoints {
+		steps = arimaMaxPoints
+	}
+	if steps < 1 {
+		steps = 1
+	}
+
+	hist := append([]float64{}, m.Tail...)
+	resid := append([]float64{}, m.ResidTail...)
+	m.forecasts = make([]float64, steps)
+	for h := 0; h < steps; h++ {
+		v := m.Intercept
+		for i, lag := range m.yLags {
+			v += m.yCoefs[i] * hist[len(hist)-lag]
+		}
+		for i, lag := range m.MALags {
+			v += m.MACoefs[i] * resid[len(resid)-lag]
+		}
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("forecast diverges")
+		}
+		m.forecasts[h] = v
+		hist = append(hist, v)
+		resid = append(resid, 0)
+	}
+
+	ma := make(map[int]float64, len(m.MALags))
+	for i, lag := range m.MALags {
+		ma[lag] = m.MACoefs[i]
+	}
+	psi := make([]float64, steps)
+	m.variances = make([]float64, steps)
+	var sum float64
+	for j := 0; j < steps; j++ {
+		if j == 0 {
+			psi[j] = 1
+		} else {
+			psi[j] = ma[j]
+			for i, lag := range m.yLags {
+				if j-lag >= 0 {
+					psi[j] += m.yCoefs[i] * psi[j-lag]
+				}
+			}
+		}
+		sum += psi[j] * psi[j]
+		m.variances[j] = m.Sigma2 * sum
+	}
+
+	return nil
+}
+
+/*
+FeedLatest .
+	将新的点和其一步预测的残差加入Tail, ResidTail, 缺失的点用预测值补全(残差为0);
+	以指数加权的方式更新Sigma2, 然后重新计算预测值和预测方差;
+*/
+func (m *ARIMAModel) FeedLatest(points ts.Points) {
+	tailLen, residLen := len(m.Tail), len(m.ResidTail)
+	fed := false
+	for _, p := range points {
+		if !p.Stamp().After(m.End) {
+			continue
+		}
+		for m.End.Add(m.Frequency).Before(p.Stamp()) {
+			m.pushTail(m.nextForecast(), 0)
+			m.End = m.End.Add(m.Frequency)
+		}
+
+		r := p.Value() - m.nextForecast()
+		m.Sigma2 = (1-feedSDWeight)*m.Sigma2 + feedSDWeight*r*r
+		m.pushTail(p.Value(), r)
+		m.End = p.Stamp()
+		fed = true
+	}
+	if !fed {
+		return
+	}
+
+	m.Tail = lastValues(m.Tail, tailLen)
+	m.ResidTail = lastValues(m.ResidTail, residLen)
+	m.fitted = nil // the fitted values can't be located by Begin any more
+	m.prepare()
+}
+
+// Clone .
+func (m *ARIMAModel) Clone() detector.OnlineTSModel {
+	c := *m
+	c.yLags = append([]int(nil), m.yLags...)
+	c.yCoefs = copyFloats(m.yCoefs)
+	c.forecasts = copyFloats(m.forecasts)
+	c.variances = copyFloats(m.variances)
+	c.Tail = copyFloats(m.Tail)
+	c.ResidTail = copyFloats(m.ResidTail)
+	return &c
+}
+
+// nextForecast 根据Tail, ResidTail计算下一个点的一步预测值
+func (m *ARIMAModel) nextForecast() float64 {
+	v := m.Intercept
+	for i, lag := range m.yLags {
+		v += m.yCoefs[i] * m.Tail[len(m.Tail)-lag]
+	}
+	for i, lag := range m.MALags {
+		v += m.MACoefs[i] * m.ResidTail[len(m.ResidTail)-lag]
+	}
+	return v
+}
+
+func (m *ARIMAModel) pushTail(v, r float64) {
+	m.Tail = append(m.Tail, v)
+	m.ResidTail = append(m.ResidTail, r)
+}
+
+// step 返回timestamp位于训练数据之后的步数, 训练数据范围内的点返回0
+func (m *ARIMAModel) step(timestamp time.Time) int {
+	if !timestamp.After(m.End) {
+		return 0
+	}
+	h := int((timestamp.Sub(m.End) + m.Frequency/2) / m.Frequency)
+	if h < 1 {
+		h = 1
+	}
+	if h > len(m.forecasts) {
+		h = len(m.forecasts)
+	}
+	return h
+}
+
+// Forecast .
+func (m *ARIMAModel) Forecast(timestamp time.Time) float64 {
+	var result float64
+	if h := m.step(timestamp); h > 0 {
+		result = m.forecasts[h-1]
+	} else {
+		idx := int(timestamp.Sub(m.Begin) / m.Frequency)
+		if idx >= 0 && idx < len(m.fitted) {
+			result = m.fitted[idx]
+		} else {
+			result = m.forecasts[0]
+		}
+	}
+
+	if m.BeyoundZero && result < 0 {
+		result = 0
+	}
+	return result
+}
+
+// ForecastInterval .
+func (m *ARIMAModel) ForecastInterval(timestamp time.Time) (lower, upper float64) {
+	v := m.Forecast(timestamp)
+	variance := m.Sigma2
+	if h := m.step(timestamp); h > 0 {
+		variance = m.variances[h-1]
+	}
+
+	width := m.Z * math.Sqrt(variance)
+	lower = v - width
+	upper = v + width
+	if m.BeyoundZero && lower < 0 {
+		lower = 0
+	}
+	return
+}
+
+// makeLags 返回 1..p, 如果sp > 0, 再加上lag为slots的季节项
+func makeLags(p, sp, slots int) []int {
+	lags := make([]int, 0, p+1)
+	for i := 1; i <= p; i++ {
+		lags = append(lags, i)
+	}
+	if sp > 0 && slots > p {
+		lags = append(lags, slots)
+	}
+	return lags
+}
+
+// olsLagFit 以1, w(t-arLags), e(t-maLags)为自变量, w(t)为因变量, 对t >= start做最小二乘;
+//  返回常数项和其他系数(先AR后MA);
+func olsLagFit(w, e []float64, arLags, maLags []int, start int) (float64, []float64, error) {
+	k := 1 + len(arLags) + len(maLags)
+	xtx := make([][]float64, k)
+	for i := range xtx {
+		xtx[i] = make([]float64, k)
+	}
+	xty := make([]float64, k)
+
+	row := make([]float64, k)
+	for t := start; t < len(w); t++ {
+		row[0] = 1
+		for i, lag := range arLags {
+			row[1+i] = w[t-lag]
+		}
+		for i, lag := range maLags {
+			row[1+len(arLags)+i] = e[t-lag]
+		}
+		for i := 0; i < k; i++ {
+			xty[i] += row[i] * w[t]
+			for j := 0; j < k; j++ {
+				xtx[i][j] += row[i] * row[j]
+			}
+		}
+	}
+
+	beta, err := solveLinear(xtx, xty)
+	if err != nil {
+		return 0, nil, err
+	}
+	return beta[0], beta[1:], nil
+}
+
+// solveLinear 高斯消元(列主元)求解 a*x = b, 会修改a和b
+func solveLinear(a [][]float64, b []float64) ([]float64, error) {
+	n := len(b)
+	for col := 0; col < n; col++ {
+		pivot := col
+		for r := col + 1; r < n; r++ {
+			if math.Abs(a[r][col]) > math.Abs(a[pivot][col]) {
+				pivot = r
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return nil, fmt.Errorf("singular matrix")
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		b[col], b[pivot] = b[pivot], b[col]
+
+		for r := col + 1; r < n; r++ {
+			f := a[r][col] / a[col][col]
+			for c := col; c < n; c++ {
+				a[r][c] -= f * a[col][c]
+			}
+			b[r] -= f * b[col]
+		}
+	}
+
+	x := make([]float64, n)
+	for r := n - 1; r >= 0; r-- {
+		sum := b[r]
+		for c := r + 1; c < n; c++ {
+			sum -= a[r][c] * x[c]
+		}
+		x[r] = sum / a[r][r]
+	}
+	return x, nil
+}
+
+// armaResiduals 递推计算残差, 前max(lag)个残差为0;
+//  如果残差发散(MA部分不可逆), 返回nil;
+func armaResiduals(w []float64, c float64, arLags []int, ar []float64, maLags []int, ma []float64) []float64 {
+	start := maxInts(arLags)
+	if l := maxInts(maLags); l > start {
+		start = l
+	}
+
+	resid := make([]float64, len(w))
+	for t := start; t < len(w); t++ {
+		v := c
+		for i, lag := range arLags {
+			v += ar[i] * w[t-lag]
+		}
+		for i, lag := range maLags {
+			v += ma[i] * resid[t-lag]
+		}
+		resid[t] = w[t] - v
+		if math.IsNaN(resid[t]) || math.Abs(resid[t]) > 1e100 {
+			return nil
+		}
+	}
+	return resid
+}
+
+// difference (1 - B^lag) * vals
+func difference(vals []float64, lag int) []float64 {
+	if len(vals) <= lag {
+		return nil
+	}
+	results := make([]float64, 0, len(vals)-lag)
+	for i := lag; i < len(vals); i++ {
+		results = append(results, vals[i]-vals[i-lag])
+	}
+	return results
+}
+
+// polyDiff poly * (1 - B^lag)
+func polyDiff(poly []float64, lag int) []float64 {
+	results := make([]float64, len(poly)+lag)
+	for i, c := range poly {
+		results[i] += c
+		results[i+lag] -= c
+	}
+	return results
+}
+
+func lag1AutoCorrelation(vals []float64) float64 {
+	if len(vals) < 3 {
+		return 0
+	}
+	avg := ts.AVG(vals)
+	var num, den float64
+	for i, v := range vals {
+		den += (v - avg) * (v - avg)
+		if i > 0 {
+			num += (v - avg) * (vals[i-1] - avg)
+		}
+	}
+	if den == 0 {
+		return 0
+	}
+	return num / den
+}
+
+func maxInts(vals []int) int {
+	result := 0
+	for _, v := range vals {
+		if v > result {
+			result = v
+		}
+	}
+	return result
+}
+
+func lastValues(vals []float64, n int) []float64 {
+	if n > len(vals) {
+		n = len(vals)
+	}
+	results := make([]float64, n)
+	copy(results, vals[len(vals)-n:])
+	return results
+}
@@ -0,0 +1,108 @@
+package tsmodels
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"code.byted.org/microservice/tsad/worker/ts"
+)
+
+func TestARIMAModelAR1(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	begin := time.Unix(1500000000, 0)
+	freq := time.Minute
+	n := 3000
+
+	ps := make(ts.Points, 0, n)
+	v := 0.0
+	for i := 0; i < n; i++ {
+		v = 0.7*v + r.NormFloat64()
+		ps = append(ps, ts.NewPoint(begin.Add(freq*time.Duration(i)), 100+v))
+	}
+	data := ts.NewTS(ts.Attributes{Frequency: freq, Period: ts.UnknownOrInvalid}, ps)
+
+	m := NewARIMAModel()
+	if err := m.Train(data, testAdapter); err != nil {
+		t.Fatal(err)
+	}
+	if m.D != 0 || m.P < 1 || math.Abs(m.ARCoefs[0]-0.7) > 0.1 {
+		t.Fatalf("unexpected model: d=%v, p=%v, ar=%v", m.D, m.P, m.ARCoefs)
+	}
+	if math.Abs(m.Sigma2-1) > 0.1 {
+		t.Fatalf("sigma2 %v, expect 1", m.Sigma2)
+	}
+
+	// the forecast converges to the mean and the interval to the stationary variance
+	far := data.End().Add(time.Hour)
+	if f := m.Forecast(far); math.Abs(f-100) > 0.5 {
+		t.Fatalf("forecast %v, expect 100", f)
+	}
+	lower, upper := m.ForecastInterval(data.End().Add(freq))
+	farLower, farUpper := m.ForecastInterval(far)
+	if upper-lower >= farUpper-farLower {
+		t.Fatalf("interval of one step [%v, %v] is wider than [%v, %v]", lower, upper, farLower, farUpper)
+	}
+	stationary := 2 * arimaZ * math.Sqrt(1/(1-0.49))
+	if math.Abs((farUpper-farLower)-stationary) > 0.1*stationary {
+		t.Fatalf("interval width %v, expect %v", farUpper-farLower, stationary)
+	}
+}
+
+func TestARIMAModelSeasonal(t *testing.T) {
+	begin := time.Unix(1500000000, 0)
+	freq := time.Minute
+	data := genSeasonTS(begin, freq, time.Hour, 6, 0)
+
+	m := NewARIMAModel()
+	if err := m.Train(data, testAdapter); err != nil {
+		t.Fatal(err)
+	}
+	if m.SeasonalD != 1 || m.Slots != 60 {
+		t.Fatalf("unexpected seasonal model: D=%v, s=%v", m.SeasonalD, m.Slots)
+	}
+
+	for i := 1; i <= 60; i++ {
+		stamp := data.End().Add(freq * time.Duration(i))
+		slot := int(stamp.Sub(begin)/freq) % 60
+		expt := 100 + 20*math.Sin(2*math.Pi*float64(slot)/60)
+		if f := m.Forecast(stamp); math.Abs(f-expt) > 4 {
+			t.Fatalf("forecast %v at %v, expect %v", f, stamp, expt)
+		}
+		lower, upper := m.ForecastInterval(stamp)
+		if lower > expt || upper < expt {
+			t.Fatalf("%v not in [%v, %v]", expt, lower, upper)
+		}
+	}
+}
+
+func TestARIMAModelData(t *testing.T) {
+	data := genSeasonTS(time.Unix(1500000000, 0), time.Minute, time.Hour, 5, 0)
+	m := NewARIMAModel()
+	if err := m.Train(data, testAdapter); err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := m.ModelData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1 := &ARIMAModel{}
+	if err := m1.Recover(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 120; i++ {
+		stamp := data.End().Add(time.Minute * time.Duration(i))
+		l, u := m.ForecastInterval(stamp)
+		l1, u1 := m1.ForecastInterval(stamp)
+		if l != l1 || u != u1 {
+			t.Fatalf("recovered model forecast [%v, %v], expect [%v, %v]", l1, u1, l, u)
+		}
+	}
+
+	if err := m1.Recover([]byte("{}")); err == nil {
+		t.Fatal("expect err for empty model data")
+	}
+}
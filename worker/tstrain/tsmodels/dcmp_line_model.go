@@ -22,27 +22,40 @@ DcmpLineModel .
 		expt: F(x) + savg(x) + ravg
 		upper: expt + 3*rsd
 		lower: expt - 3*rsd
+
+	STL为true时, 使用鲁棒的STLDecompose代替ClassicalDecompose;
+	此时tavg取t在周期同位置最近的一个点, 以跟随趋势的变化;
+
+	如果TS有多个周期(如日周期和周周期):
+		对r提取更长周期的季节项, 各周期同位置做平均, 加到预测值中;
+		t按照最长的周期聚合(训练数据需要覆盖该周期), 以保留周末等按天变化的趋势;
 */
 type DcmpLineModel struct {
-	src    ts.TS
-	trend  ts.TS
-	season ts.TS
-	random ts.TS
-
-	Freq   int
-	Begin  time.Time
-	Period time.Duration
+	src          ts.TS
+	params       map[string]float64
+	trend        ts.TS
+	season       ts.TS
+	random       ts.TS
+	extraSeasons map[time.Duration]ts.TS
+
+	Freq        int
+	Begin       time.Time
+	Period      time.Duration
+	Periods     []time.Duration
+	TrendPeriod time.Duration // PeriodTrend is aggregated by this period, Period is used if 0
 
 	// periodTrendLineA map[time.Duration]float64
 	// periodTrendLineB map[time.Duration]float64
 	PeriodTrend  map[time.Duration]float64
 	PeriodSeaon  map[time.Duration]float64
+	ExtraSeason  map[time.Duration]map[time.Duration]float64 // [period][shift] for the longer periods
 	RandomAVG    float64
 	RandomSD     float64
 	LowerAdapter float64
 	UpperAdapter float64
 
 	BeyoundZero bool
+	STL         bool
 }
 
 // NewDcmpLineModel .
@@ -50,8 +63,16 @@ func NewDcmpLineModel() *DcmpLineModel {
 	return &DcmpLineModel{}
 }
 
+// NewSTLDcmpLineModel .
+func NewSTLDcmpLineModel() *DcmpLineModel {
+	return &DcmpLineModel{STL: true}
+}
+
 // Name .
 func (m *DcmpLineModel) Name() string {
+	if m.STL {
+		return "STLDcmpLineModel"
+	}
 	return "DcmpLineModel"
 }
 
@@ -72,13 +93,16 @@ func (m *DcmpLineModel) Recover(data []byte) error {
 
 // IfBeyoundZero 如果时序的绝大多数值都大于等于0, 则预测值也需要大于等于0;
 func (m *DcmpLineModel) IfBeyoundZero(data ts.TS) bool {
-	beyound := 0
-	for _, p := range data.Points() {
-		if p.Value() >= 0 {
-			beyound++
-		}
+	return beyoundZero(data)
+}
+
+// SetParams .
+func (m *DcmpLineModel) SetParams(params map[string]float64) error {
+	if err := checkParams(params, nil, nil); err != nil {
+		return err
 	}
-	return (float64(beyound) / float64(data.N())) >= 0.999
+	m.params = params
+	return nil
 }
 
 // Train .
@@ -89,6 +113,7 @@ func (m *DcmpLineModel) Train(data ts.TS, adapter detector.ModelAdapter) error {
 	if data.Frequency() == ts.UnknownOrInvalid {
 		return fmt.Errorf("no frequency")
 	}
+	observed := data
 	if !data.Completed() {
 		// TODO(zhangyuanjia):
 		//  complete this ts
@@ -101,14 +126,31 @@ func (m *DcmpLineModel) Train(data ts.TS, adapter detector.ModelAdapter) error {
 	m.src = data
 	m.Begin = m.src.Begin()
 	m.Period = m.src.Period()
-
-	s, t, e, err := ts.ClassicalDecompose(m.src)
+	m.Periods = m.src.Periods()
+
+	var s, t, e ts.TS
+	var extra map[time.Duration]ts.TS
+	var err error
+	if m.STL {
+		// the missing points will be ignored by STLDecompose
+		s, t, e, err = ts.STLDecompose(observed, &ts.STLDecomposeOp{Robust: true})
+		if err == nil {
+			s = ts.LastValueComplete(s)
+			t = ts.LastValueComplete(t)
+			if len(m.Periods) > 1 {
+				extra, e = ts.ExtractSeasons(e, m.Begin, m.Periods[1:], m.Freq/24)
+			}
+		}
+	} else {
+		s, extra, t, e, err = ts.ClassicalMultiDecompose(m.src)
+	}
 	if err != nil {
 		return err
 	}
 	m.season = s
 	m.trend = t
 	m.random = e
+	m.extraSeasons = extra
 
 	m.calPeriod()
 	if err := m.adapt(adapter); err != nil {
@@ -125,84 +167,41 @@ func (m *DcmpLineModel) clear() {
 	m.season = nil
 	m.trend = nil
 	m.random = nil
+	m.extraSeasons = nil
 }
 
 func (m *DcmpLineModel) adapt(adapter detector.ModelAdapter) error {
-	m.LowerAdapter = 3
-	m.UpperAdapter = 3
-	for i := 0; i < 30; i++ {
-		if adapter(m.src, m.ForecastInterval) {
-			break
-		}
-		m.LowerAdapter *= 2
-		m.UpperAdapter *= 2
-	}
-	if !adapter(m.src, m.ForecastInterval) {
-		return fmt.Errorf("can't find a max adapter")
-	}
-
-	var left, right float64 = 0, m.LowerAdapter
-	cnt := 0
-	for {
-		m.LowerAdapter = (left + right) / 2
-		m.UpperAdapter = (left + right) / 2
-		if adapter(m.src, m.ForecastInterval) {
-			if cnt > 40 || right-left < 0.0001 {
-				break
-			}
-			right = m.UpperAdapter
-		} else {
-			left = m.UpperAdapter
-		}
-		cnt++
-	}
-
-	// adapt the lowerAdapter
-	left, right = 0, m.LowerAdapter
-	cnt = 0
-	for {
-		m.LowerAdapter = (left + right) / 2
-		if adapter(m.src, m.ForecastInterval) {
-			if cnt > 40 || right-left < 0.0001 {
-				break
-			}
-			right = m.LowerAdapter
-		} else {
-			left = m.LowerAdapter
-		}
-		cnt++
-	}
-
-	// adapt the upperAdapter
-	left, right = 0, m.UpperAdapter
-	cnt = 0
-	for {
-		m.UpperAdapter = (left + right) / 2
-		if adapter(m.src, m.ForecastInterval) {
-			if cnt > 40 || right-left < 0.0001 {
-				break
-			}
-			right = m.UpperAdapter
-		} else {
-			left = m.UpperAdapter
-		}
-		cnt++
-	}
-
-	return nil
+	return adaptOrFixInterval(m.params, m.src, adapter, m.ForecastInterval, &m.LowerAdapter, &m.UpperAdapter)
 }
 
 func (m *DcmpLineModel) calPeriod() {
-	pointMap, _ := ts.AggregatePeriodPoints(m.season)
+	pointMap, _ := ts.AggregatePointsByPeriod(m.season, m.Begin, m.Period)
 	m.PeriodSeaon = make(map[time.Duration]float64, len(pointMap))
 	for shift, ps := range pointMap {
 		m.PeriodSeaon[shift] = ts.AVGPoints(ps)
 	}
 
-	pointMap, _ = ts.AggregatePeriodPoints(m.trend)
+	m.ExtraSeason = make(map[time.Duration]map[time.Duration]float64, len(m.extraSeasons))
+	for period, season := range m.extraSeasons {
+		pointMap, _ := ts.AggregatePointsByPeriod(season, m.Begin, period)
+		m.ExtraSeason[period] = make(map[time.Duration]float64, len(pointMap))
+		for shift, ps := range pointMap {
+			m.ExtraSeason[period][shift] = ts.AVGPoints(ps)
+		}
+	}
+
+	m.TrendPeriod = m.Period
+	if longest := m.Periods[len(m.Periods)-1]; longest > m.Period && ts.CoverPeriod(m.trend, longest) {
+		m.TrendPeriod = longest
+	}
+	pointMap, _ = ts.AggregatePointsByPeriod(m.trend, m.Begin, m.TrendPeriod)
 	m.PeriodTrend = make(map[time.Duration]float64, len(pointMap))
 	for shift, ps := range pointMap {
-		m.PeriodTrend[shift] = ts.AVGPoints(ps)
+		if m.STL {
+			m.PeriodTrend[shift] = ps[len(ps)-1].Value()
+		} else {
+			m.PeriodTrend[shift] = ts.AVGPoints(ps)
+		}
 	}
 
 	// m.periodTrendLineA = make(map[time.Duration]float64)
@@ -213,28 +212,75 @@ func (m *DcmpLineModel) calPeriod() {
 	// 	m.periodTrendLineB[shift] = b
 	// }
 
+	randoms := m.random.Values()
+	if m.STL {
+		randoms = robustValues(randoms)
+	}
+
 	avg := 0.0
 	sum := 0.0
-	for _, v := range m.random.Values() {
+	for _, v := range randoms {
 		avg += v
 		sum += v * v
 	}
-	avg /= float64(m.random.N())
-	sum /= float64(m.random.N())
+	avg /= float64(len(randoms))
+	sum /= float64(len(randoms))
 	sd := math.Sqrt(sum)
 	m.RandomAVG = avg
 	m.RandomSD = sd
 }
 
-// Forecast .
-func (m *DcmpLineModel) Forecast(timestamp time.Time) float64 {
-	shift := ts.PeriodShift(timestamp, m.Begin, m.Period)
+// FeedLatest 用残差以指数加权的方式更新点所在位置的季节项和RandomSD;
+//  不对应训练数据中任何位置的点被忽略;
+func (m *DcmpLineModel) FeedLatest(points ts.Points) {
+	for _, p := range points {
+		shift := m.periodShift(p.Stamp(), m.Period)
+		if _, ok := m.PeriodSeaon[shift]; !ok {
+			continue
+		}
+		r := p.Value() - m.forecast(p.Stamp())
+		m.PeriodSeaon[shift] += feedWeight * r
+		m.RandomSD = feedSD(m.RandomSD, r, feedSDWeight)
+	}
+}
+
+// Clone .
+func (m *DcmpLineModel) Clone() detector.OnlineTSModel {
+	c := *m
+	c.PeriodSeaon = copyShifts(m.PeriodSeaon)
+	return &c
+}
+
+// periodShift the shift of timestamp in period, truncated to the frequency of the training data
+func (m *DcmpLineModel) periodShift(timestamp time.Time, period time.Duration) time.Duration {
+	shift := ts.PeriodShift(timestamp, m.Begin, period)
+	if m.Freq > 0 {
+		shift = shift.Truncate(m.Period / time.Duration(m.Freq))
+	}
+	return shift
+}
+
+// forecast the forecast value without the BeyoundZero limit
+func (m *DcmpLineModel) forecast(timestamp time.Time) float64 {
+	shift := m.periodShift(timestamp, m.Period)
 	// x := ts.Timestamp2X(m.src.Begin(), timestamp, m.src.Frequency())
 	// a := m.periodTrendLineA[shift]
 	// b := m.periodTrendLineB[shift]
-	t := m.PeriodTrend[shift]
+	trendPeriod := m.TrendPeriod
+	if trendPeriod == ts.UnknownOrInvalid {
+		trendPeriod = m.Period
+	}
+	t := m.PeriodTrend[m.periodShift(timestamp, trendPeriod)]
 	s := m.PeriodSeaon[shift]
-	result := t + s + m.RandomAVG
+	for period, seasons := range m.ExtraSeason {
+		s += seasons[m.periodShift(timestamp, period)]
+	}
+	return t + s + m.RandomAVG
+}
+
+// Forecast .
+func (m *DcmpLineModel) Forecast(timestamp time.Time) float64 {
+	result := m.forecast(timestamp)
 	if m.BeyoundZero && result < 0 {
 		result = 0
 	}
@@ -1,8 +1,12 @@
 package tsmodels
 
 import (
+	"math"
+	"math/rand"
 	"testing"
 	"time"
+
+	"code.byted.org/microservice/tsad/worker/ts"
 )
 
 func TestDcmpLineModelData(t *testing.T) {
@@ -42,7 +46,7 @@ func TestDcmpLineModelData(t *testing.T) {
 	}
 
 	ok(m1.Freq == m.Freq)
-	ok(m1.Begin == m.Begin)
+	ok(m1.Begin.Equal(m.Begin))
 	ok(m1.Period == m.Period)
 	ok(m1.RandomAVG == m.RandomAVG)
 	ok(m1.RandomSD == m.RandomSD)
@@ -55,3 +59,135 @@ func TestDcmpLineModelData(t *testing.T) {
 		ok(m1.PeriodSeaon[k] == m.PeriodSeaon[k])
 	}
 }
+
+func TestSTLDcmpLineModelFollowTrend(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	begin := time.Unix(1500000000, 0)
+	freq := time.Minute
+	expect := func(i int) float64 {
+		return 100 + 0.05*float64(i) + 20*math.Sin(2*math.Pi*float64(i%60)/60)
+	}
+
+	n := 60 * 6
+	ps := make(ts.Points, 0, n)
+	for i := 0; i < n; i++ {
+		if i%41 == 3 { // missing points
+			continue
+		}
+		v := expect(i) + r.NormFloat64()*0.5
+		if i%47 == 11 { // outliers
+			v += 500
+		}
+		ps = append(ps, ts.NewPoint(begin.Add(freq*time.Duration(i)), v))
+	}
+	data := ts.NewTS(ts.Attributes{Frequency: freq, Period: time.Hour}, ps)
+
+	stl := NewSTLDcmpLineModel()
+	if err := stl.Train(data, testAdapter); err != nil {
+		t.Fatal(err)
+	}
+	if stl.Name() != "STLDcmpLineModel" {
+		t.Fatalf("invalid name %v", stl.Name())
+	}
+
+	classical := NewDcmpLineModel()
+	if err := classical.Train(data, testAdapter); err != nil {
+		t.Fatal(err)
+	}
+
+	var stlErr, classicalErr float64
+	for i := n; i < n+60; i++ {
+		stamp := begin.Add(freq * time.Duration(i))
+		stlErr += math.Abs(stl.Forecast(stamp) - expect(i))
+		classicalErr += math.Abs(classical.Forecast(stamp) - expect(i))
+	}
+	if stlErr/60 > 5 || stlErr >= classicalErr {
+		t.Fatalf("stl err %v, classical err %v", stlErr/60, classicalErr/60)
+	}
+
+	buf, err := stl.ModelData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	recovered := NewDcmpLineModel()
+	if err := recovered.Recover(buf); err != nil {
+		t.Fatal(err)
+	}
+	if recovered.Name() != stl.Name() {
+		t.Fatalf("recovered name %v, expect %v", recovered.Name(), stl.Name())
+	}
+}
+
+func TestDcmpLineModelMultiPeriods(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	begin := time.Unix(1500000000, 0)
+	freq := time.Minute
+	// a "day" is 1 hour, and a "week" is 6 hours with a low "weekend" in its last hour
+	expect := func(i int) float64 {
+		v := 100 + 20*math.Sin(2*math.Pi*float64(i%60)/60)
+		if i%360 >= 300 {
+			v -= 30
+		}
+		return v
+	}
+
+	n := 360 * 3
+	ps := make(ts.Points, 0, n)
+	for i := 0; i < n; i++ {
+		ps = append(ps, ts.NewPoint(begin.Add(freq*time.Duration(i)), expect(i)+r.NormFloat64()*0.5))
+	}
+	attr := ts.Attributes{Frequency: freq, Period: time.Hour, Periods: []time.Duration{time.Hour * 6}}
+
+	for _, m := range []*DcmpLineModel{NewDcmpLineModel(), NewSTLDcmpLineModel()} {
+		if err := m.Train(ts.NewTS(attr, ps), testAdapter); err != nil {
+			t.Fatal(err)
+		}
+		if m.TrendPeriod != time.Hour*6 {
+			t.Fatalf("%v trend period %v", m.Name(), m.TrendPeriod)
+		}
+
+		var sumErr float64
+		for i := n; i < n+360; i++ {
+			sumErr += math.Abs(m.Forecast(begin.Add(freq*time.Duration(i))) - expect(i))
+		}
+		if sumErr/360 > 3 {
+			t.Fatalf("%v forecast err %v", m.Name(), sumErr/360)
+		}
+	}
+}
+
+func TestDcmpLineModelFeedLatest(t *testing.T) {
+	begin := time.Unix(1500000000, 0)
+	m := &DcmpLineModel{
+		Freq:        60,
+		Begin:       begin,
+		Period:      time.Hour,
+		PeriodTrend: make(map[time.Duration]float64),
+		PeriodSeaon: make(map[time.Duration]float64),
+		RandomSD:    1,
+	}
+	for i := 0; i < 60; i++ {
+		if i == 30 {
+			continue // a missing slot of the training data
+		}
+		m.PeriodTrend[time.Minute*time.Duration(i)] = 100
+		m.PeriodSeaon[time.Minute*time.Duration(i)] = 0
+	}
+
+	m.FeedLatest(ts.Points{
+		ts.NewPoint(begin.Add(time.Hour+time.Minute*5+time.Second*20), 110), // between the slots
+		ts.NewPoint(begin.Add(time.Hour+time.Minute*30), 110),
+	})
+	if len(m.PeriodSeaon) != 59 {
+		t.Fatalf("got %v slots, expect 59", len(m.PeriodSeaon))
+	}
+	if m.PeriodSeaon[time.Minute*5] <= 0 {
+		t.Fatalf("the season of the slot is not updated: %v", m.PeriodSeaon[time.Minute*5])
+	}
+	if _, ok := m.PeriodSeaon[time.Minute*30]; ok {
+		t.Fatal("the point of the missing slot is not ignored")
+	}
+	if f := m.Forecast(begin.Add(time.Minute*5 + time.Second*40)); f <= 100 {
+		t.Fatalf("forecast %v, expect the updated season of the slot", f)
+	}
+}
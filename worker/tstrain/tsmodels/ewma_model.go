@@ -0,0 +1,215 @@
+package tsmodels
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"code.byted.org/microservice/tsad/worker/detector"
+	"code.byted.org/microservice/tsad/worker/ts"
+)
+
+var ewmaAlphas = []float64{0.01, 0.02, 0.05, 0.1, 0.2, 0.3, 0.5, 0.7}
+
+/*
+EWMAModel .
+	指数加权移动平均, 不依赖周期, 用于周期未知的TS:
+		level(t) = alpha*x(t) + (1-alpha)*level(t-1)
+	alpha通过网格搜索, 取一步预测绝对误差之和最小的一个;
+	参数: alpha 固定平滑系数, 不再搜索; sigma;
+
+	区间的宽度使用一步预测误差的MAD(median absolute deviation)估计, 以降低离群点的影响:
+		sigma = 1.4826 * median(|err - median(err)|)
+
+	则对训练数据之后的点x:
+		expt: level
+		upper: expt + UpperAdapter*sigma
+		lower: expt - LowerAdapter*sigma
+*/
+type EWMAModel struct {
+	src    ts.TS
+	params map[string]float64
+	fitted []float64 // one-step forecasts of the training data, used to evaluate this model
+
+	Alpha float64
+
+	Frequency time.Duration
+	Begin     time.Time
+	End       time.Time
+
+	Level float64
+	Sigma float64
+
+	LowerAdapter float64
+	UpperAdapter float64
+
+	BeyoundZero bool
+}
+
+// NewEWMAModel .
+func NewEWMAModel() *EWMAModel {
+	return &EWMAModel{}
+}
+
+// Name .
+func (m *EWMAModel) Name() string {
+	return "EWMAModel"
+}
+
+// ModelData .
+func (m *EWMAModel) ModelData() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+// Recover .
+func (m *EWMAModel) Recover(data []byte) error {
+	var model EWMAModel
+	if err := json.Unmarshal(data, &model); err != nil {
+		return err
+	}
+	if model.Frequency == ts.UnknownOrInvalid || model.Alpha <= 0 {
+		return fmt.Errorf("invalid model data")
+	}
+	*m = model
+	return nil
+}
+
+// SetParams .
+func (m *EWMAModel) SetParams(params map[string]float64) error {
+	if err := checkParams(params, []string{"alpha"}, []string{"alpha"}); err != nil {
+		return err
+	}
+	m.params = params
+	return nil
+}
+
+// Train .
+func (m *EWMAModel) Train(data ts.TS, adapter detector.ModelAdapter) error {
+	if data.Frequency() == ts.UnknownOrInvalid {
+		return fmt.Errorf("no frequency")
+	}
+	if !data.Completed() {
+		data = ts.LastValueComplete(data)
+	}
+	if data.N() < 3 {
+		return fmt.Errorf("too few points: %v", data.N())
+	}
+
+	m.src = data
+	m.BeyoundZero = beyoundZero(data)
+	m.Frequency = data.Frequency()
+	m.Begin = data.Begin()
+	m.End = data.End()
+
+	vals := data.Values()
+	bestErr := math.Inf(1)
+	for _, alpha := range paramOrGrid(m.params, "alpha", ewmaAlphas) {
+		_, errSum := ewmaSmooth(vals, alpha, nil)
+		if errSum < bestErr {
+			bestErr = errSum
+			m.Alpha = alpha
+		}
+	}
+
+	m.fitted = make([]float64, len(vals))
+	m.Level, _ = ewmaSmooth(vals, m.Alpha, m.fitted)
+
+	errs := make([]float64, 0, len(vals)-1)
+	for i := 1; i < len(vals); i++ {
+		errs = append(errs, vals[i]-m.fitted[i])
+	}
+	m.Sigma = 1.4826 * mad(errs)
+	if m.Sigma == 0 {
+		m.Sigma = ts.SD(errs)
+	}
+
+	if err := adaptOrFixInterval(m.params, m.src, adapter, m.ForecastInterval, &m.LowerAdapter, &m.UpperAdapter); err != nil {
+		return fmt.Errorf("adapt err: %v", err)
+	}
+
+	m.src = nil // to save the memory
+	return nil
+}
+
+// FeedLatest 继续做指数平滑, 并以指数加权的方式更新Sigma;
+func (m *EWMAModel) FeedLatest(points ts.Points) {
+	for _, p := range points {
+		if !p.Stamp().After(m.End) {
+			continue
+		}
+		r := p.Value() - m.Level
+		m.Sigma = feedSD(m.Sigma, r, feedSDWeight)
+		m.Level = m.Alpha*p.Value() + (1-m.Alpha)*m.Level
+		m.End = p.Stamp()
+	}
+}
+
+// Clone .
+func (m *EWMAModel) Clone() detector.OnlineTSModel {
+	c := *m
+	return &c
+}
+
+// ewmaSmooth 对vals做一次指数平滑, 返回最终的level和一步预测绝对误差之和;
+//  如果fitted不为nil, 将一步预测值写入fitted;
+func ewmaSmooth(vals []float64, alpha float64, fitted []float64) (level, errSum float64) {
+	level = vals[0]
+	if fitted != nil {
+		fitted[0] = vals[0]
+	}
+	for i := 1; i < len(vals); i++ {
+		if fitted != nil {
+			fitted[i] = level
+		}
+		errSum += math.Abs(vals[i] - level)
+		level = alpha*vals[i] + (1-alpha)*level
+	}
+	return
+}
+
+// mad median absolute deviation
+func mad(vals []float64) float64 {
+	if len(vals) == 0 {
+		return 0
+	}
+	sorted := make([]float64, len(vals))
+	copy(sorted, vals)
+	median := ts.PercentThreshold(sorted, 0.5)
+
+	devs := make([]float64, 0, len(vals))
+	for _, v := range vals {
+		devs = append(devs, math.Abs(v-median))
+	}
+	return ts.PercentThreshold(devs, 0.5)
+}
+
+// Forecast .
+func (m *EWMAModel) Forecast(timestamp time.Time) float64 {
+	result := m.Level
+	if !timestamp.After(m.End) {
+		idx := int(timestamp.Sub(m.Begin) / m.Frequency)
+		if idx >= 0 && idx < len(m.fitted) {
+			result = m.fitted[idx]
+		}
+	}
+
+	if m.BeyoundZero && result < 0 {
+		result = 0
+	}
+	return result
+}
+
+// ForecastInterval .
+func (m *EWMAModel) ForecastInterval(timestamp time.Time) (lower, upper float64) {
+	v := m.Forecast(timestamp)
+	lower = v - m.LowerAdapter*m.Sigma
+	upper = v + m.UpperAdapter*m.Sigma
+	if m.BeyoundZero && lower < 0 {
+		lower = 0
+	}
+	if m.BeyoundZero && upper < 0 {
+		upper = 0
+	}
+	return
+}
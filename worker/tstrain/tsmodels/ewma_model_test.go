@@ -0,0 +1,92 @@
+package tsmodels
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"code.byted.org/microservice/tsad/worker/ts"
+)
+
+func TestEWMAModelLevelShift(t *testing.T) {
+	begin := time.Unix(1500000000, 0)
+	freq := time.Second * 30
+	n := 2880
+	data := genLineTS(begin, freq, n, 0)
+
+	// shift the level of the last hour
+	ps := make(ts.Points, 0, n)
+	for i, p := range data.Points() {
+		v := p.Value()
+		if i >= n-120 {
+			v += 50
+		}
+		ps = append(ps, ts.NewPoint(p.Stamp(), v))
+	}
+	data = ts.NewTS(data.Attributes(), ps)
+
+	m := NewEWMAModel()
+	if err := m.Train(data, testAdapter); err != nil {
+		t.Fatal(err)
+	}
+	if m.Sigma > 3 {
+		t.Fatalf("sigma %v is influenced by the outliers", m.Sigma)
+	}
+
+	stamp := data.End().Add(freq)
+	if f := m.Forecast(stamp); math.Abs(f-150) > 5 {
+		t.Fatalf("forecast %v, expect the shifted level 150", f)
+	}
+	lower, upper := m.ForecastInterval(stamp)
+	if lower > 150 || upper < 150 {
+		t.Fatalf("150 not in [%v, %v]", lower, upper)
+	}
+
+	buf, err := m.ModelData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1 := &EWMAModel{}
+	if err := m1.Recover(buf); err != nil {
+		t.Fatal(err)
+	}
+	l1, u1 := m1.ForecastInterval(stamp)
+	if l1 != lower || u1 != upper {
+		t.Fatalf("recovered model forecast [%v, %v], expect [%v, %v]", l1, u1, lower, upper)
+	}
+}
+
+func TestEWMAModelNoFrequency(t *testing.T) {
+	data := ts.NewTS(ts.Attributes{Frequency: ts.UnknownOrInvalid}, ts.Points{ts.NewPoint(time.Unix(0, 0), 1)})
+	if err := NewEWMAModel().Train(data, testAdapter); err == nil {
+		t.Fatal("expect err")
+	}
+}
+
+func TestEWMAModelFeedLatest(t *testing.T) {
+	begin := time.Unix(1500000000, 0)
+	freq := time.Second * 30
+	n := 2880
+	data := genLineTS(begin, freq, n, 0)
+
+	m := NewEWMAModel()
+	if err := m.Train(data, testAdapter); err != nil {
+		t.Fatal(err)
+	}
+
+	// the level is shifted after training
+	ps := make(ts.Points, 0, 120)
+	for i := 1; i <= 120; i++ {
+		ps = append(ps, ts.NewPoint(data.End().Add(freq*time.Duration(i)), 150))
+	}
+	m.FeedLatest(ps)
+	m.FeedLatest(ps) // fed twice should be ignored
+
+	stamp := ps[len(ps)-1].Stamp().Add(freq)
+	if f := m.Forecast(stamp); f < 120 {
+		t.Fatalf("forecast %v, expect following the shifted level 150", f)
+	}
+	if !m.End.Equal(ps[len(ps)-1].Stamp()) {
+		t.Fatalf("end %v, expect %v", m.End, ps[len(ps)-1].Stamp())
+	}
+}
@@ -0,0 +1,284 @@
+package tsmodels
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"code.byted.org/microservice/tsad/worker/detector"
+	"code.byted.org/microservice/tsad/worker/ts"
+)
+
+var (
+	hwAlphas = []float64{0.05, 0.1, 0.2, 0.3, 0.5, 0.7, 0.9}
+	hwBetas  = []float64{0, 0.01, 0.05, 0.1}
+	hwGammas = []float64{0.05, 0.1, 0.2, 0.3, 0.5}
+)
+
+/*
+HoltWintersModel .
+	加法Holt-Winters三次指数平滑(带阻尼趋势);
+	对level, trend, season分别做指数平滑:
+		level(t)  = alpha*(x(t) - season(t-m)) + (1-alpha)*(level(t-1) + phi*trend(t-1))
+		trend(t)  = beta*(level(t) - level(t-1)) + (1-beta)*phi*trend(t-1)
+		season(t) = gamma*(x(t) - level(t)) + (1-gamma)*season(t-m)
+	alpha, beta, gamma通过网格搜索, 取一步预测误差平方和最小的一组;
+	参数: alpha, beta, gamma 固定平滑系数, 不再搜索; phi 阻尼系数, 默认0.98; sigma;
+
+	则对训练数据之后h步的点x, 预测为:
+		expt: level + (phi + phi^2 + ... + phi^h)*trend + season(x)
+		upper: expt + UpperAdapter*rsd
+		lower: expt - LowerAdapter*rsd
+	rsd为训练数据上一步预测误差的标准差;
+	相对于DcmpLineModel, 该模型使用训练结束时的level, 可以跟随level的变化;
+*/
+type HoltWintersModel struct {
+	src    ts.TS
+	params map[string]float64
+	fitted []float64 // one-step forecasts of the training data, used to evaluate this model
+
+	Alpha float64
+	Beta  float64
+	Gamma float64
+	Phi   float64 // damping factor of the trend
+
+	Frequency time.Duration
+	Period    time.Duration
+	Begin     time.Time
+	End       time.Time
+
+	Level  float64
+	Trend  float64
+	Season []float64 // indexed by PeriodShift(stamp, Begin, Period) / Frequency
+
+	RandomSD     float64
+	LowerAdapter float64
+	UpperAdapter float64
+
+	BeyoundZero bool
+}
+
+// NewHoltWintersModel .
+func NewHoltWintersModel() *HoltWintersModel {
+	return &HoltWintersModel{
+		Phi: 0.98,
+	}
+}
+
+// Name .
+func (m *HoltWintersModel) Name() string {
+	return "HoltWintersModel"
+}
+
+// ModelData .
+func (m *HoltWintersModel) ModelData() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+// Recover .
+func (m *HoltWintersModel) Recover(data []byte) error {
+	var model HoltWintersModel
+	if err := json.Unmarshal(data, &model); err != nil {
+		return err
+	}
+	if model.Frequency == ts.UnknownOrInvalid || len(model.Season) == 0 {
+		return fmt.Errorf("invalid model data")
+	}
+	*m = model
+	return nil
+}
+
+// SetParams .
+func (m *HoltWintersModel) SetParams(params map[string]float64) error {
+	if err := checkParams(params, []string{"alpha", "beta", "gamma", "phi"}, []string{"alpha", "beta", "gamma", "phi"}); err != nil {
+		return err
+	}
+	m.params = params
+	return nil
+}
+
+// Train .
+func (m *HoltWintersModel) Train(data ts.TS, adapter detector.ModelAdapter) error {
+	if data.Period() == ts.UnknownOrInvalid {
+		return fmt.Errorf("no period")
+	}
+	if data.Frequency() == ts.UnknownOrInvalid {
+		return fmt.Errorf("no frequency")
+	}
+	if !data.Completed() {
+		data = ts.LastValueComplete(data)
+	}
+
+	slots := int(data.Period() / data.Frequency())
+	if slots < 2 {
+		return fmt.Errorf("period %v is too short for frequency %v", data.Period(), data.Frequency())
+	}
+	if data.N() < 2*slots {
+		return fmt.Errorf("need at least two periods, got %v points for %v slots", data.N(), slots)
+	}
+
+	m.src = data
+	m.BeyoundZero = beyoundZero(data)
+	m.Frequency = data.Frequency()
+	m.Period = data.Period()
+	m.Begin = data.Begin()
+	m.End = data.End()
+
+	if phi, ok := m.params["phi"]; ok {
+		m.Phi = phi
+	}
+
+	vals := data.Values()
+	bestSSE := math.Inf(1)
+	for _, alpha := range paramOrGrid(m.params, "alpha", hwAlphas) {
+		for _, beta := range paramOrGrid(m.params, "beta", hwBetas) {
+			for _, gamma := range paramOrGrid(m.params, "gamma", hwGammas) {
+				sse := hwSmooth(vals, slots, alpha, beta, gamma, m.Phi, nil).sse
+				if sse < bestSSE {
+					bestSSE = sse
+					m.Alpha, m.Beta, m.Gamma = alpha, beta, gamma
+				}
+			}
+		}
+	}
+
+	m.fitted = make([]float64, len(vals))
+	st := hwSmooth(vals, slots, m.Alpha, m.Beta, m.Gamma, m.Phi, m.fitted)
+	m.Level = st.level
+	m.Trend = st.trend
+	m.Season = st.season
+	m.RandomSD = math.Sqrt(st.sse / float64(len(vals)-slots))
+
+	if err := adaptOrFixInterval(m.params, m.src, adapter, m.ForecastInterval, &m.LowerAdapter, &m.UpperAdapter); err != nil {
+		return fmt.Errorf("adapt err: %v", err)
+	}
+
+	m.src = nil // to save the memory
+	return nil
+}
+
+// FeedLatest 对新的点继续做三次指数平滑, 并以指数加权的方式更新RandomSD;
+//  缺失的点只按阻尼趋势推进level;
+func (m *HoltWintersModel) FeedLatest(points ts.Points) {
+	for _, p := range points {
+		if !p.Stamp().After(m.End) {
+			continue
+		}
+		for missing := int(p.Stamp().Sub(m.End)/m.Frequency) - 1; missing > 0; missing-- {
+			m.Level += m.Phi * m.Trend
+			m.Trend *= m.Phi
+		}
+
+		slot := m.slot(p.Stamp())
+		expt := m.Level + m.Phi*m.Trend + m.Season[slot]
+		m.RandomSD = feedSD(m.RandomSD, p.Value()-expt, feedSDWeight)
+
+		level := m.Alpha*(p.Value()-m.Season[slot]) + (1-m.Alpha)*(m.Level+m.Phi*m.Trend)
+		m.Trend = m.Beta*(level-m.Level) + (1-m.Beta)*m.Phi*m.Trend
+		m.Season[slot] = m.Gamma*(p.Value()-level) + (1-m.Gamma)*m.Season[slot]
+		m.Level = level
+		m.End = p.Stamp()
+	}
+}
+
+// Clone .
+func (m *HoltWintersModel) Clone() detector.OnlineTSModel {
+	c := *m
+	c.Season = copyFloats(m.Season)
+	return &c
+}
+
+type hwState struct {
+	level  float64
+	trend  float64
+	season []float64
+	sse    float64
+}
+
+// hwSmooth 对vals做一次三次指数平滑, 如果fitted不为nil, 将一步预测值写入fitted;
+func hwSmooth(vals []float64, slots int, alpha, beta, gamma, phi float64, fitted []float64) hwState {
+	first := ts.AVG(vals[:slots])
+	second := ts.AVG(vals[slots : 2*slots])
+
+	st := hwState{
+		level:  first,
+		trend:  (second - first) / float64(slots),
+		season: make([]float64, slots),
+	}
+	for i := 0; i < slots; i++ {
+		st.season[i] = vals[i] - first
+		if fitted != nil {
+			fitted[i] = vals[i]
+		}
+	}
+
+	for i := slots; i < len(vals); i++ {
+		slot := i % slots
+		expt := st.level + phi*st.trend + st.season[slot]
+		if fitted != nil {
+			fitted[i] = expt
+		}
+		diff := vals[i] - expt
+		st.sse += diff * diff
+
+		level := alpha*(vals[i]-st.season[slot]) + (1-alpha)*(st.level+phi*st.trend)
+		st.trend = beta*(level-st.level) + (1-beta)*phi*st.trend
+		st.season[slot] = gamma*(vals[i]-level) + (1-gamma)*st.season[slot]
+		st.level = level
+	}
+
+	return st
+}
+
+func (m *HoltWintersModel) slot(timestamp time.Time) int {
+	return int(ts.PeriodShift(timestamp, m.Begin, m.Period)/m.Frequency) % len(m.Season)
+}
+
+// dampedSum phi + phi^2 + ... + phi^h
+func (m *HoltWintersModel) dampedSum(h int) float64 {
+	if m.Phi >= 1 {
+		return float64(h)
+	}
+	return m.Phi * (1 - math.Pow(m.Phi, float64(h))) / (1 - m.Phi)
+}
+
+// Forecast .
+func (m *HoltWintersModel) Forecast(timestamp time.Time) float64 {
+	var result float64
+	if !timestamp.After(m.End) {
+		idx := int(timestamp.Sub(m.Begin) / m.Frequency)
+		if idx >= 0 && idx < len(m.fitted) {
+			result = m.fitted[idx]
+		} else {
+			result = m.Level + m.Season[m.slot(timestamp)]
+		}
+	} else {
+		h := int(timestamp.Sub(m.End) / m.Frequency)
+		result = m.Level + m.dampedSum(h)*m.Trend + m.Season[m.slot(timestamp)]
+	}
+
+	if m.BeyoundZero && result < 0 {
+		result = 0
+	}
+	return result
+}
+
+// ForecastInterval .
+func (m *HoltWintersModel) ForecastInterval(timestamp time.Time) (lower, upper float64) {
+	v := m.Forecast(timestamp)
+	lower = v - m.LowerAdapter*m.RandomSD
+	upper = v + m.UpperAdapter*m.RandomSD
+	if m.BeyoundZero && lower < 0 {
+		lower = 0
+	}
+	if m.BeyoundZero && upper < 0 {
+		upper = 0
+	}
+
+	if lower == upper {
+		upper += ((m.UpperAdapter + m.LowerAdapter) * m.RandomSD)
+	}
+
+	return
+}
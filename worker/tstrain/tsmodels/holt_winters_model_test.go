@@ -0,0 +1,157 @@
+package tsmodels
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"code.byted.org/microservice/tsad/worker/ts"
+)
+
+func testAdapter(data ts.TS, forecast func(timestamp time.Time) (lower, upper float64)) bool {
+	errCnt := 0
+	for _, p := range data.Points() {
+		l, u := forecast(p.Stamp())
+		if p.Value() < l || p.Value() > u {
+			errCnt++
+		}
+	}
+	return float64(errCnt)/float64(data.N()) <= 0.001
+}
+
+// genSeasonTS generate a ts with daily-like season, the level of the last period is shifted
+func genSeasonTS(begin time.Time, freq, period time.Duration, periods int, shift float64) ts.TS {
+	r := rand.New(rand.NewSource(1))
+	slots := int(period / freq)
+	ps := make(ts.Points, 0, slots*periods)
+	for i := 0; i < slots*periods; i++ {
+		v := 100 + 20*math.Sin(2*math.Pi*float64(i%slots)/float64(slots)) + r.NormFloat64()
+		if i >= slots*(periods-1) {
+			v += shift
+		}
+		ps = append(ps, ts.NewPoint(begin.Add(freq*time.Duration(i)), v))
+	}
+	return ts.NewTS(ts.Attributes{Frequency: freq, Period: period}, ps)
+}
+
+func TestHoltWintersModelLevelShift(t *testing.T) {
+	begin := time.Unix(1500000000, 0)
+	freq := time.Minute
+	period := time.Hour
+	data := genSeasonTS(begin, freq, period, 6, 30)
+
+	m := NewHoltWintersModel()
+	if err := m.Train(data, testAdapter); err != nil {
+		t.Fatal(err)
+	}
+
+	// the next period should follow the shifted level
+	for i := 1; i <= 60; i++ {
+		stamp := data.End().Add(freq * time.Duration(i))
+		slot := int(stamp.Sub(begin)/freq) % 60
+		expt := 130 + 20*math.Sin(2*math.Pi*float64(slot)/60)
+		if f := m.Forecast(stamp); math.Abs(f-expt) > 6 {
+			t.Fatalf("forecast %v at %v, expect %v", f, stamp, expt)
+		}
+		lower, upper := m.ForecastInterval(stamp)
+		if lower > expt || upper < expt {
+			t.Fatalf("%v not in [%v, %v]", expt, lower, upper)
+		}
+	}
+}
+
+func TestHoltWintersModelTooShort(t *testing.T) {
+	data := genSeasonTS(time.Unix(1500000000, 0), time.Minute, time.Hour, 1, 0)
+	if err := NewHoltWintersModel().Train(data, testAdapter); err == nil {
+		t.Fatal("expect err for less than two periods")
+	}
+}
+
+func TestHoltWintersModelData(t *testing.T) {
+	begin := time.Unix(1500000000, 0)
+	data := genSeasonTS(begin, time.Minute, time.Hour, 4, 0)
+	m := NewHoltWintersModel()
+	if err := m.Train(data, testAdapter); err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := m.ModelData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1 := &HoltWintersModel{}
+	if err := m1.Recover(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 120; i++ {
+		stamp := data.End().Add(time.Minute * time.Duration(i))
+		l, u := m.ForecastInterval(stamp)
+		l1, u1 := m1.ForecastInterval(stamp)
+		if l != l1 || u != u1 {
+			t.Fatalf("recovered model forecast [%v, %v], expect [%v, %v]", l1, u1, l, u)
+		}
+	}
+
+	if err := m1.Recover([]byte("{}")); err == nil {
+		t.Fatal("expect err for empty model data")
+	}
+}
+
+func TestHoltWintersModelParams(t *testing.T) {
+	data := genSeasonTS(time.Unix(1500000000, 0), time.Minute, time.Hour, 4, 0)
+	m := NewHoltWintersModel()
+	if err := m.SetParams(map[string]float64{"alpha": 0.3, "phi": 1, "sigma": 5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Train(data, testAdapter); err != nil {
+		t.Fatal(err)
+	}
+	if m.Alpha != 0.3 || m.Phi != 1 || m.LowerAdapter != 5 || m.UpperAdapter != 5 {
+		t.Fatalf("params are not used: alpha=%v, phi=%v, adapters=%v, %v", m.Alpha, m.Phi, m.LowerAdapter, m.UpperAdapter)
+	}
+
+	if err := m.SetParams(map[string]float64{"max_bad_per": 0.1}); err == nil {
+		t.Fatal("expect err for unsupported param")
+	}
+}
+
+func TestHoltWintersModelFeedLatest(t *testing.T) {
+	begin := time.Unix(1500000000, 0)
+	freq := time.Minute
+	period := time.Hour
+	data := genSeasonTS(begin, freq, period, 7, 30)
+	train := ts.NewTS(data.Attributes(), data.Points()[:6*60])
+
+	m := NewHoltWintersModel()
+	if err := m.Train(train, testAdapter); err != nil {
+		t.Fatal(err)
+	}
+	stamp := data.End().Add(freq)
+	before := m.Forecast(stamp)
+
+	// feed the shifted period in the check windows
+	latest := data.Points()[6*60:]
+	for i := 0; i < len(latest); i += 5 {
+		m.FeedLatest(latest[i : i+5])
+	}
+
+	expt := 130 + 20*math.Sin(2*math.Pi*float64(int(stamp.Sub(begin)/freq)%60)/60)
+	after := m.Forecast(stamp)
+	if math.Abs(after-expt) >= math.Abs(before-expt) || math.Abs(after-expt) > 10 {
+		t.Fatalf("forecast %v after feeding, %v before, expect %v", after, before, expt)
+	}
+
+	buf, err := m.ModelData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1 := NewHoltWintersModel()
+	if err := m1.Recover(buf); err != nil {
+		t.Fatal(err)
+	}
+	if f := m1.Forecast(stamp); f != after {
+		t.Fatalf("recovered model forecast %v, expect %v", f, after)
+	}
+}
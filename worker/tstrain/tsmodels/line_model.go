@@ -1,20 +1,39 @@
 package tsmodels
 
 import (
+	"encoding/json"
+	"fmt"
 	"time"
 
+	"code.byted.org/microservice/tsad/worker/detector"
 	"code.byted.org/microservice/tsad/worker/ts"
 )
 
 /*
 LineModel 直接将数据当做一条直线, 利用PerTrichotomyFit去拟合;
+	不依赖周期, 可用于周期未知的TS;
+	参数: max_bad_per 拟合时忽略的点的比例, 默认0.1; sigma;
+
+	则对于任意点x:
+		expt: A*x + B
+		upper: expt + UpperAdapter*SD
+		lower: expt - LowerAdapter*SD
+	x为距离Begin的秒数, SD为拟合最好的90%的点的标准差;
 */
 type LineModel struct {
-	src ts.TS
-	// y = ax + b
-	a  float64
-	b  float64
-	sd float64 // Standard Deviation
+	src    ts.TS
+	params map[string]float64
+
+	// y = Ax + B
+	A     float64
+	B     float64
+	SD    float64 // Standard Deviation
+	Begin time.Time
+
+	LowerAdapter float64
+	UpperAdapter float64
+
+	BeyoundZero bool
 }
 
 // NewLineModel .
@@ -27,38 +46,98 @@ func (lm *LineModel) Name() string {
 	return "LineModel"
 }
 
-// SourceData .
-func (lm *LineModel) SourceData() ts.TS {
-	return lm.src
+// ModelData .
+func (lm *LineModel) ModelData() ([]byte, error) {
+	return json.Marshal(lm)
+}
+
+// Recover .
+func (lm *LineModel) Recover(data []byte) error {
+	var model LineModel
+	if err := json.Unmarshal(data, &model); err != nil {
+		return err
+	}
+	if model.Begin.IsZero() {
+		return fmt.Errorf("invalid model data")
+	}
+	*lm = model
+	return nil
+}
+
+// SetParams .
+func (lm *LineModel) SetParams(params map[string]float64) error {
+	if err := checkParams(params, []string{"max_bad_per"}, []string{"max_bad_per"}); err != nil {
+		return err
+	}
+	if params["max_bad_per"] >= 1 {
+		return fmt.Errorf("max_bad_per should be less than 1")
+	}
+	lm.params = params
+	return nil
 }
 
 // Train .
-func (lm *LineModel) Train(data ts.TS) error {
+func (lm *LineModel) Train(data ts.TS, adapter detector.ModelAdapter) error {
+	if data.N() < 3 {
+		return fmt.Errorf("too few points: %v", data.N())
+	}
+
 	lm.src = data
-	XYPoints := ts.Points2XYPoints(lm.src.Points(), data.Begin(), time.Second)
-	lm.a, lm.b, lm.sd = ts.PerTrichotomyFit(XYPoints, &ts.PerTrichotomyFitOp{
-		MaxBadPer:        0.1,
+	lm.Begin = data.Begin()
+	lm.BeyoundZero = beyoundZero(data)
+
+	XYPoints := ts.Points2XYPoints(data.Points(), lm.Begin, time.Second)
+	lm.A, lm.B, lm.SD = robustLineFit(XYPoints, &ts.PerTrichotomyFitOp{
+		MaxBadPer:        paramOr(lm.params, "max_bad_per", 0.1),
 		AngleIntervalNum: 10,
 		AErr:             0.01,
 		BErr:             0.01,
 	})
+
+	if err := adaptOrFixInterval(lm.params, lm.src, adapter, lm.ForecastInterval, &lm.LowerAdapter, &lm.UpperAdapter); err != nil {
+		return fmt.Errorf("adapt err: %v", err)
+	}
+
+	lm.src = nil // to save the memory
 	return nil
 }
 
 // Forecast .
 func (lm *LineModel) Forecast(stamp time.Time) float64 {
-	x := ts.Timestamp2X(stamp, lm.src.Begin(), time.Second)
-	y := lm.a*x + lm.b
+	x := ts.Timestamp2X(lm.Begin, stamp, time.Second)
+	y := lm.A*x + lm.B
+	if lm.BeyoundZero && y < 0 {
+		y = 0
+	}
 	return y
 }
 
 // ForecastInterval .
-func (lm *LineModel) ForecastInterval(stamp time.Time) (float64, float64) {
+func (lm *LineModel) ForecastInterval(stamp time.Time) (lower, upper float64) {
 	forecastY := lm.Forecast(stamp)
-	return forecastY - (3 * lm.sd), forecastY + (3 * lm.sd)
+	lower = forecastY - lm.LowerAdapter*lm.SD
+	upper = forecastY + lm.UpperAdapter*lm.SD
+	if lm.BeyoundZero && lower < 0 {
+		lower = 0
+	}
+	if lm.BeyoundZero && upper < 0 {
+		upper = 0
+	}
+	return
 }
 
-// FeedLatest .
+// FeedLatest 用残差以指数加权的方式更新B和SD, 斜率保持不变;
 func (lm *LineModel) FeedLatest(points ts.Points) {
-	// TODO(zhangyuanjia)
+	for _, p := range points {
+		x := ts.Timestamp2X(lm.Begin, p.Stamp(), time.Second)
+		r := p.Value() - (lm.A*x + lm.B)
+		lm.B += feedSDWeight * r
+		lm.SD = feedSD(lm.SD, r, feedSDWeight)
+	}
+}
+
+// Clone .
+func (lm *LineModel) Clone() detector.OnlineTSModel {
+	c := *lm
+	return &c
 }
@@ -0,0 +1,64 @@
+package tsmodels
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"code.byted.org/microservice/tsad/worker/ts"
+)
+
+// genLineTS generate an aperiodic ts: y = 100 + slope*i + noise, with some outliers
+func genLineTS(begin time.Time, freq time.Duration, n int, slope float64) ts.TS {
+	r := rand.New(rand.NewSource(1))
+	ps := make(ts.Points, 0, n)
+	for i := 0; i < n; i++ {
+		v := 100 + slope*float64(i) + r.NormFloat64()
+		if i%97 == 3 {
+			v += 200
+		}
+		ps = append(ps, ts.NewPoint(begin.Add(freq*time.Duration(i)), v))
+	}
+	return ts.NewTS(ts.Attributes{Frequency: freq, Period: ts.UnknownOrInvalid}, ps)
+}
+
+func TestLineModel(t *testing.T) {
+	begin := time.Unix(1500000000, 0)
+	freq := time.Second * 30
+	n := 2880 * 2
+	data := genLineTS(begin, freq, n, 0.01)
+
+	m := NewLineModel()
+	if err := m.Train(data, testAdapter); err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(m.SD-1) > 0.3 {
+		t.Fatalf("sd %v is influenced by the outliers", m.SD)
+	}
+
+	for i := n; i < n+120; i++ {
+		stamp := begin.Add(freq * time.Duration(i))
+		expt := 100 + 0.01*float64(i)
+		if f := m.Forecast(stamp); math.Abs(f-expt) > 1 {
+			t.Fatalf("forecast %v at %v, expect %v", f, i, expt)
+		}
+		lower, upper := m.ForecastInterval(stamp)
+		if lower > expt || upper < expt {
+			t.Fatalf("%v not in [%v, %v]", expt, lower, upper)
+		}
+	}
+
+	buf, err := m.ModelData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1 := &LineModel{}
+	if err := m1.Recover(buf); err != nil {
+		t.Fatal(err)
+	}
+	stamp := data.End().Add(time.Hour)
+	if m.Forecast(stamp) != m1.Forecast(stamp) {
+		t.Fatalf("recovered model forecast %v, expect %v", m1.Forecast(stamp), m.Forecast(stamp))
+	}
+}
@@ -1,29 +1,46 @@
 package tsmodels
 
 import (
+	"encoding/json"
 	"fmt"
+	"math"
+	"sort"
 	"time"
 
+	"code.byted.org/microservice/tsad/worker/detector"
 	"code.byted.org/microservice/tsad/worker/ts"
 )
 
 /*
 Period3SigmaModel .
-	选取各个中期中, 同位置的点, 形成一系列的子序列, subTS;
+	选取各个周期中, 同位置的点, 形成一系列的子序列, subTS;
 	对于每个subTS, 分别做线性拟合, 得到一次方程F;
-	利用MinKSDValues和F, 得到subTS中拟合最好的一些点, 设这些点为bestSubTS;
-
-	则, 对于任意点p, 设其同位置bestSubTS得到的均值和方差为avg, sd;
-	expect = avg
-	upper = avg + 3*sd
-	lower = avg - 3*sd
+	利用PerTrichotomyFit和F, 得到subTS中拟合最好的一些点, 设这些点为bestSubTS;
+
+	则, 对于任意点p, 设其同位置的F和bestSubTS的标准差为sd;
+	expect = F(p)
+	upper = expect + UpperAdapter*sd
+	lower = expect - LowerAdapter*sd
+	F的x为距离Begin的周期数;
+	为了避免某些位置的点恰好相同使区间宽度为0, sd不小于所有位置sd的中位数;
+	参数: max_bad_per 拟合时忽略的点的比例, 默认0.1; sigma;
 */
 type Period3SigmaModel struct {
-	src       ts.TS
-	periodAs  map[time.Duration]float64 // 所有周期同位置拟合后的斜率
-	periodBs  map[time.Duration]float64 // 所有周期同位置拟合后的常数
-	periodSDs map[time.Duration]float64 // 所有周期同位置点标准差
-	positions []time.Duration
+	src    ts.TS
+	params map[string]float64
+
+	Begin     time.Time
+	Period    time.Duration
+	PeriodAs  map[time.Duration]float64 // 所有周期同位置拟合后的斜率
+	PeriodBs  map[time.Duration]float64 // 所有周期同位置拟合后的常数
+	PeriodSDs map[time.Duration]float64 // 所有周期同位置点标准差
+	MinSD     float64                   // 所有位置sd的中位数
+	Positions []time.Duration           // sorted
+
+	LowerAdapter float64
+	UpperAdapter float64
+
+	BeyoundZero bool
 }
 
 // NewPeriod3SigmaModel .
@@ -36,86 +53,152 @@ func (snm *Period3SigmaModel) Name() string {
 	return "Period3SigmaModel"
 }
 
-// SourceData .
-func (snm *Period3SigmaModel) SourceData() ts.TS {
-	return snm.src
+// ModelData .
+func (snm *Period3SigmaModel) ModelData() ([]byte, error) {
+	return json.Marshal(snm)
+}
+
+// Recover .
+func (snm *Period3SigmaModel) Recover(data []byte) error {
+	var model Period3SigmaModel
+	if err := json.Unmarshal(data, &model); err != nil {
+		return err
+	}
+	if model.Period == ts.UnknownOrInvalid || len(model.Positions) == 0 {
+		return fmt.Errorf("invalid model data")
+	}
+	*snm = model
+	return nil
+}
+
+// SetParams .
+func (snm *Period3SigmaModel) SetParams(params map[string]float64) error {
+	if err := checkParams(params, []string{"max_bad_per"}, []string{"max_bad_per"}); err != nil {
+		return err
+	}
+	if params["max_bad_per"] >= 1 {
+		return fmt.Errorf("max_bad_per should be less than 1")
+	}
+	snm.params = params
+	return nil
 }
 
 // Train .
-func (snm *Period3SigmaModel) Train(data ts.TS) error {
+func (snm *Period3SigmaModel) Train(data ts.TS, adapter detector.ModelAdapter) error {
+	if data.Period() == ts.UnknownOrInvalid {
+		return fmt.Errorf("no period")
+	}
+	if data.End().Sub(data.Begin()) < 2*data.Period() {
+		return fmt.Errorf("need at least two periods")
+	}
+
 	periodPoints, err := ts.AggregatePeriodPoints(data)
 	if err != nil {
 		return fmt.Errorf("AggregatePeriodPoints err: %v", err)
 	}
 
 	snm.src = data
-	snm.periodAs = make(map[time.Duration]float64)
-	snm.periodBs = make(map[time.Duration]float64)
-	snm.periodSDs = make(map[time.Duration]float64)
-	snm.positions = make([]time.Duration, 0, len(periodPoints))
+	snm.Begin = data.Begin()
+	snm.Period = data.Period()
+	snm.BeyoundZero = beyoundZero(data)
+	snm.PeriodAs = make(map[time.Duration]float64)
+	snm.PeriodBs = make(map[time.Duration]float64)
+	snm.PeriodSDs = make(map[time.Duration]float64)
+	snm.Positions = make([]time.Duration, 0, len(periodPoints))
+	sds := make([]float64, 0, len(periodPoints))
 	for shift, points := range periodPoints {
-		xyPoints := ts.Points2XYPoints(points, data.Begin(), time.Second)
-		a, b, sd := ts.PerTrichotomyFit(xyPoints, &ts.PerTrichotomyFitOp{
-			MaxBadPer:        0.1,
+		xyPoints := ts.Points2XYPoints(points, snm.Begin, snm.Period)
+		a, b, sd := robustLineFit(xyPoints, &ts.PerTrichotomyFitOp{
+			MaxBadPer:        paramOr(snm.params, "max_bad_per", 0.1),
 			AngleIntervalNum: 5,
 			AErr:             0.01,
 			BErr:             0.01,
 		}) // y = ax+b
 
-		snm.periodAs[shift] = a
-		snm.periodBs[shift] = b
-		snm.periodSDs[shift] = sd
-		snm.positions = append(snm.positions, shift)
+		snm.PeriodAs[shift] = a
+		snm.PeriodBs[shift] = b
+		snm.PeriodSDs[shift] = sd
+		snm.Positions = append(snm.Positions, shift)
+		sds = append(sds, sd)
+	}
+	sort.Slice(snm.Positions, func(i, j int) bool {
+		return snm.Positions[i] < snm.Positions[j]
+	})
+
+	snm.MinSD = ts.PercentThreshold(sds, 0.5)
+	for shift, sd := range snm.PeriodSDs {
+		if sd < snm.MinSD {
+			snm.PeriodSDs[shift] = snm.MinSD
+		}
+	}
+
+	if err := adaptOrFixInterval(snm.params, snm.src, adapter, snm.ForecastInterval, &snm.LowerAdapter, &snm.UpperAdapter); err != nil {
+		return fmt.Errorf("adapt err: %v", err)
 	}
 
+	snm.src = nil // to save the memory
 	return nil
 }
 
+// position 返回stamp所在位置, 如果该位置没有数据, 返回之前最近的位置;
+func (snm *Period3SigmaModel) position(stamp time.Time) time.Duration {
+	pos := ts.PeriodShift(stamp, snm.Begin, snm.Period)
+	if _, ok := snm.PeriodAs[pos]; ok {
+		return pos
+	}
+	return snm.Positions[snm.binaryFind(pos)]
+}
+
 // Forecast .
 func (snm *Period3SigmaModel) Forecast(stamp time.Time) float64 {
-	pos := ts.PeriodShift(stamp, snm.src.Begin(), snm.src.Period())
-	if _, ok := snm.periodAs[pos]; !ok {
-		left := snm.binaryFind(pos)
-		pos = snm.positions[left]
+	pos := snm.position(stamp)
+	x := ts.Timestamp2X(snm.Begin, stamp, snm.Period)
+	expt := snm.PeriodAs[pos]*x + snm.PeriodBs[pos]
+	if snm.BeyoundZero && expt < 0 {
+		expt = 0
 	}
-
-	a := snm.periodAs[pos]
-	b := snm.periodBs[pos]
-	x := ts.Timestamp2X(stamp, snm.src.Begin(), time.Second)
-	return a*x + b
+	return expt
 }
 
 // ForecastInterval .
-func (snm *Period3SigmaModel) ForecastInterval(stamp time.Time) (float64, float64) {
-	pos := ts.PeriodShift(stamp, snm.src.Begin(), snm.src.Period())
-	if _, ok := snm.periodAs[pos]; !ok {
-		left := snm.binaryFind(pos)
-		pos = snm.positions[left]
+func (snm *Period3SigmaModel) ForecastInterval(stamp time.Time) (lower, upper float64) {
+	expt := snm.Forecast(stamp)
+	sd := snm.PeriodSDs[snm.position(stamp)]
+	lower = expt - snm.LowerAdapter*sd
+	upper = expt + snm.UpperAdapter*sd
+	if snm.BeyoundZero && lower < 0 {
+		lower = 0
 	}
-
-	a := snm.periodAs[pos]
-	b := snm.periodBs[pos]
-	x := ts.Timestamp2X(stamp, snm.src.Begin(), time.Second)
-	expt := a*x + b
-	sd := snm.periodSDs[pos]
-	return expt - 3*sd, expt + 3*sd
+	return
 }
 
-func (snm *Period3SigmaModel) binaryFind(pos time.Duration) (left int) {
-	left = 0
-	right := len(snm.positions)
-	for left < right {
-		mid := (left + right) >> 1
-		if snm.positions[mid] > pos {
-			right = mid
-		} else {
-			left = mid
-		}
+// binaryFind 返回Positions中最后一个不大于pos的下标, 如果都大于pos, 返回0;
+func (snm *Period3SigmaModel) binaryFind(pos time.Duration) int {
+	idx := sort.Search(len(snm.Positions), func(i int) bool {
+		return snm.Positions[i] > pos
+	})
+	if idx > 0 {
+		idx--
 	}
-	return left
+	return idx
 }
 
-// FeedLatest .
+// FeedLatest 用残差以指数加权的方式更新点所在位置的常数和标准差;
+//  标准差仍然不小于训练时所有位置sd的中位数;
 func (snm *Period3SigmaModel) FeedLatest(points ts.Points) {
-	// TODO(zhangyuanjia)
+	for _, p := range points {
+		pos := snm.position(p.Stamp())
+		x := ts.Timestamp2X(snm.Begin, p.Stamp(), snm.Period)
+		r := p.Value() - (snm.PeriodAs[pos]*x + snm.PeriodBs[pos])
+		snm.PeriodBs[pos] += feedWeight * r
+		snm.PeriodSDs[pos] = math.Max(feedSD(snm.PeriodSDs[pos], r, feedWeight), snm.MinSD)
+	}
+}
+
+// Clone .
+func (snm *Period3SigmaModel) Clone() detector.OnlineTSModel {
+	c := *snm
+	c.PeriodBs = copyShifts(snm.PeriodBs)
+	c.PeriodSDs = copyShifts(snm.PeriodSDs)
+	return &c
 }
@@ -0,0 +1,47 @@
+package tsmodels
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPeriod3SigmaModel(t *testing.T) {
+	begin := time.Unix(1500000000, 0)
+	freq := time.Minute
+	data := genSeasonTS(begin, freq, time.Hour, 6, 0)
+
+	m := NewPeriod3SigmaModel()
+	if err := m.Train(data, testAdapter); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 60; i++ {
+		stamp := data.End().Add(freq * time.Duration(i))
+		slot := int(stamp.Sub(begin)/freq) % 60
+		expt := 100 + 20*math.Sin(2*math.Pi*float64(slot)/60)
+		if f := m.Forecast(stamp); math.Abs(f-expt) > 4 {
+			t.Fatalf("forecast %v at %v, expect %v", f, stamp, expt)
+		}
+	}
+
+	buf, err := m.ModelData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1 := &Period3SigmaModel{}
+	if err := m1.Recover(buf); err != nil {
+		t.Fatal(err)
+	}
+	stamp := data.End().Add(time.Minute * 30)
+	if m.Forecast(stamp) != m1.Forecast(stamp) {
+		t.Fatalf("recovered model forecast %v, expect %v", m1.Forecast(stamp), m.Forecast(stamp))
+	}
+}
+
+func TestPeriod3SigmaModelNoPeriod(t *testing.T) {
+	data := genLineTS(time.Unix(1500000000, 0), time.Minute, 600, 0)
+	if err := NewPeriod3SigmaModel().Train(data, testAdapter); err == nil {
+		t.Fatal("expect err for aperiodic data")
+	}
+}
@@ -2,62 +2,143 @@ package tstrain
 
 import (
 	"fmt"
-	"os"
-	"time"
+	"sort"
 
 	"code.byted.org/microservice/tsad/worker/detector"
 	"code.byted.org/microservice/tsad/worker/ts"
 	"code.byted.org/microservice/tsad/worker/tstrain/tsmodels"
 )
 
-var creator map[string]func() detector.TSModel
+var creator map[string]ModelCreator
+
+// DefaultModels the candidate models when op.Models is empty, the other models are opt-in,
+//  YahooEgadsPicker scores them on the training data, which prefers the overfitted models
+var DefaultModels = []string{"DcmpLineModel"}
 
 func init() {
-	creator = make(map[string]func() detector.TSModel)
+	creator = make(map[string]ModelCreator)
 
-	// creator["Period3SigmaModel"] = func() TSModel {
-	// 	return tsmodels.NewPeriod3SigmaModel()
-	// }
+	creator["Period3SigmaModel"] = func() detector.TSModel {
+		return tsmodels.NewPeriod3SigmaModel()
+	}
 
-	// creator["LineModel"] = func() TSModel {
-	// 	return tsmodels.NewLineModel()
-	// }
+	creator["LineModel"] = func() detector.TSModel {
+		return tsmodels.NewLineModel()
+	}
+
+	creator["EWMAModel"] = func() detector.TSModel {
+		return tsmodels.NewEWMAModel()
+	}
 
 	creator["DcmpLineModel"] = func() detector.TSModel {
 		return tsmodels.NewDcmpLineModel()
 	}
+
+	creator["STLDcmpLineModel"] = func() detector.TSModel {
+		return tsmodels.NewSTLDcmpLineModel()
+	}
+
+	creator["HoltWintersModel"] = func() detector.TSModel {
+		return tsmodels.NewHoltWintersModel()
+	}
+
+	creator["ARIMAModel"] = func() detector.TSModel {
+		return tsmodels.NewARIMAModel()
+	}
 }
 
-// Train .
-func Train(data ts.TS, adapter detector.ModelAdapter) (detector.TSModel, error) {
-	cs := make([]func() detector.TSModel, 0, 20)
-	for _, c := range creator {
-		cs = append(cs, c)
-	}
-
-	ms := make([]detector.TSModel, 0, len(cs))
-	for _, c := range cs {
-		m := c()
-		begin := time.Now()
-		err := m.Train(data, adapter)
-		if err == nil {
-			fmt.Printf("train %v cost %v\n", m.Name(), time.Since(begin))
-			ms = append(ms, m)
-		} else {
-			fmt.Fprintf(os.Stderr, "train %v err: %v", m.Name(), err)
-		}
+// ResolveModel 返回名为name的模型的全称, name可以省略Model后缀, 如HoltWinters
+func ResolveModel(name string) (string, bool) {
+	if _, ok := creator[name]; ok {
+		return name, true
+	}
+	if _, ok := creator[name+"Model"]; ok {
+		return name + "Model", true
 	}
+	return "", false
+}
 
-	if len(ms) == 0 {
-		return nil, fmt.Errorf("no model can be trained for these data")
+/*
+Train 用op中指定的TSModelPicker训练并选出最好的模型;
+	op.Models不为空时, 只训练其中的模型, 否则只训练DefaultModels;
+	op.Params中的参数会在训练之前通过SetParams传给对应的模型;
+*/
+func Train(data ts.TS, adapter detector.ModelAdapter, op *detector.TrainOption) (detector.TSModel, []detector.ModelScore, error) {
+	if op == nil {
+		op = &detector.TrainOption{}
+	}
+	picker, err := Picker(op.Picker)
+	if err != nil {
+		return nil, nil, err
+	}
+	cs, err := candidates(op)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	best, err := YahooEgadsPicker(data, ms)
+	best, scores, err := picker(data, cs, adapter)
 	if err != nil {
-		return nil, fmt.Errorf("YahooEgadsPicker can't pick the best model, err: %v", err)
+		return nil, scores, fmt.Errorf("pick the best model err: %v", err)
 	}
 
-	return best, nil
+	return best, scores, nil
+}
+
+// candidates 根据op返回候选模型, 并检查模型参数
+func candidates(op *detector.TrainOption) ([]ModelCreator, error) {
+	names := make([]string, 0, len(creator))
+	if len(op.Models) == 0 {
+		names = append(names, DefaultModels...)
+	} else {
+		for _, n := range op.Models {
+			name, ok := ResolveModel(n)
+			if !ok {
+				return nil, fmt.Errorf("no model name: %v", n)
+			}
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	params := make(map[string]map[string]float64, len(op.Params))
+	for n, ps := range op.Params {
+		name, ok := ResolveModel(n)
+		if !ok {
+			return nil, fmt.Errorf("params for unknown model: %v", n)
+		}
+		if len(ps) > 0 {
+			// the params are checked even if the model is not a candidate
+			if err := setParams(creator[name](), ps); err != nil {
+				return nil, fmt.Errorf("model %v: %v", name, err)
+			}
+		}
+		params[name] = ps
+	}
+
+	cs := make([]ModelCreator, 0, len(names))
+	for _, name := range names {
+		c := creator[name]
+		ps, ok := params[name]
+		if !ok || len(ps) == 0 {
+			cs = append(cs, c)
+			continue
+		}
+		cs = append(cs, func() detector.TSModel {
+			m := c()
+			setParams(m, ps)
+			return m
+		})
+	}
+
+	return cs, nil
+}
+
+func setParams(m detector.TSModel, params map[string]float64) error {
+	tunable, ok := m.(detector.TunableTSModel)
+	if !ok {
+		return fmt.Errorf("has no params")
+	}
+	return tunable.SetParams(params)
 }
 
 // Recover .
@@ -0,0 +1,56 @@
+package tstrain
+
+import (
+	"sort"
+	"testing"
+
+	"code.byted.org/microservice/tsad/common"
+	"code.byted.org/microservice/tsad/worker/detector"
+)
+
+// TestCommonModels the manager checks the task configs by the static lists in common
+func TestCommonModels(t *testing.T) {
+	names := make([]string, 0, len(creator))
+	for name := range creator {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) != len(common.ModelNames) {
+		t.Fatalf("models %v, common.ModelNames %v", names, common.ModelNames)
+	}
+	for i := range names {
+		if names[i] != common.ModelNames[i] {
+			t.Fatalf("models %v, common.ModelNames %v", names, common.ModelNames)
+		}
+	}
+
+	for _, name := range common.ModelPickers {
+		if _, err := Picker(name); err != nil {
+			t.Fatalf("common.ModelPickers: %v", err)
+		}
+	}
+	if len(pickers) != len(common.ModelPickers) {
+		t.Fatalf("%v pickers, common.ModelPickers %v", len(pickers), common.ModelPickers)
+	}
+
+	for _, name := range names {
+		m, tunable := creator[name]().(detector.TunableTSModel)
+		keys, ok := common.ModelParams[name]
+		if tunable != ok {
+			t.Fatalf("model %v: tunable %v, in common.ModelParams %v", name, tunable, ok)
+		}
+		if !tunable {
+			continue
+		}
+		params := map[string]float64{"sigma": 4}
+		for _, key := range keys {
+			params[key] = 0.5
+		}
+		if err := m.SetParams(params); err != nil {
+			t.Fatalf("model %v: %v", name, err)
+		}
+		if err := m.SetParams(map[string]float64{"no_such_param": 0.5}); err == nil {
+			t.Fatalf("model %v: expect err for unknown param", name)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package worker
 
 import (
 	"time"
+	"code.byted.org/microservice/tsad/worker/alertsink"
 	"code.byted.org/microservice/tsad/worker/detector"
 	"regexp"
 )
@@ -18,14 +19,86 @@ type Config struct {
 	TSDBRetry   int           `yaml:"TSDBRetry"`
 	TSDBTimeout time.Duration `yaml:"TSDBTimeout"`
 
+	MiddleStoreDir   string        `yaml:"MiddleStoreDir"`   // cache the fetched TSDB points in it, empty to cache them in mysql
+	MiddleStoreTTL   time.Duration `yaml:"MiddleStoreTTL"`   // seconds, default the longest period + 1 day
+	MiddleStoreChunk int           `yaml:"MiddleStoreChunk"` // max points of each block, default 1024
+
+	PrometheusAPI     string        `yaml:"PrometheusAPI"` // such as http://my_host:9090, empty to disable
+	PrometheusStep    time.Duration `yaml:"PrometheusStep"`
+	PrometheusRetry   int           `yaml:"PrometheusRetry"`
+	PrometheusTimeout time.Duration `yaml:"PrometheusTimeout"`
+
+	InfluxDBAPI      string        `yaml:"InfluxDBAPI"` // such as http://my_host:8086, empty to disable
+	InfluxDBDatabase string        `yaml:"InfluxDBDatabase"`
+	InfluxDBOrg      string        `yaml:"InfluxDBOrg"`
+	InfluxDBToken    string        `yaml:"InfluxDBToken"`
+	InfluxDBStep     time.Duration `yaml:"InfluxDBStep"`
+	InfluxDBRetry    int           `yaml:"InfluxDBRetry"`
+	InfluxDBTimeout  time.Duration `yaml:"InfluxDBTimeout"`
+
+	GraphiteAPI     string        `yaml:"GraphiteAPI"` // such as http://my_host:8080, empty to disable
+	GraphiteStep    time.Duration `yaml:"GraphiteStep"`
+	GraphiteRetry   int           `yaml:"GraphiteRetry"`
+	GraphiteTimeout time.Duration `yaml:"GraphiteTimeout"`
+
+	// the pushed points are only buffered in memory, they are lost when the worker restarts,
+	//  so the pushed series can not be trained until they are pushed for 2 days again
+	PushFrequency time.Duration `yaml:"PushFrequency"` // seconds, the pushed points are aligned by it, default 30
+	PushCapacity  int           `yaml:"PushCapacity"`  // max points of each pushed series, default 7 days
+	PushMaxSeries int           `yaml:"PushMaxSeries"` // default 10000
+
+	FileFrequency time.Duration `yaml:"FileFrequency"` // seconds, default 30
+	FileTail      bool          `yaml:"FileTail"`      // only read the appended rows of the files
+	FileRoot      string        `yaml:"FileRoot"`      // only the files in it can be read, empty to disable the file source
+
+	SQLDSN       string        `yaml:"SQLDSN"`       // mysql dsn of the sql source, empty to disable it
+	SQLFrequency time.Duration `yaml:"SQLFrequency"` // seconds, default 30
+	SQLTimeout   time.Duration `yaml:"SQLTimeout"`
+
+	HTTPAllowedHosts []string      `yaml:"HTTPAllowedHosts"` // hosts which the http source can request, * for all, empty to disable it
+	HTTPFrequency    time.Duration `yaml:"HTTPFrequency"`    // seconds, default 30
+	HTTPRetry        int           `yaml:"HTTPRetry"`
+	HTTPTimeout      time.Duration `yaml:"HTTPTimeout"`
+
+	// named backends, the data sources whose Type is the Name are fetched by the backend,
+	//  such as two TSDB clusters; the backends above are named by their types
+	Backends []BackendConfig `yaml:"Backends"`
+
+	// the gen_alarm API of msbackend used by the alert sink named msbackend,
+	//  default http://ms.byted.org/msbackend/api/alarm/gen_alarm
 	AlertAddress string `yaml:"AlertAddress"`
 
+	// named alert sinks, the tasks choose them by alert_sinks in their configs;
+	//  the tasks without alert_sinks send to DefaultAlertSinks, default msbackend;
+	//  the builtin stdout sink writes the alerts to stdout
+	AlertSinks        []alertsink.Config `yaml:"AlertSinks"`
+	DefaultAlertSinks []string           `yaml:"DefaultAlertSinks"`
+
+	// max incidents notified per hour of all the tasks, 0 for unlimited;
+	//  the tasks limit themselves by alert_rate_limit
+	AlertRateLimit int `yaml:"AlertRateLimit"`
+
 	MaxTasks int `yaml:"MaxTasks"`
 
 	WhiteSourceList []string `yaml:"WhiteSourceList"`
 	BlackSourceList []string `yaml:"BlackSourceList"`
 }
 
+// BackendConfig a named data source backend
+type BackendConfig struct {
+	Name    string            `yaml:"Name"`
+	Type    string            `yaml:"Type"` // tsdb, prometheus, influxdb, graphite, push, file, sql, http or expr
+	API     string            `yaml:"API"`  // the endpoint, the dsn of sql, or the root of file
+	Step    time.Duration     `yaml:"Step"` // seconds, 0 for the default of the type
+	Retry   int               `yaml:"Retry"`
+	Timeout time.Duration     `yaml:"Timeout"` // milliseconds
+	Options map[string]string `yaml:"Options"` // the options of the type, see tsfetcher
+
+	// max concurrent queries to the backend shared by all the tasks, 0 for tsfetcher.DefaultConcurrency,
+	//  see tsfetcher.BackendConfig for what is limited by each type
+	Concurrency int `yaml:"Concurrency"`
+}
+
 var (
 	whiteMachines []*regexp.Regexp
 	blackMachines []*regexp.Regexp